@@ -4,16 +4,16 @@ import (
 	"context"
 	"flag"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
-	"github.com/libp2p/go-libp2p/core/host"
-	"github.com/realentity/realentity-node/internal/api"
-	"github.com/realentity/realentity-node/internal/config"
 	"github.com/realentity/realentity-node/internal/discovery"
 	"github.com/realentity/realentity-node/internal/node"
-	"github.com/realentity/realentity-node/internal/protocol"
 	"github.com/realentity/realentity-node/internal/services"
-	"github.com/realentity/realentity-node/internal/utils"
+	"github.com/realentity/realentity-node/internal/tracing"
+	"github.com/realentity/realentity-node/pkg/realentity"
 
 	// Import service implementations to trigger their init() functions
 	_ "github.com/realentity/realentity-node/internal/services/impl"
@@ -27,95 +27,48 @@ func main() {
 	flag.Parse()
 
 	// Load configuration
-	cfg, err := config.LoadConfig(*configFile)
+	cfg, err := realentity.LoadConfig(*configFile)
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
-	// Create the libp2p host with VPS optimization
-	var host host.Host
-
+	// The CLI listens on the standard libp2p port unless another one is configured
+	if cfg.Server.Port == 0 {
+		cfg.Server.Port = node.DefaultHostConfig().ListenPort
+	}
 	if cfg.PrivateKey != "" {
-		// Use hardcoded private key for consistent peer ID
 		log.Println("Using hardcoded private key for consistent peer ID")
-		priv, err := node.DecodePrivateKeyFromBase64(cfg.PrivateKey)
-		if err != nil {
-			log.Fatalf("Failed to decode private key: %v", err)
-		}
-
-		hostConfig := node.DefaultHostConfig()
-		if cfg.Server.PublicIP != "" {
-			hostConfig.ExternalIP = cfg.Server.PublicIP
-		}
-		if cfg.Server.Port != 0 {
-			hostConfig.ListenPort = cfg.Server.Port
-		}
-
-		host, err = node.CreateHostWithPrivateKey(ctx, hostConfig, priv)
-		if err != nil {
-			log.Fatalf("Failed to create host with private key: %v", err)
-		}
-	} else if cfg.Server.PublicIP != "" {
-		// VPS mode with known public IP
-		host, err = node.CreateVPSHost(ctx, cfg.Server.PublicIP, cfg.Server.Port)
-	} else {
-		// Default mode
-		host, err = node.CreateHost(ctx)
 	}
+
+	// The CLI serves the globally registered services
+	n, err := realentity.NewNodeWithRegistry(cfg, services.GlobalRegistry)
 	if err != nil {
-		log.Fatalln("Host creation failed:", err)
+		log.Fatalf("Failed to create node: %v", err)
 	}
+	n.SetConfigFile(*configFile)
 
-	log.Println("Node started with ID:", utils.FormatPeerID(host.ID()))
-
-	// Initialize services
-	initializeServices(host.ID().String())
-
-	// Set up enhanced discovery
-	dm := discovery.NewDiscoveryManager(host)
-
-	// Add discovery mechanisms based on config
-	if cfg.Discovery.EnableMDNS {
-		err = discovery.SetupEnhancedMDNS(ctx, host, cfg.Discovery.MDNSServiceTag, dm)
-		if err != nil {
-			log.Printf("mDNS setup failed: %v\n", err)
-		}
+	log.Printf("Starting HTTP API server on port %d\n", cfg.Server.HTTPPort)
+	if cfg.Server.HTTPSPort > 0 && cfg.Server.TLSCertFile != "" && cfg.Server.TLSKeyFile != "" {
+		log.Printf("HTTPS will be available on port %d\n", cfg.Server.HTTPSPort)
 	}
-
-	if cfg.Discovery.EnableBootstrap && len(cfg.Discovery.BootstrapPeers) > 0 {
-		bootstrapDisc, err := discovery.NewBootstrapDiscovery(host, cfg.Discovery.BootstrapPeers)
-		if err != nil {
-			log.Printf("Bootstrap discovery setup failed: %v\n", err)
-		} else {
-			dm.AddMechanism(bootstrapDisc)
-		}
+	if err := n.Start(ctx); err != nil {
+		log.Fatalln("Node start failed:", err)
 	}
 
-	// Start discovery
-	if err := dm.Start(); err != nil {
-		log.Printf("Failed to start discovery manager: %v\n", err)
+	// The CLI runs a single node, so its tracer provider can be the global one
+	if provider := n.TracerProvider(); provider != nil {
+		tracing.SetGlobal(provider)
 	}
 
-	// Register protocol handler
-	protocol.RegisterHandler(host, "/realentity/1.0.0")
-
-	// Start HTTP API server
-	log.Printf("Starting HTTP API server on port %d\n", cfg.Server.HTTPPort)
-	if cfg.Server.HTTPSPort > 0 && cfg.Server.TLSCertFile != "" && cfg.Server.TLSKeyFile != "" {
-		log.Printf("HTTPS will be available on port %d\n", cfg.Server.HTTPSPort)
-	}
-	apiServer := api.NewServer(host, dm, cfg.Server.HTTPPort, cfg.Server.HTTPSPort, cfg.Server.TLSCertFile, cfg.Server.TLSKeyFile)
-	go func() {
-		if err := apiServer.Start(); err != nil {
-			log.Printf("HTTP API server failed: %v\n", err)
-		}
-	}()
+	// Initialize services
+	initializeServices(n.ID().String())
 
-	log.Printf("Node is ready! Registered services: %v\n", services.GlobalRegistry.ListServices())
+	log.Printf("Node is ready! Registered services: %v\n", n.Services())
 	log.Println("Discovery mechanisms active:")
 	log.Printf("- mDNS: %v\n", cfg.Discovery.EnableMDNS)
 	log.Printf("- Bootstrap: %v (%d peers)\n", cfg.Discovery.EnableBootstrap, len(cfg.Discovery.BootstrapPeers))
 	log.Printf("- DHT: %v\n", cfg.Discovery.EnableDHT)
+	log.Printf("- Routing: %v\n", cfg.Routing.Enabled)
 	log.Printf("- HTTP API: http://localhost:%d/health\n", cfg.Server.HTTPPort)
 	if cfg.Server.HTTPSPort > 0 && cfg.Server.TLSCertFile != "" && cfg.Server.TLSKeyFile != "" {
 		log.Printf("- HTTPS API: https://localhost:%d/health\n", cfg.Server.HTTPSPort)
@@ -129,9 +82,17 @@ func main() {
 	}
 
 	// Periodically log discovery stats
-	go logDiscoveryStats(dm)
-
-	select {} // keep alive
+	go logDiscoveryStats(n.Discovery())
+
+	// Run until interrupted, then stop cleanly so the peer store is saved
+	// and pending trace spans are flushed
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-signals
+	log.Printf("Received %v, shutting down...\n", sig)
+	if err := n.Stop(); err != nil {
+		log.Printf("Error stopping node: %v\n", err)
+	}
 }
 
 func initializeServices(nodeID string) {
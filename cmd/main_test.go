@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/realentity/realentity-node/internal/config"
@@ -253,6 +254,44 @@ func TestConfigIntegration(t *testing.T) {
 	}
 }
 
+// TestConfigMissingKeys tests that settings missing from an existing config
+// file keep their defaults while the ones it sets, even empty, are kept
+func TestConfigMissingKeys(t *testing.T) {
+	tempConfig := filepath.Join(t.TempDir(), "config.json")
+	data := `{
+  "discovery": {
+    "enable_mdns": false,
+    "peer_store_file": "",
+    "service_probes": {"services": [{"service": "math"}]}
+  }
+}`
+	if err := os.WriteFile(tempConfig, []byte(data), 0644); err != nil {
+		t.Fatalf("Failed to write test config file: %v", err)
+	}
+
+	cfg, err := config.LoadConfig(tempConfig)
+	if err != nil {
+		t.Fatalf("Failed to load test config: %v", err)
+	}
+
+	if cfg.Discovery.EnableMDNS {
+		t.Error("Expected mDNS to stay disabled")
+	}
+	if cfg.Discovery.PeerStoreFile != "" {
+		t.Errorf("Expected the empty peer store file to be kept, got '%s'", cfg.Discovery.PeerStoreFile)
+	}
+	if cfg.Gating.BanFile != "bans.json" {
+		t.Errorf("Expected default ban file 'bans.json', got '%s'", cfg.Gating.BanFile)
+	}
+	if cfg.Discovery.MaxPeers != config.DefaultConfig().Discovery.MaxPeers {
+		t.Errorf("Expected default max peers, got %d", cfg.Discovery.MaxPeers)
+	}
+	probes := cfg.Discovery.ServiceProbes.Services
+	if len(probes) != 1 || probes[0].Service != "math" || probes[0].Payload != nil {
+		t.Errorf("Expected only the configured probe target, got %+v", probes)
+	}
+}
+
 // TestEndToEndFlow tests a simplified end-to-end flow without external dependencies
 func TestEndToEndFlow(t *testing.T) {
 	// Create a temporary registry for testing
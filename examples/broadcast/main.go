@@ -0,0 +1,90 @@
+// Command broadcast runs a small in-process network and sends one request to
+// every peer carrying a label, completing once a quorum has answered.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/realentity/realentity-node/pkg/realentity"
+)
+
+func startNode(ctx context.Context, labels ...string) *realentity.Node {
+	cfg := realentity.DefaultConfig()
+	cfg.Server.Port = 0     // Random port
+	cfg.Server.HTTPPort = 0 // No HTTP API
+	cfg.Discovery.EnableMDNS = false
+	cfg.Discovery.EnableBootstrap = false
+	cfg.Discovery.PeerStoreFile = "" // Don't remember peers across runs
+	cfg.Labels = labels
+
+	n, err := realentity.NewNode(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create node: %v", err)
+	}
+	if err := n.Start(ctx); err != nil {
+		log.Fatalf("Failed to start node: %v", err)
+	}
+	return n
+}
+
+// loopbackAddr returns the node's TCP address on the loopback interface
+func loopbackAddr(n *realentity.Node) string {
+	for _, addr := range n.Addrs() {
+		if strings.Contains(addr, "/ip4/127.0.0.1/tcp/") {
+			return addr
+		}
+	}
+	log.Fatalf("Node %s has no loopback address", n.ID())
+	return ""
+}
+
+func main() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	coordinator := startNode(ctx)
+	defer coordinator.Stop()
+
+	// Three workers, two of them labelled as voters
+	workers := []*realentity.Node{
+		startNode(ctx, "voter"),
+		startNode(ctx, "voter"),
+		startNode(ctx),
+	}
+	for i, worker := range workers {
+		defer worker.Stop()
+
+		index := i
+		worker.RegisterService(&realentity.Service{
+			Name: "vote",
+			Handler: func(payload []byte) ([]byte, error) {
+				return json.Marshal(map[string]interface{}{"worker": index, "vote": index%2 == 0})
+			},
+		})
+
+		if err := coordinator.Connect(ctx, loopbackAddr(worker)); err != nil {
+			log.Fatalf("Failed to connect to worker %d: %v", i, err)
+		}
+	}
+
+	result, err := coordinator.Broadcast(ctx, realentity.PeerSelector{Label: "voter"}, "vote", nil,
+		&realentity.BroadcastOptions{Mode: realentity.CompleteQuorum, Timeout: 5 * time.Second})
+	if err != nil {
+		log.Fatalf("Broadcast failed: %v", err)
+	}
+
+	fmt.Printf("Broadcast to %d peers: %d succeeded, quorum of %d reached: %v\n",
+		result.Targeted, result.Succeeded, result.Required, result.Complete)
+	for _, peerResult := range result.Results {
+		if peerResult.Response != nil {
+			fmt.Printf("  %s: %s\n", peerResult.PeerID, peerResult.Response.Result)
+		} else {
+			fmt.Printf("  %s: %s\n", peerResult.PeerID, peerResult.Error)
+		}
+	}
+}
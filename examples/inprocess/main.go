@@ -0,0 +1,88 @@
+// Command inprocess runs two nodes in one process: one provides a service,
+// the other connects to it and calls the service.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/realentity/realentity-node/pkg/realentity"
+)
+
+// localConfig returns a configuration for a node that only talks to peers it
+// is connected to explicitly
+func localConfig() *realentity.Config {
+	cfg := realentity.DefaultConfig()
+	cfg.Server.Port = 0     // Random port
+	cfg.Server.HTTPPort = 0 // No HTTP API
+	cfg.Discovery.EnableMDNS = false
+	cfg.Discovery.EnableBootstrap = false
+	cfg.Discovery.PeerStoreFile = "" // Don't remember peers across runs
+	return cfg
+}
+
+func startNode(ctx context.Context) *realentity.Node {
+	n, err := realentity.NewNode(localConfig())
+	if err != nil {
+		log.Fatalf("Failed to create node: %v", err)
+	}
+	if err := n.Start(ctx); err != nil {
+		log.Fatalf("Failed to start node: %v", err)
+	}
+	return n
+}
+
+func main() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	provider := startNode(ctx)
+	defer provider.Stop()
+
+	// Register a service on the provider
+	err := provider.RegisterService(&realentity.Service{
+		Name:        "greet",
+		Description: "Greets the caller by name",
+		Handler: func(payload []byte) ([]byte, error) {
+			var name string
+			if err := json.Unmarshal(payload, &name); err != nil {
+				return nil, fmt.Errorf("invalid name: %v", err)
+			}
+			return json.Marshal("Hello, " + name + "!")
+		},
+	})
+	if err != nil {
+		log.Fatalf("Failed to register service: %v", err)
+	}
+
+	caller := startNode(ctx)
+	defer caller.Stop()
+
+	// Connect over TCP on the loopback interface
+	for _, addr := range provider.Addrs() {
+		if strings.Contains(addr, "/ip4/127.0.0.1/tcp/") {
+			if err := caller.Connect(ctx, addr); err != nil {
+				log.Fatalf("Failed to connect: %v", err)
+			}
+			break
+		}
+	}
+
+	// Call the service on a specific peer
+	response, err := caller.Client().CallService(ctx, provider.ID(), "greet", "Alice")
+	if err != nil {
+		log.Fatalf("Call failed: %v", err)
+	}
+	fmt.Printf("CallService: %s\n", response.Result)
+
+	// Or let the client pick any peer providing it
+	response, err = caller.Client().CallAny(ctx, "greet", "Bob")
+	if err != nil {
+		log.Fatalf("CallAny failed: %v", err)
+	}
+	fmt.Printf("CallAny: %s (served by %s)\n", response.Result, response.ServedBy)
+}
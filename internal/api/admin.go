@@ -0,0 +1,288 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/realentity/realentity-node/internal/discovery"
+	"github.com/realentity/realentity-node/internal/node"
+)
+
+// GatingResponse lists the connection gating rules and bans in effect
+type GatingResponse struct {
+	Allow []string   `json:"allow"`
+	Deny  []string   `json:"deny"`
+	Bans  []node.Ban `json:"bans"`
+}
+
+// GatingRuleRequest adds a rule to the allow or deny list
+type GatingRuleRequest struct {
+	List string `json:"list"` // "allow" or "deny"
+	Rule string `json:"rule"` // Peer ID, IP address, CIDR or multiaddr pattern
+}
+
+// BanRequest bans a peer or address range
+type BanRequest struct {
+	Target          string `json:"target"`           // Peer ID, IP address, CIDR or multiaddr pattern
+	DurationSeconds int    `json:"duration_seconds"` // 0 = permanent
+	Reason          string `json:"reason"`
+}
+
+// BootstrapPeerRequest adds a bootstrap peer
+type BootstrapPeerRequest struct {
+	Addr string `json:"addr"` // Full multiaddr ending with /p2p/<peer ID>
+}
+
+// SetGater enables the admin endpoints managing the connection gater
+func (s *Server) SetGater(gater *node.ConnectionGater) {
+	s.gater = gater
+}
+
+// SetAdminToken sets the bearer token that requests to the admin endpoints
+// must carry. Without a token only requests from localhost are accepted.
+func (s *Server) SetAdminToken(adminToken string) {
+	s.adminToken = adminToken
+}
+
+// SetBootstrap enables the admin endpoints managing bootstrap peers. onChange
+// is called with the bootstrap peer addresses after every change, to save them.
+func (s *Server) SetBootstrap(bootstrap *discovery.BootstrapDiscovery, onChange func(addrs []string) error) {
+	s.bootstrap = bootstrap
+	s.onBootstrapChange = onChange
+}
+
+// requireAdmin rejects requests that are not authorized for the admin endpoints
+func (s *Server) requireAdmin(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.adminToken != "" {
+			expected := "Bearer " + s.adminToken
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(expected)) != 1 {
+				writeAdminError(w, http.StatusUnauthorized, "Invalid or missing admin token")
+				return
+			}
+		} else if host, _, err := net.SplitHostPort(r.RemoteAddr); err != nil || !net.ParseIP(host).IsLoopback() {
+			writeAdminError(w, http.StatusForbidden, "Admin endpoints are only available from localhost without an admin token")
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+// gatingEnabled reports whether the connection gater is set, sending an error response if not
+func (s *Server) gatingEnabled(w http.ResponseWriter) bool {
+	if s.gater == nil {
+		writeAdminError(w, http.StatusNotFound, "Connection gating is not enabled")
+		return false
+	}
+	return true
+}
+
+// writeAdminError sends an error response from an admin endpoint
+func writeAdminError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error": message,
+	})
+}
+
+// handleGating handles the /api/admin/gating endpoint, listing rules and bans
+func (s *Server) handleGating(w http.ResponseWriter, r *http.Request) {
+	if !s.gatingEnabled(w) {
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		writeAdminError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+		return
+	}
+
+	allow, deny := s.gater.Rules()
+	response := GatingResponse{
+		Allow: allow,
+		Deny:  deny,
+		Bans:  s.gater.Bans(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleGatingRules handles the /api/admin/gating/rules endpoint: POST adds
+// a rule and DELETE removes the rule given by the list and rule parameters.
+// Rules changed here are not saved to the configuration.
+func (s *Server) handleGatingRules(w http.ResponseWriter, r *http.Request) {
+	if !s.gatingEnabled(w) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		var req GatingRuleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeAdminError(w, http.StatusBadRequest, fmt.Sprintf("Invalid request body: %v", err))
+			return
+		}
+		if err := s.gater.AddRule(req.List, req.Rule); err != nil {
+			writeAdminError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		closed := s.gater.CloseBlocked(s.host.Network())
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"list":               req.List,
+			"rule":               req.Rule,
+			"closed_connections": closed,
+		})
+
+	case http.MethodDelete:
+		list, rule := r.URL.Query().Get("list"), r.URL.Query().Get("rule")
+		if !s.gater.RemoveRule(list, rule) {
+			writeAdminError(w, http.StatusNotFound, fmt.Sprintf("No %s rule %s", list, rule))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeAdminError(w, http.StatusMethodNotAllowed, "Only POST and DELETE methods are allowed")
+	}
+}
+
+// handleBans handles the /api/admin/bans endpoint: POST bans a target and
+// closes its connections, DELETE lifts the ban given by the target parameter
+func (s *Server) handleBans(w http.ResponseWriter, r *http.Request) {
+	if !s.gatingEnabled(w) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		var req BanRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeAdminError(w, http.StatusBadRequest, fmt.Sprintf("Invalid request body: %v", err))
+			return
+		}
+		if req.DurationSeconds < 0 {
+			writeAdminError(w, http.StatusBadRequest, "Duration cannot be negative")
+			return
+		}
+
+		ban, err := s.gater.Ban(req.Target, time.Duration(req.DurationSeconds)*time.Second, req.Reason)
+		if err != nil {
+			writeAdminError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		closed := s.gater.CloseBlocked(s.host.Network())
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"ban":                ban,
+			"closed_connections": closed,
+		})
+
+	case http.MethodDelete:
+		target := r.URL.Query().Get("target")
+		if !s.gater.Unban(target) {
+			writeAdminError(w, http.StatusNotFound, fmt.Sprintf("No ban for %s", target))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeAdminError(w, http.StatusMethodNotAllowed, "Only POST and DELETE methods are allowed")
+	}
+}
+
+// handleBootstrap handles the /api/admin/bootstrap endpoint: GET reports the
+// status of every bootstrap peer, POST adds a bootstrap peer and DELETE removes
+// the one given by the peer_id parameter. Changes are saved to the configuration.
+func (s *Server) handleBootstrap(w http.ResponseWriter, r *http.Request) {
+	if s.bootstrap == nil {
+		writeAdminError(w, http.StatusNotFound, "Bootstrap discovery is not enabled")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"peers": s.bootstrap.Status(),
+		})
+
+	case http.MethodPost:
+		var req BootstrapPeerRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeAdminError(w, http.StatusBadRequest, fmt.Sprintf("Invalid request body: %v", err))
+			return
+		}
+		addrInfo, err := discovery.ParseBootstrapPeer(req.Addr)
+		if err != nil {
+			writeAdminError(w, http.StatusBadRequest, fmt.Sprintf("Invalid bootstrap peer address: %v", err))
+			return
+		}
+
+		s.bootstrapMu.Lock()
+		added := s.bootstrap.AddBootstrapPeer(addrInfo)
+		saved := s.saveBootstrapPeers(w)
+		s.bootstrapMu.Unlock()
+		if !saved {
+			return
+		}
+		status, _ := s.bootstrap.PeerStatus(addrInfo.ID)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"peer":  status,
+			"added": added,
+		})
+
+	case http.MethodDelete:
+		peerID, err := peer.Decode(r.URL.Query().Get("peer_id"))
+		if err != nil {
+			writeAdminError(w, http.StatusBadRequest, fmt.Sprintf("Invalid peer ID: %v", err))
+			return
+		}
+		s.bootstrapMu.Lock()
+		removed := s.bootstrap.RemoveBootstrapPeer(peerID)
+		saved := removed && s.saveBootstrapPeers(w)
+		s.bootstrapMu.Unlock()
+		if !removed {
+			writeAdminError(w, http.StatusNotFound, fmt.Sprintf("%s is not a bootstrap peer", peerID))
+			return
+		}
+		if !saved {
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeAdminError(w, http.StatusMethodNotAllowed, "Only GET, POST and DELETE methods are allowed")
+	}
+}
+
+// saveBootstrapPeers saves the bootstrap peers after a change, sending an
+// error response if that fails. The change stays in effect until restart.
+// Must be called with s.bootstrapMu held, so that saves happen in the order
+// of the changes.
+func (s *Server) saveBootstrapPeers(w http.ResponseWriter) bool {
+	if s.onBootstrapChange == nil {
+		return true
+	}
+	if err := s.onBootstrapChange(s.bootstrap.BootstrapAddrs()); err != nil {
+		writeAdminError(w, http.StatusInternalServerError, fmt.Sprintf("Bootstrap peers changed but not saved: %v", err))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,178 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/realentity/realentity-node/internal/discovery"
+	"github.com/realentity/realentity-node/internal/node"
+	"github.com/realentity/realentity-node/internal/testutil"
+)
+
+// newAdminServer creates a server with connection gating enabled, saving
+// bans in a temporary directory
+func newAdminServer(t *testing.T) *Server {
+	gater, err := node.NewConnectionGater(node.GaterConfig{
+		BanFile: filepath.Join(t.TempDir(), "bans.json"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create connection gater: %v", err)
+	}
+
+	s := NewServer(testutil.NewHost(t), nil, nil, 0, 0, "", "")
+	s.SetGater(gater)
+	return s
+}
+
+// adminRequest sends a request to an admin handler from the given address
+func adminRequest(s *Server, handler http.HandlerFunc, method, target, body, remoteAddr, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.RemoteAddr = remoteAddr
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	s.requireAdmin(handler)(recorder, req)
+	return recorder
+}
+
+// TestRequireAdmin tests that admin endpoints check the token, and accept
+// requests without a token only from localhost
+func TestRequireAdmin(t *testing.T) {
+	s := newAdminServer(t)
+	const local, remote = "127.0.0.1:5000", "203.0.113.7:5000"
+
+	// Without a token only loopback callers are let through
+	if rec := adminRequest(s, s.handleGating, http.MethodGet, "/api/admin/gating", "", remote, ""); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected remote caller without token to be forbidden, got %d", rec.Code)
+	}
+	if rec := adminRequest(s, s.handleGating, http.MethodGet, "/api/admin/gating", "", local, ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected local caller without token to be accepted, got %d", rec.Code)
+	}
+
+	// With a token every caller must present it
+	s.SetAdminToken("secret")
+	tests := []struct {
+		name       string
+		remoteAddr string
+		token      string
+		status     int
+	}{
+		{"missing token", local, "", http.StatusUnauthorized},
+		{"wrong token", local, "wrong", http.StatusUnauthorized},
+		{"remote caller with token", remote, "secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		rec := adminRequest(s, s.handleGating, http.MethodGet, "/api/admin/gating", "", tt.remoteAddr, tt.token)
+		if rec.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.status, rec.Code)
+		}
+	}
+}
+
+// TestBanUnban tests that a target can be banned and unbanned through /api/admin/bans
+func TestBanUnban(t *testing.T) {
+	s := newAdminServer(t)
+	const local = "127.0.0.1:5000"
+
+	rec := adminRequest(s, s.handleBans, http.MethodPost, "/api/admin/bans",
+		`{"target": "203.0.113.0/24", "duration_seconds": 60, "reason": "spam"}`, local, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Failed to ban target: %d %s", rec.Code, rec.Body.String())
+	}
+	var response struct {
+		Ban node.Ban `json:"ban"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode ban response: %v", err)
+	}
+	if response.Ban.Target != "203.0.113.0/24" || response.Ban.Reason != "spam" || response.Ban.ExpiresAt == nil {
+		t.Errorf("Unexpected ban: %+v", response.Ban)
+	}
+	if bans := s.gater.Bans(); len(bans) != 1 {
+		t.Errorf("Expected 1 ban in effect, got %d", len(bans))
+	}
+
+	rec = adminRequest(s, s.handleBans, http.MethodPost, "/api/admin/bans",
+		`{"target": "203.0.113.9", "duration_seconds": -1}`, local, "")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected negative duration to be rejected, got %d", rec.Code)
+	}
+
+	rec = adminRequest(s, s.handleBans, http.MethodDelete, "/api/admin/bans?target=203.0.113.0/24", "", local, "")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Failed to unban target: %d %s", rec.Code, rec.Body.String())
+	}
+	if bans := s.gater.Bans(); len(bans) != 0 {
+		t.Errorf("Expected no bans after unban, got %v", bans)
+	}
+
+	rec = adminRequest(s, s.handleBans, http.MethodDelete, "/api/admin/bans?target=203.0.113.0/24", "", local, "")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected unbanning an unknown target to fail, got %d", rec.Code)
+	}
+}
+
+// TestBootstrapSavesSerialized tests that concurrent bootstrap peer changes
+// are saved in order, so the last save holds the peers in effect
+func TestBootstrapSavesSerialized(t *testing.T) {
+	s := newAdminServer(t)
+	bootstrap, err := discovery.NewBootstrapDiscovery(s.host, nil)
+	if err != nil {
+		t.Fatalf("Failed to create bootstrap discovery: %v", err)
+	}
+
+	var mu sync.Mutex
+	var saved []string
+	s.SetBootstrap(bootstrap, func(addrs []string) error {
+		time.Sleep(time.Millisecond) // Widen the window between snapshot and save
+		mu.Lock()
+		saved = addrs
+		mu.Unlock()
+		return nil
+	})
+
+	const local = "127.0.0.1:5000"
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		_, pub, err := crypto.GenerateEd25519Key(rand.Reader)
+		if err != nil {
+			t.Fatalf("Failed to generate key: %v", err)
+		}
+		id, err := peer.IDFromPublicKey(pub)
+		if err != nil {
+			t.Fatalf("Failed to derive peer ID: %v", err)
+		}
+
+		wg.Add(1)
+		go func(id peer.ID, remove bool) {
+			defer wg.Done()
+			body := `{"addr": "/ip4/198.51.100.1/tcp/4001/p2p/` + id.String() + `"}`
+			if rec := adminRequest(s, s.handleBootstrap, http.MethodPost, "/api/admin/bootstrap", body, local, ""); rec.Code != http.StatusOK {
+				t.Errorf("Failed to add bootstrap peer: %d %s", rec.Code, rec.Body.String())
+				return
+			}
+			if remove {
+				target := "/api/admin/bootstrap?peer_id=" + id.String()
+				if rec := adminRequest(s, s.handleBootstrap, http.MethodDelete, target, "", local, ""); rec.Code != http.StatusNoContent {
+					t.Errorf("Failed to remove bootstrap peer: %d %s", rec.Code, rec.Body.String())
+				}
+			}
+		}(id, i%2 == 0)
+	}
+	wg.Wait()
+
+	if addrs := bootstrap.BootstrapAddrs(); len(addrs) != 10 || !reflect.DeepEqual(saved, addrs) {
+		t.Errorf("Expected the last save to hold the 10 peers in effect, saved %d of %d", len(saved), len(addrs))
+	}
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/realentity/realentity-node/internal/discovery"
+)
+
+// eventsKeepAlive is how often a comment is sent on an idle event stream so
+// proxies keep the connection open
+const eventsKeepAlive = 15 * time.Second
+
+// handleEvents handles the /api/events endpoint, streaming peer events as
+// server-sent events. The optional types query parameter is a comma
+// separated list of event types to receive.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Streaming is not supported",
+		})
+		return
+	}
+
+	var types []discovery.PeerEventType
+	if param := r.URL.Query().Get("types"); param != "" {
+		for _, t := range strings.Split(param, ",") {
+			types = append(types, discovery.PeerEventType(strings.TrimSpace(t)))
+		}
+	}
+
+	sub := s.discovery.Events().Subscribe(0, types...)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-sub.C:
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -5,23 +5,39 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/realentity/realentity-node/internal/discovery"
+	"github.com/realentity/realentity-node/internal/node"
+	"github.com/realentity/realentity-node/internal/protocol"
 	"github.com/realentity/realentity-node/internal/services"
+	"github.com/realentity/realentity-node/internal/tracing"
+	"github.com/realentity/realentity-node/internal/utils"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Server represents the HTTP API server
 type Server struct {
 	host        host.Host
 	discovery   *discovery.DiscoveryManager
+	client      *utils.ServiceClient
+	gater       *node.ConnectionGater
+	adminToken  string
+	bootstrap   *discovery.BootstrapDiscovery
+	registry    *services.Registry
+	tracer      trace.Tracer
 	port        int
 	httpsPort   int
 	certFile    string
 	keyFile     string
 	server      *http.Server
 	httpsServer *http.Server
+
+	onBootstrapChange func(addrs []string) error
+	bootstrapMu       sync.Mutex // Serializes bootstrap peer changes with their saves
 }
 
 // HealthResponse represents the health check response
@@ -45,15 +61,36 @@ type NodeInfoResponse struct {
 	Discovery   map[string]bool `json:"discovery"`
 	Protocols   []string        `json:"protocols"`
 	Connections int             `json:"connections"`
+
+	ConnectionStats ConnectionStats      `json:"connection_stats"` // Connections by direction and protection
+	LegacyRequests  protocol.LegacyStats `json:"legacy_requests"`  // Usage of the deprecated request format
+}
+
+// DiscoveryResponse reports the state of every discovery mechanism
+type DiscoveryResponse struct {
+	Mechanisms []discovery.MechanismStatus `json:"mechanisms"`
+	PeerStore  discovery.PeerStoreStats    `json:"peer_store"`
+}
+
+// ConnectionStats counts the open connections of the node
+type ConnectionStats struct {
+	Inbound        int `json:"inbound"`
+	Outbound       int `json:"outbound"`
+	Peers          int `json:"peers"`           // Connected peers
+	ProtectedPeers int `json:"protected_peers"` // Connected peers the connection manager never trims
 }
 
 var startTime = time.Now()
 
-// NewServer creates a new HTTP API server
-func NewServer(h host.Host, dm *discovery.DiscoveryManager, port int, httpsPort int, certFile, keyFile string) *Server {
+// NewServer creates a new HTTP API server. client makes the remote calls and
+// its circuit breakers are reported by /api/peers.
+func NewServer(h host.Host, dm *discovery.DiscoveryManager, client *utils.ServiceClient, port int, httpsPort int, certFile, keyFile string) *Server {
 	return &Server{
 		host:      h,
 		discovery: dm,
+		client:    client,
+		registry:  services.GlobalRegistry,
+		tracer:    tracing.Tracer(nil),
 		port:      port,
 		httpsPort: httpsPort,
 		certFile:  certFile,
@@ -61,6 +98,16 @@ func NewServer(h host.Host, dm *discovery.DiscoveryManager, port int, httpsPort
 	}
 }
 
+// SetRegistry sets the registry whose services the API lists and executes
+func (s *Server) SetRegistry(registry *services.Registry) {
+	s.registry = registry
+}
+
+// SetTracerProvider sets the tracer provider recording the spans of API requests
+func (s *Server) SetTracerProvider(provider trace.TracerProvider) {
+	s.tracer = tracing.Tracer(provider)
+}
+
 // Start starts the HTTP server
 func (s *Server) Start() error {
 	mux := http.NewServeMux()
@@ -74,12 +121,29 @@ func (s *Server) Start() error {
 	// Peers endpoint
 	mux.HandleFunc("/api/peers", s.handlePeers)
 
+	// Discovery mechanism status endpoint
+	mux.HandleFunc("/api/discovery", s.handleDiscovery)
+
+	// Peer events endpoint (server-sent events)
+	mux.HandleFunc("/api/events", s.handleEvents)
+
 	// Services endpoint
 	mux.HandleFunc("/api/services", s.handleServices)
 
 	// Service execution endpoint
 	mux.HandleFunc("/api/services/execute", s.handleServiceExecution)
 
+	// Service broadcast endpoint
+	mux.HandleFunc("/api/services/broadcast", s.handleServiceBroadcast)
+
+	// Connection gating admin endpoints
+	mux.HandleFunc("/api/admin/gating", s.requireAdmin(s.handleGating))
+	mux.HandleFunc("/api/admin/gating/rules", s.requireAdmin(s.handleGatingRules))
+	mux.HandleFunc("/api/admin/bans", s.requireAdmin(s.handleBans))
+
+	// Bootstrap peer admin endpoint
+	mux.HandleFunc("/api/admin/bootstrap", s.requireAdmin(s.handleBootstrap))
+
 	// Start HTTP server
 	if s.port > 0 {
 		s.server = &http.Server{
@@ -139,7 +203,7 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	peers := s.discovery.GetPeers()
-	services := services.GlobalRegistry.ListServices()
+	services := s.registry.ListServices()
 
 	response := HealthResponse{
 		Status:    "healthy",
@@ -148,12 +212,8 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 		Peers:     len(peers),
 		Services:  services,
 		Uptime:    time.Since(startTime).String(),
-		Discovery: map[string]bool{
-			"mdns":      true, // TODO: Get actual status from discovery manager
-			"bootstrap": len(peers) > 0,
-			"dht":       false, // TODO: Get actual DHT status
-		},
-		Version: "1.0.0", // TODO: Get from build info
+		Discovery: s.discovery.MechanismsRunning(),
+		Version:   "1.0.0", // TODO: Get from build info
 	}
 
 	w.WriteHeader(http.StatusOK)
@@ -182,23 +242,55 @@ func (s *Server) handleNodeInfo(w http.ResponseWriter, r *http.Request) {
 	}
 
 	response := NodeInfoResponse{
-		PeerID:    s.host.ID().String(),
-		Addresses: addresses,
-		Peers:     peerStrings,
-		Services:  services.GlobalRegistry.ListServices(),
-		Discovery: map[string]bool{
-			"mdns":      true,
-			"bootstrap": len(peers) > 0,
-			"dht":       false,
-		},
-		Protocols:   protocolStrings,
-		Connections: len(s.host.Network().Conns()),
+		PeerID:          s.host.ID().String(),
+		Addresses:       addresses,
+		Peers:           peerStrings,
+		Services:        s.registry.ListServices(),
+		Discovery:       s.discovery.MechanismsRunning(),
+		Protocols:       protocolStrings,
+		Connections:     len(s.host.Network().Conns()),
+		ConnectionStats: s.connectionStats(),
+		LegacyRequests:  protocol.GetLegacyStats(),
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleDiscovery handles the /api/discovery endpoint
+func (s *Server) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	response := DiscoveryResponse{
+		Mechanisms: s.discovery.MechanismStatuses(),
+		PeerStore:  s.discovery.PeerStoreStats(),
 	}
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
 }
 
+// connectionStats counts the host's connections by direction
+func (s *Server) connectionStats() ConnectionStats {
+	var stats ConnectionStats
+	for _, conn := range s.host.Network().Conns() {
+		if conn.Stat().Direction == network.DirInbound {
+			stats.Inbound++
+		} else {
+			stats.Outbound++
+		}
+	}
+
+	peers := s.host.Network().Peers()
+	stats.Peers = len(peers)
+	for _, peerID := range peers {
+		if s.host.ConnManager().IsProtected(peerID, "") {
+			stats.ProtectedPeers++
+		}
+	}
+	return stats
+}
+
 // handlePeers handles the /api/peers endpoint
 func (s *Server) handlePeers(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -207,30 +299,79 @@ func (s *Server) handlePeers(w http.ResponseWriter, r *http.Request) {
 	peerInfo := make([]map[string]interface{}, 0, len(peers))
 
 	for peerID, info := range peers {
+		serviceHealth := make(map[string]interface{}, len(info.ServiceHealth))
+		for service, health := range info.ServiceHealth {
+			serviceHealth[service] = map[string]interface{}{
+				"probes":               health.Probes,
+				"successes":            health.Successes,
+				"consecutive_failures": health.ConsecutiveFailures,
+				"last_latency_ms":      durationMillis(health.LastLatency),
+				"last_error":           health.LastError,
+				"last_probe":           health.LastProbe,
+			}
+		}
+
+		breakers := make([]map[string]interface{}, 0)
+		for _, breaker := range s.client.BreakerStates(peerID) {
+			state := map[string]interface{}{
+				"service":              breaker.Service,
+				"state":                breaker.State,
+				"consecutive_failures": breaker.ConsecutiveFailures,
+			}
+			if !breaker.OpenedAt.IsZero() {
+				state["opened_at"] = breaker.OpenedAt
+			}
+			if !breaker.RetryAt.IsZero() {
+				state["retry_at"] = breaker.RetryAt
+			}
+			breakers = append(breakers, state)
+		}
+
 		peerInfo = append(peerInfo, map[string]interface{}{
-			"peer_id":   peerID.String(),
-			"last_seen": info.LastSeen,
-			"source":    info.Source,
-			"status":    info.Status,
-			"services":  info.Services,
-			"connected": s.host.Network().Connectedness(peerID),
+			"peer_id":       peerID.String(),
+			"last_seen":     info.LastSeen,
+			"source":        info.Source,
+			"status":        info.Status,
+			"services":      info.Services,
+			"service_hints": info.ServiceHints,
+			"labels":        info.Labels,
+			"connected":     s.host.Network().Connectedness(peerID),
+			"reliability":   info.Reliability,
+			"score":         info.Score(),
+			"quality": map[string]interface{}{
+				"rtt_p50_ms":   durationMillis(info.Quality.RTTPercentile(0.5)),
+				"rtt_p90_ms":   durationMillis(info.Quality.RTTPercentile(0.9)),
+				"rtt_p99_ms":   durationMillis(info.Quality.RTTPercentile(0.99)),
+				"success_rate": info.Quality.SuccessRate(),
+				"probe_score":  info.Quality.Score,
+				"probes":       info.Quality.Probes,
+				"last_probe":   info.Quality.LastProbe,
+			},
+			"service_health": serviceHealth,
+			"breakers":       breakers,
 		})
 	}
 
 	response := map[string]interface{}{
 		"total_peers": len(peers),
 		"peers":       peerInfo,
+		"peer_store":  s.discovery.PeerStoreStats(),
 	}
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
 }
 
+// durationMillis converts a duration to fractional milliseconds
+func durationMillis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
 // handleServices handles the /api/services endpoint
 func (s *Server) handleServices(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	servicesList := services.GlobalRegistry.ListServices()
+	servicesList := s.registry.ListServices()
 
 	response := map[string]interface{}{
 		"total_services": len(servicesList),
@@ -302,8 +443,15 @@ func (s *Server) handleServiceExecution(w http.ResponseWriter, r *http.Request)
 		Payload:   json.RawMessage(payloadBytes),
 	}
 
-	// Execute service using the original GlobalRegistry
-	response := services.GlobalRegistry.ExecuteService(serviceReq)
+	// Start the trace for this request
+	ctx, span := s.tracer.Start(r.Context(), "api.execute "+serviceReq.Service,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(tracing.RequestAttributes(serviceReq)...))
+	log.Printf("API request %s for service %s (trace: %s)", serviceReq.RequestID, serviceReq.Service, tracing.TraceID(ctx))
+
+	// Execute service, abandoning it if the HTTP client goes away
+	response := s.registry.ExecuteServiceContext(ctx, serviceReq)
+	tracing.EndSpan(span, response, nil)
 
 	// Return response
 	if response.Success {
@@ -313,3 +461,104 @@ func (s *Server) handleServiceExecution(w http.ResponseWriter, r *http.Request)
 	}
 	json.NewEncoder(w).Encode(response)
 }
+
+// ServiceBroadcastRequest represents a request to execute a service on many peers
+type ServiceBroadcastRequest struct {
+	Service   string      `json:"service"`
+	Payload   interface{} `json:"payload"`
+	Target    string      `json:"target,omitempty"`     // "all", "label" or "top" (default "all")
+	Label     string      `json:"label,omitempty"`      // Peer label for the "label" target
+	TopK      int         `json:"top_k,omitempty"`      // Number of peers for the "top" target
+	Mode      string      `json:"mode,omitempty"`       // "all", "quorum" or "first" (default "all")
+	Count     int         `json:"count,omitempty"`      // Successes needed for "quorum" and "first"
+	TimeoutMs int         `json:"timeout_ms,omitempty"` // Time allowed for the broadcast
+}
+
+// handleServiceBroadcast handles the /api/services/broadcast endpoint
+func (s *Server) handleServiceBroadcast(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Only POST method is allowed",
+		})
+		return
+	}
+
+	var broadcastReq ServiceBroadcastRequest
+	if err := json.NewDecoder(r.Body).Decode(&broadcastReq); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Invalid request body: %v", err),
+		})
+		return
+	}
+
+	if broadcastReq.Service == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Service name is required",
+		})
+		return
+	}
+
+	// Choose the target peers
+	var selector discovery.PeerSelector
+	switch broadcastReq.Target {
+	case "", "all":
+	case "label":
+		if broadcastReq.Label == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "Label is required for the label target",
+			})
+			return
+		}
+		selector.Label = broadcastReq.Label
+	case "top":
+		if broadcastReq.TopK <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "top_k must be positive for the top target",
+			})
+			return
+		}
+		selector.TopK = broadcastReq.TopK
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Unknown target: %s", broadcastReq.Target),
+		})
+		return
+	}
+
+	peers := s.discovery.SelectPeers(selector)
+	if len(peers) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "No peers match the target",
+		})
+		return
+	}
+
+	result, err := s.client.Broadcast(r.Context(), peers, broadcastReq.Service, broadcastReq.Payload, &utils.BroadcastOptions{
+		Mode:    broadcastReq.Mode,
+		Count:   broadcastReq.Count,
+		Timeout: time.Duration(broadcastReq.TimeoutMs) * time.Millisecond,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if result.Complete {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	json.NewEncoder(w).Encode(result)
+}
@@ -8,6 +8,8 @@ import (
 	"os"
 	"strconv"
 	"strings"
+
+	"github.com/realentity/realentity-node/internal/fileutil"
 )
 
 // DiscoveryConfig holds configuration for discovery mechanisms
@@ -19,6 +21,96 @@ type DiscoveryConfig struct {
 	MDNSQuietMode   bool     `json:"mdns_quiet_mode"`
 	BootstrapPeers  []string `json:"bootstrap_peers"`
 	DHTRendezvous   string   `json:"dht_rendezvous"`
+	DHTMode         string   `json:"dht_mode"` // "auto", "server" or "client"
+
+	// StaticPeersFile lists known peers, one multiaddr and optional labels
+	// per line; changes are applied without a restart (empty = disabled)
+	StaticPeersFile string `json:"static_peers_file"`
+
+	// DNS finds peers in dnsaddr TXT and SRV records (disabled when no names are set)
+	DNS DNSDiscoveryConfig `json:"dns"`
+
+	// PEX shares known peers with connected peers
+	PEX PEXConfig `json:"pex"`
+
+	// ProbeIntervalSeconds sets how often connected peers are probed for
+	// latency and health (0 = default, negative = disabled)
+	ProbeIntervalSeconds int `json:"probe_interval_seconds"`
+
+	// ServiceProbes calls services on peers to check that they serve requests
+	ServiceProbes ServiceProbeConfig `json:"service_probes"`
+
+	// PeerStoreFile is the database keeping known peers across restarts (empty = memory only)
+	PeerStoreFile        string `json:"peer_store_file"`
+	PeerStoreMaxAgeHours int    `json:"peer_store_max_age_hours"` // Saved peers not seen for longer are dropped on load
+
+	// Peer store capacity; when full, the least valuable disconnected peer is evicted
+	MaxPeers                 int `json:"max_peers"`
+	PeerTTLMinutes           int `json:"peer_ttl_minutes"`            // Peers not seen for this long are removed
+	UnreliablePeerTTLMinutes int `json:"unreliable_peer_ttl_minutes"` // Unreliable peers not seen for this long are removed
+
+	// AutoDial connects to peers found by any discovery mechanism
+	AutoDial AutoDialConfig `json:"auto_dial"`
+
+	// Schedule decides how often each mechanism looks for peers
+	Schedule DiscoveryScheduleConfig `json:"schedule"`
+}
+
+// DiscoveryScheduleConfig holds when discovery mechanisms look for peers.
+// Below the target peer count every mechanism runs every min_interval_seconds;
+// with enough peers, intervals double after each round up to their maximum.
+type DiscoveryScheduleConfig struct {
+	TargetPeers        int                                `json:"target_peers"`         // 0 = auto_dial.target_peers
+	MinIntervalSeconds int                                `json:"min_interval_seconds"` // Interval while below the target (0 = default)
+	Defaults           MechanismScheduleConfig            `json:"defaults"`
+	Mechanisms         map[string]MechanismScheduleConfig `json:"mechanisms,omitempty"` // Settings by mechanism name, e.g. "dht"
+}
+
+// MechanismScheduleConfig holds the schedule of one discovery mechanism (0 = default)
+type MechanismScheduleConfig struct {
+	IntervalSeconds    int `json:"interval_seconds"`     // Interval once the node has enough peers
+	MaxIntervalSeconds int `json:"max_interval_seconds"` // Longest interval while the node has enough peers
+	Limit              int `json:"limit"`                // Peers asked for per round
+	TimeoutSeconds     int `json:"timeout_seconds"`      // Time allowed for a round
+}
+
+// AutoDialConfig holds the policy for connecting to discovered peers
+type AutoDialConfig struct {
+	TargetPeers        int `json:"target_peers"`         // Connections to maintain (0 = default, negative = disabled)
+	MaxConcurrentDials int `json:"max_concurrent_dials"` // Dials in flight at once
+	BackoffSeconds     int `json:"backoff_seconds"`      // Wait after the first failed dial of a peer
+	MaxBackoffSeconds  int `json:"max_backoff_seconds"`  // Upper bound for the wait, doubled on each failure
+}
+
+// DNSDiscoveryConfig holds the DNS records resolved into peers
+type DNSDiscoveryConfig struct {
+	DNSAddrs        []string `json:"dnsaddrs"`          // Domains with _dnsaddr TXT records
+	SRVNames        []string `json:"srv_names"`         // Full SRV record names; targets need a peer_id TXT record or peer_id_http_port
+	PeerIDHTTPPort  int      `json:"peer_id_http_port"` // HTTP API port giving the peer ID of SRV targets without TXT records (0 = TXT only)
+	Resolver        string   `json:"resolver"`          // DNS server as host:port (empty = system resolver)
+	IntervalSeconds int      `json:"interval_seconds"`  // How often the records are resolved (0 = default)
+}
+
+// PEXConfig holds peer exchange settings
+type PEXConfig struct {
+	Enabled         bool `json:"enabled"`
+	IntervalSeconds int  `json:"interval_seconds"` // How often connected peers are asked for their peers (0 = default)
+	SampleSize      int  `json:"sample_size"`      // Peers shared per response, and accepted from one (0 = default)
+}
+
+// ServiceProbeConfig holds the policy for calling services on peers
+type ServiceProbeConfig struct {
+	Enabled         bool                 `json:"enabled"`
+	OnConnect       bool                 `json:"on_connect"`       // Probe peers once they connect and their services are known
+	IntervalSeconds int                  `json:"interval_seconds"` // Probe connected peers periodically (0 = never)
+	TimeoutSeconds  int                  `json:"timeout_seconds"`  // Time allowed for a round of probes of one peer
+	Services        []ServiceProbeTarget `json:"services"`
+}
+
+// ServiceProbeTarget is a service called by the prober and its request payload
+type ServiceProbeTarget struct {
+	Service string          `json:"service"`
+	Payload json.RawMessage `json:"payload,omitempty"`
 }
 
 // ServerConfig holds server-specific configuration
@@ -30,14 +122,61 @@ type ServerConfig struct {
 	TLSCertFile string `json:"tls_cert_file"` // Path to TLS certificate file
 	TLSKeyFile  string `json:"tls_key_file"`  // Path to TLS private key file
 	PublicIP    string `json:"public_ip"`
+	AdminToken  string `json:"admin_token,omitempty"` // Bearer token for /api/admin (empty = localhost only)
+}
+
+// RoutingConfig holds configuration for forwarding requests to remote providers
+type RoutingConfig struct {
+	Enabled        bool `json:"enabled"`         // Forward requests for services not available locally
+	MaxHops        int  `json:"max_hops"`        // Maximum number of times a request may be forwarded
+	TimeoutSeconds int  `json:"timeout_seconds"` // Time allowed for a forwarded request to complete
+}
+
+// ProtocolConfig holds deadlines and limits for incoming service streams
+type ProtocolConfig struct {
+	ReadTimeoutSeconds  int   `json:"read_timeout_seconds"`  // Total time allowed to receive a request
+	IdleTimeoutSeconds  int   `json:"idle_timeout_seconds"`  // Time allowed between reads of a request
+	WriteTimeoutSeconds int   `json:"write_timeout_seconds"` // Time allowed to send a response
+	MaxRequestBytes     int64 `json:"max_request_bytes"`     // Maximum request size (0 = default)
+}
+
+// ConnectionsConfig holds connection manager configuration
+type ConnectionsConfig struct {
+	LowWater           int      `json:"low_water"`            // Connections kept when trimming (0 = default)
+	HighWater          int      `json:"high_water"`           // Connections above which trimming starts (0 = default)
+	GracePeriodSeconds int      `json:"grace_period_seconds"` // New connections are not trimmed for this long (0 = default)
+	PinnedPeers        []string `json:"pinned_peers"`         // Full peer multiaddrs kept connected and never trimmed
+}
+
+// GatingConfig holds the rules deciding which peers may connect. A rule is a
+// peer ID, an IP address or CIDR range, or a multiaddr pattern like /ip4/10.*/tcp/*.
+type GatingConfig struct {
+	Allow   []string `json:"allow"`    // When not empty, only matching peers are accepted
+	Deny    []string `json:"deny"`     // Never accepted, even when allowed
+	BanFile string   `json:"ban_file"` // Bans made through the admin API are kept here (empty = memory only)
+}
+
+// TracingConfig holds distributed tracing configuration
+type TracingConfig struct {
+	Enabled     bool    `json:"enabled"`
+	Exporter    string  `json:"exporter"`     // "stdout" or "file"
+	FilePath    string  `json:"file_path"`    // Output file for the file exporter
+	SampleRatio float64 `json:"sample_ratio"` // Fraction of new traces to record (0 = all)
 }
 
 // NodeConfig holds all node configuration
 type NodeConfig struct {
-	Discovery  DiscoveryConfig `json:"discovery"`
-	Server     ServerConfig    `json:"server"`
-	LogLevel   string          `json:"log_level"`
-	PrivateKey string          `json:"private_key,omitempty"` // Optional base64-encoded private key for consistent peer ID
+	Discovery    DiscoveryConfig   `json:"discovery"`
+	Server       ServerConfig      `json:"server"`
+	Routing      RoutingConfig     `json:"routing"`
+	Protocol     ProtocolConfig    `json:"protocol"`
+	Connections  ConnectionsConfig `json:"connections"`
+	Gating       GatingConfig      `json:"gating"`
+	Tracing      TracingConfig     `json:"tracing"`
+	LogLevel     string            `json:"log_level"`
+	PrivateKey   string            `json:"private_key,omitempty"`    // Optional base64-encoded private key for consistent peer ID
+	SwarmKeyFile string            `json:"swarm_key_file,omitempty"` // Optional swarm key file making the network private
+	Labels       []string          `json:"labels,omitempty"`         // Labels advertised to peers, used to target broadcasts
 }
 
 // DefaultConfig returns a default configuration
@@ -46,14 +185,51 @@ func DefaultConfig() *NodeConfig {
 		Discovery: DiscoveryConfig{
 			EnableMDNS:      true,
 			EnableBootstrap: true,
-			EnableDHT:       false, // Disabled by default until dependencies are added
+			EnableDHT:       false, // Needs bootstrap peers that also run the DHT
 			MDNSServiceTag:  "realentity-mdns",
 			MDNSQuietMode:   true, // Suppress mDNS warnings by default
 			BootstrapPeers:  []string{
 				// Add some default bootstrap peers here when available
 				// "/ip4/104.131.131.82/tcp/4001/p2p/QmaCpDMGvV2BGHeYERUEnRQAwe3N8SzbUtfsmvsqQLuvuJ",
 			},
-			DHTRendezvous: "realentity-dht",
+			DHTRendezvous:        "realentity-dht",
+			DHTMode:              "auto",
+			ProbeIntervalSeconds: 30,
+			ServiceProbes: ServiceProbeConfig{
+				Enabled:         true,
+				OnConnect:       true,
+				IntervalSeconds: 0,
+				TimeoutSeconds:  10,
+				Services: []ServiceProbeTarget{
+					{Service: "echo", Payload: json.RawMessage(`{"message":"probe"}`)},
+					{Service: "text.process", Payload: json.RawMessage(`{"text":"hello","operation":"uppercase"}`)},
+				},
+			},
+			PeerStoreFile:            "", // Set for nodes run from a config file by LoadConfig
+			PeerStoreMaxAgeHours:     72,
+			MaxPeers:                 1000,
+			PeerTTLMinutes:           24 * 60,
+			UnreliablePeerTTLMinutes: 10,
+			PEX: PEXConfig{
+				Enabled:         true,
+				IntervalSeconds: 60,
+				SampleSize:      16,
+			},
+			AutoDial: AutoDialConfig{
+				TargetPeers:        20,
+				MaxConcurrentDials: 4,
+				BackoffSeconds:     30,
+				MaxBackoffSeconds:  30 * 60,
+			},
+			Schedule: DiscoveryScheduleConfig{
+				MinIntervalSeconds: 10,
+				Defaults: MechanismScheduleConfig{
+					IntervalSeconds:    30,
+					MaxIntervalSeconds: 5 * 60,
+					Limit:              10,
+					TimeoutSeconds:     10,
+				},
+			},
 		},
 		Server: ServerConfig{
 			BindAddress: "0.0.0.0", // Listen on all interfaces for VPS
@@ -64,15 +240,48 @@ func DefaultConfig() *NodeConfig {
 			TLSKeyFile:  "",
 			PublicIP:    "", // Auto-detect if empty
 		},
+		Routing: RoutingConfig{
+			Enabled:        false,
+			MaxHops:        3,
+			TimeoutSeconds: 30,
+		},
+		Protocol: ProtocolConfig{
+			ReadTimeoutSeconds:  30,
+			IdleTimeoutSeconds:  10,
+			WriteTimeoutSeconds: 30,
+			MaxRequestBytes:     1 << 20,
+		},
+		Connections: ConnectionsConfig{
+			LowWater:           100,
+			HighWater:          400,
+			GracePeriodSeconds: 60,
+		},
+		Gating: GatingConfig{
+			BanFile: "", // Set for nodes run from a config file by LoadConfig
+		},
+		Tracing: TracingConfig{
+			Enabled:  false,
+			Exporter: "stdout",
+		},
 		LogLevel: "info",
 	}
 }
 
-// LoadConfig loads configuration from a file
+// defaultFileConfig returns the defaults of a node run from a config file,
+// which keeps its state next to it
+func defaultFileConfig() *NodeConfig {
+	config := DefaultConfig()
+	config.Discovery.PeerStoreFile = "peers.db"
+	config.Gating.BanFile = "bans.json"
+	return config
+}
+
+// LoadConfig loads configuration from a file. Settings missing from the file,
+// such as ones added since it was written, keep their default values.
 func LoadConfig(filename string) (*NodeConfig, error) {
 	// If file doesn't exist, create it with default config
 	if _, err := os.Stat(filename); os.IsNotExist(err) {
-		config := DefaultConfig()
+		config := defaultFileConfig()
 		if err := SaveConfig(config, filename); err != nil {
 			return nil, fmt.Errorf("failed to create default config: %v", err)
 		}
@@ -85,12 +294,19 @@ func LoadConfig(filename string) (*NodeConfig, error) {
 		return nil, fmt.Errorf("failed to read config file: %v", err)
 	}
 
-	var config NodeConfig
-	if err := json.Unmarshal(data, &config); err != nil {
+	// Probe targets in the file replace the default ones instead of being
+	// decoded over them
+	config := defaultFileConfig()
+	defaultProbes := config.Discovery.ServiceProbes.Services
+	config.Discovery.ServiceProbes.Services = nil
+	if err := json.Unmarshal(data, config); err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %v", err)
 	}
+	if config.Discovery.ServiceProbes.Services == nil {
+		config.Discovery.ServiceProbes.Services = defaultProbes
+	}
 
-	return &config, nil
+	return config, nil
 }
 
 // SaveConfig saves configuration to a file
@@ -107,6 +323,50 @@ func SaveConfig(config *NodeConfig, filename string) error {
 	return nil
 }
 
+// SaveBootstrapPeers replaces the bootstrap peers in a configuration file.
+// Other settings keep their values, including ones this version doesn't
+// know, but the file is reformatted: keys are sorted and indented by two
+// spaces. The file is replaced atomically and keeps its permissions.
+func SaveBootstrapPeers(filename string, addrs []string) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return fmt.Errorf("failed to parse config file: %v", err)
+	}
+	var discovery map[string]json.RawMessage
+	if raw, exists := fields["discovery"]; exists {
+		if err := json.Unmarshal(raw, &discovery); err != nil {
+			return fmt.Errorf("failed to parse discovery config: %v", err)
+		}
+	}
+	if discovery == nil {
+		discovery = make(map[string]json.RawMessage)
+	}
+
+	if addrs == nil {
+		addrs = []string{}
+	}
+	if discovery["bootstrap_peers"], err = json.Marshal(addrs); err != nil {
+		return fmt.Errorf("failed to marshal bootstrap peers: %v", err)
+	}
+	if fields["discovery"], err = json.Marshal(discovery); err != nil {
+		return fmt.Errorf("failed to marshal discovery config: %v", err)
+	}
+	if data, err = json.MarshalIndent(fields, "", "  "); err != nil {
+		return fmt.Errorf("failed to marshal config: %v", err)
+	}
+
+	return fileutil.WriteFileAtomic(filename, data, info.Mode().Perm())
+}
+
 // AddBootstrapPeer adds a bootstrap peer to the config
 func (dc *DiscoveryConfig) AddBootstrapPeer(addr string) {
 	for _, existing := range dc.BootstrapPeers {
@@ -160,9 +420,18 @@ func applyEnvOverrides(cfg *NodeConfig) {
 	if enableDHT := os.Getenv("REALENTITY_ENABLE_DHT"); enableDHT != "" {
 		cfg.Discovery.EnableDHT = strings.ToLower(enableDHT) == "true"
 	}
+	if dhtMode := os.Getenv("REALENTITY_DHT_MODE"); dhtMode != "" {
+		cfg.Discovery.DHTMode = strings.ToLower(dhtMode)
+	}
 	if bootstrapPeers := os.Getenv("REALENTITY_BOOTSTRAP_PEERS"); bootstrapPeers != "" {
 		cfg.Discovery.BootstrapPeers = strings.Split(bootstrapPeers, ",")
 	}
+	if staticPeersFile := os.Getenv("REALENTITY_STATIC_PEERS_FILE"); staticPeersFile != "" {
+		cfg.Discovery.StaticPeersFile = staticPeersFile
+	}
+	if swarmKeyFile := os.Getenv("REALENTITY_SWARM_KEY_FILE"); swarmKeyFile != "" {
+		cfg.SwarmKeyFile = swarmKeyFile
+	}
 	if logLevel := os.Getenv("REALENTITY_LOG_LEVEL"); logLevel != "" {
 		cfg.LogLevel = logLevel
 	}
@@ -185,6 +454,16 @@ func ValidateConfig(cfg *NodeConfig) error {
 		log.Printf("Warning: Bootstrap discovery enabled but no bootstrap peers configured. This might be a bootstrap node.")
 	}
 
+	switch cfg.Discovery.DHTMode {
+	case "", "auto", "server", "client":
+	default:
+		return fmt.Errorf("invalid DHT mode: %s", cfg.Discovery.DHTMode)
+	}
+
+	if low, high := cfg.Connections.LowWater, cfg.Connections.HighWater; high > 0 && low > high {
+		return fmt.Errorf("connection low water (%d) is above high water (%d)", low, high)
+	}
+
 	// Validate bootstrap peer addresses
 	for _, peer := range cfg.Discovery.BootstrapPeers {
 		if !strings.HasPrefix(peer, "/ip4/") && !strings.HasPrefix(peer, "/ip6/") {
@@ -227,6 +506,7 @@ func GetConfigForDeployment(deploymentType string, options map[string]string) (*
 				MDNSQuietMode:   true,
 				BootstrapPeers:  []string{},
 				DHTRendezvous:   "realentity-dht",
+				DHTMode:         "server", // Publicly reachable, serves DHT records
 			},
 			Server: ServerConfig{
 				BindAddress: "0.0.0.0",
@@ -2,7 +2,9 @@ package discovery
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/libp2p/go-libp2p/core/host"
@@ -11,38 +13,81 @@ import (
 	"github.com/multiformats/go-multiaddr"
 )
 
-// BootstrapDiscovery finds peers through bootstrap nodes
+// Timing of bootstrap peer connections
+const (
+	bootstrapDialTimeout    = 15 * time.Second
+	bootstrapInitialBackoff = time.Second
+	bootstrapCheckInterval  = 30 * time.Second // Also the longest wait between reconnects
+)
+
+// BootstrapPeerStatus describes the connection to a bootstrap peer
+type BootstrapPeerStatus struct {
+	ID            string     `json:"id"`
+	Addrs         []string   `json:"addrs"`
+	Connected     bool       `json:"connected"`
+	Attempts      int        `json:"attempts"` // Connection attempts since the peer was added
+	LastError     string     `json:"last_error,omitempty"`
+	LastAttempt   *time.Time `json:"last_attempt,omitempty"`
+	LastConnected *time.Time `json:"last_connected,omitempty"`
+}
+
+// bootstrapPeer is a bootstrap peer and the state of its connection
+type bootstrapPeer struct {
+	info          peer.AddrInfo
+	attempts      int
+	lastErr       error
+	lastAttempt   time.Time
+	lastConnected time.Time
+	cancel        context.CancelFunc // Stops the goroutine keeping the peer connected
+}
+
+// BootstrapDiscovery finds peers through bootstrap nodes. Each bootstrap peer
+// has a goroutine that connects to it and reconnects when the connection is
+// lost, until the peer is removed or discovery stops.
 type BootstrapDiscovery struct {
-	host           host.Host
-	bootstrapPeers []peer.AddrInfo
-	connected      map[peer.ID]bool
+	host  host.Host
+	peers []*bootstrapPeer
+	ctx   context.Context // Discovery context, set by Start
+	mu    sync.Mutex
 }
 
 // NewBootstrapDiscovery creates a new bootstrap discovery mechanism
 func NewBootstrapDiscovery(h host.Host, bootstrapAddrs []string) (*BootstrapDiscovery, error) {
+	bd := &BootstrapDiscovery{host: h}
+	for _, ai := range ParseBootstrapPeers(bootstrapAddrs) {
+		bd.AddBootstrapPeer(ai)
+	}
+	return bd, nil
+}
+
+// ParseBootstrapPeers parses full peer multiaddrs, skipping invalid ones
+func ParseBootstrapPeers(bootstrapAddrs []string) []peer.AddrInfo {
 	var bootstrapPeers []peer.AddrInfo
 
 	for _, addrStr := range bootstrapAddrs {
-		addr, err := multiaddr.NewMultiaddr(addrStr)
-		if err != nil {
-			log.Printf("Invalid bootstrap address %s: %v\n", addrStr, err)
-			continue
-		}
-
-		addrInfo, err := peer.AddrInfoFromP2pAddr(addr)
+		addrInfo, err := ParseBootstrapPeer(addrStr)
 		if err != nil {
 			log.Printf("Invalid bootstrap peer address %s: %v\n", addrStr, err)
 			continue
 		}
+		bootstrapPeers = append(bootstrapPeers, addrInfo)
+	}
 
-		bootstrapPeers = append(bootstrapPeers, *addrInfo)
+	return bootstrapPeers
+}
+
+// ParseBootstrapPeer parses a full peer multiaddr ending with /p2p/<peer ID>
+func ParseBootstrapPeer(addrStr string) (peer.AddrInfo, error) {
+	addr, err := multiaddr.NewMultiaddr(addrStr)
+	if err != nil {
+		return peer.AddrInfo{}, err
 	}
 
-	return &BootstrapDiscovery{
-		host:           h,
-		bootstrapPeers: bootstrapPeers,
-		connected:      make(map[peer.ID]bool),
-	}, nil
+	addrInfo, err := peer.AddrInfoFromP2pAddr(addr)
+	if err != nil {
+		return peer.AddrInfo{}, err
+	}
+	return *addrInfo, nil
 }
 
 func (bd *BootstrapDiscovery) Name() string {
@@ -50,25 +95,39 @@ func (bd *BootstrapDiscovery) Name() string {
 }
 
 func (bd *BootstrapDiscovery) Start(ctx context.Context) error {
-	log.Printf("Bootstrap discovery starting with %d bootstrap peers\n", len(bd.bootstrapPeers))
+	bd.mu.Lock()
+	defer bd.mu.Unlock()
 
-	// Connect to bootstrap peers immediately
-	go bd.connectToBootstrapPeers(ctx)
+	log.Printf("Bootstrap discovery starting with %d bootstrap peers\n", len(bd.peers))
 
+	bd.ctx = ctx
+	for _, bp := range bd.peers {
+		bd.startLocked(bp)
+	}
 	return nil
 }
 
 func (bd *BootstrapDiscovery) Stop() error {
+	bd.mu.Lock()
+	defer bd.mu.Unlock()
+
+	for _, bp := range bd.peers {
+		if bp.cancel != nil {
+			bp.cancel()
+			bp.cancel = nil
+		}
+	}
+	bd.ctx = nil
+
 	log.Println("Bootstrap discovery stopped")
 	return nil
 }
 
+// FindPeers returns peers from the host's peerstore, which includes peers
+// learned through bootstrap peers and inbound connections
 func (bd *BootstrapDiscovery) FindPeers(ctx context.Context, limit int) ([]peer.AddrInfo, error) {
 	var found []peer.AddrInfo
 
-	// First, ensure we're connected to bootstrap peers
-	bd.connectToBootstrapPeers(ctx)
-
 	// Get peers from the host's peerstore (peers we've learned about)
 	peers := bd.host.Peerstore().Peers()
 
@@ -93,86 +152,221 @@ func (bd *BootstrapDiscovery) FindPeers(ctx context.Context, limit int) ([]peer.
 	return found, nil
 }
 
-func (bd *BootstrapDiscovery) connectToBootstrapPeers(ctx context.Context) {
-	for _, addrInfo := range bd.bootstrapPeers {
-		if bd.connected[addrInfo.ID] {
-			continue // Already connected
-		}
+// startLocked starts the goroutine keeping a bootstrap peer connected, if
+// discovery is running. Must be called with bd.mu held.
+func (bd *BootstrapDiscovery) startLocked(bp *bootstrapPeer) {
+	if bd.ctx == nil || bp.cancel != nil {
+		return
+	}
 
-		go func(ai peer.AddrInfo) {
-			// Retry logic for VPS environments where connections might be unstable
-			maxRetries := 3
-			backoff := time.Second
+	ctx, cancel := context.WithCancel(bd.ctx)
+	bp.cancel = cancel
+	go bd.maintainConnection(ctx, bp)
+}
 
-			for attempt := 0; attempt < maxRetries; attempt++ {
-				connectCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+// maintainConnection connects to a bootstrap peer, retrying with exponential
+// backoff, and checks the connection every bootstrapCheckInterval afterwards
+func (bd *BootstrapDiscovery) maintainConnection(ctx context.Context, bp *bootstrapPeer) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
 
-				if err := bd.host.Connect(connectCtx, ai); err != nil {
-					cancel()
-					log.Printf("Failed to connect to bootstrap peer %s (attempt %d/%d): %v",
-						ai.ID.String(), attempt+1, maxRetries, err)
+	backoff := bootstrapInitialBackoff
+	wasConnected := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
 
-					if attempt < maxRetries-1 {
-						time.Sleep(backoff)
-						backoff *= 2 // Exponential backoff
-						continue
-					}
-					return
-				}
+		bd.mu.Lock()
+		ai := bp.info
+		bd.mu.Unlock()
 
-				cancel()
-				bd.connected[ai.ID] = true
-				log.Printf("Connected to bootstrap peer: %s (attempt %d)", ai.ID.String(), attempt+1)
+		if bd.host.Network().Connectedness(ai.ID) == network.Connected {
+			wasConnected = true
+			timer.Reset(bootstrapCheckInterval)
+			continue
+		}
+		if wasConnected {
+			log.Printf("Lost connection to bootstrap peer %s, attempting reconnect...\n", ai.ID)
+			wasConnected = false
+		}
 
-				// Verify connection is stable by checking network reachability
-				go bd.monitorBootstrapConnection(ai.ID)
-				return
-			}
-		}(addrInfo)
-	}
-}
+		connectCtx, cancel := context.WithTimeout(ctx, bootstrapDialTimeout)
+		err := bd.host.Connect(connectCtx, ai)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
 
-// monitorBootstrapConnection monitors bootstrap peer connections and reconnects if needed
-func (bd *BootstrapDiscovery) monitorBootstrapConnection(peerID peer.ID) {
-	ticker := time.NewTicker(30 * time.Second)
-	defer ticker.Stop()
+		bd.mu.Lock()
+		bp.attempts++
+		bp.lastAttempt = time.Now()
+		bp.lastErr = err
+		if err == nil {
+			bp.lastConnected = bp.lastAttempt
+		}
+		attempts := bp.attempts
+		bd.mu.Unlock()
 
-	for {
-		select {
-		case <-ticker.C:
-			// Check if peer is still connected
-			connectedness := bd.host.Network().Connectedness(peerID)
-			if connectedness != network.Connected {
-				log.Printf("Lost connection to bootstrap peer %s, attempting reconnect...", peerID)
-				bd.connected[peerID] = false
-
-				// Find the peer info and reconnect
-				for _, ai := range bd.bootstrapPeers {
-					if ai.ID == peerID {
-						go func() {
-							ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-							defer cancel()
-
-							if err := bd.host.Connect(ctx, ai); err == nil {
-								bd.connected[ai.ID] = true
-								log.Printf("Reconnected to bootstrap peer: %s", ai.ID)
-							}
-						}()
-						break
-					}
-				}
+		if err != nil {
+			log.Printf("Failed to connect to bootstrap peer %s (attempt %d, retrying in %v): %v\n",
+				ai.ID, attempts, backoff, err)
+			timer.Reset(backoff)
+			backoff *= 2 // Exponential backoff
+			if backoff > bootstrapCheckInterval {
+				backoff = bootstrapCheckInterval
 			}
+			continue
 		}
+
+		log.Printf("Connected to bootstrap peer: %s (attempt %d)\n", ai.ID, attempts)
+		wasConnected = true
+		backoff = bootstrapInitialBackoff
+		timer.Reset(bootstrapCheckInterval)
 	}
 }
 
 // GetBootstrapPeers returns the list of bootstrap peer addresses
 func (bd *BootstrapDiscovery) GetBootstrapPeers() []peer.AddrInfo {
-	return bd.bootstrapPeers
+	bd.mu.Lock()
+	defer bd.mu.Unlock()
+
+	result := make([]peer.AddrInfo, len(bd.peers))
+	for i, bp := range bd.peers {
+		result[i] = bp.info
+	}
+	return result
 }
 
-// AddBootstrapPeer adds a new bootstrap peer
-func (bd *BootstrapDiscovery) AddBootstrapPeer(addrInfo peer.AddrInfo) {
-	bd.bootstrapPeers = append(bd.bootstrapPeers, addrInfo)
+// BootstrapAddrs returns the full multiaddrs of the bootstrap peers, in the
+// format of the bootstrap_peers configuration
+func (bd *BootstrapDiscovery) BootstrapAddrs() []string {
+	addrs := make([]string, 0)
+	for _, ai := range bd.GetBootstrapPeers() {
+		p2pAddrs, err := peer.AddrInfoToP2pAddrs(&ai)
+		if err != nil {
+			continue
+		}
+		for _, addr := range p2pAddrs {
+			addrs = append(addrs, addr.String())
+		}
+	}
+	return addrs
+}
+
+// AddBootstrapPeer adds a bootstrap peer, connecting to it right away if
+// discovery is running. Adding a known peer adds its new addresses and
+// returns false.
+func (bd *BootstrapDiscovery) AddBootstrapPeer(addrInfo peer.AddrInfo) bool {
+	bd.mu.Lock()
+	defer bd.mu.Unlock()
+
+	for _, bp := range bd.peers {
+		if bp.info.ID == addrInfo.ID {
+			bp.info.Addrs = removeDuplicateAddrs(append(bp.info.Addrs, addrInfo.Addrs...))
+			return false
+		}
+	}
+
+	bp := &bootstrapPeer{info: addrInfo}
+	bd.peers = append(bd.peers, bp)
+	bd.host.ConnManager().Protect(addrInfo.ID, ProtectTagBootstrap)
+	bd.startLocked(bp)
+
 	log.Printf("Added bootstrap peer: %s\n", addrInfo.ID.String())
+	return true
+}
+
+// RemoveBootstrapPeer stops connecting to a bootstrap peer and lets the
+// connection manager trim its connection. It reports whether the peer was
+// a bootstrap peer.
+func (bd *BootstrapDiscovery) RemoveBootstrapPeer(peerID peer.ID) bool {
+	bd.mu.Lock()
+	defer bd.mu.Unlock()
+
+	for i, bp := range bd.peers {
+		if bp.info.ID != peerID {
+			continue
+		}
+
+		if bp.cancel != nil {
+			bp.cancel()
+		}
+		bd.peers = append(bd.peers[:i], bd.peers[i+1:]...)
+		bd.host.ConnManager().Unprotect(peerID, ProtectTagBootstrap)
+
+		log.Printf("Removed bootstrap peer: %s\n", peerID.String())
+		return true
+	}
+	return false
+}
+
+// Status returns the connection status of every bootstrap peer
+func (bd *BootstrapDiscovery) Status() []BootstrapPeerStatus {
+	bd.mu.Lock()
+	defer bd.mu.Unlock()
+
+	statuses := make([]BootstrapPeerStatus, 0, len(bd.peers))
+	for _, bp := range bd.peers {
+		statuses = append(statuses, bd.statusLocked(bp))
+	}
+	return statuses
+}
+
+// ReportStatus adds the bootstrap peers to the mechanism status, and reports
+// the latest failed connection as its last error
+func (bd *BootstrapDiscovery) ReportStatus(status *MechanismStatus) {
+	peers := bd.Status()
+	status.Details = map[string]interface{}{"peers": peers}
+
+	for _, p := range peers {
+		if p.LastError == "" || p.LastAttempt == nil {
+			continue
+		}
+		if status.LastErrorAt == nil || p.LastAttempt.After(*status.LastErrorAt) {
+			status.LastError = fmt.Sprintf("bootstrap peer %s: %s", p.ID, p.LastError)
+			status.LastErrorAt = p.LastAttempt
+		}
+	}
+}
+
+// PeerStatus returns the connection status of a bootstrap peer
+func (bd *BootstrapDiscovery) PeerStatus(peerID peer.ID) (BootstrapPeerStatus, bool) {
+	bd.mu.Lock()
+	defer bd.mu.Unlock()
+
+	for _, bp := range bd.peers {
+		if bp.info.ID == peerID {
+			return bd.statusLocked(bp), true
+		}
+	}
+	return BootstrapPeerStatus{}, false
+}
+
+// statusLocked describes the connection to a bootstrap peer. Must be called
+// with bd.mu held.
+func (bd *BootstrapDiscovery) statusLocked(bp *bootstrapPeer) BootstrapPeerStatus {
+	status := BootstrapPeerStatus{
+		ID:        bp.info.ID.String(),
+		Addrs:     make([]string, len(bp.info.Addrs)),
+		Connected: bd.host.Network().Connectedness(bp.info.ID) == network.Connected,
+		Attempts:  bp.attempts,
+	}
+	for i, addr := range bp.info.Addrs {
+		status.Addrs[i] = addr.String()
+	}
+	if bp.lastErr != nil {
+		status.LastError = bp.lastErr.Error()
+	}
+	if !bp.lastAttempt.IsZero() {
+		lastAttempt := bp.lastAttempt
+		status.LastAttempt = &lastAttempt
+	}
+	if !bp.lastConnected.IsZero() {
+		lastConnected := bp.lastConnected
+		status.LastConnected = &lastConnected
+	}
+	return status
 }
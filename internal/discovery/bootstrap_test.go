@@ -0,0 +1,95 @@
+package discovery
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// TestBootstrapPeersAtRuntime tests that bootstrap peers added while
+// discovery runs are connected and protected, and that removing them stops
+// reconnecting
+func TestBootstrapPeersAtRuntime(t *testing.T) {
+	h := newTestHost(t)
+	target := newTestHost(t)
+
+	gone := newTestHost(t)
+	goneInfo := peer.AddrInfo{ID: gone.ID(), Addrs: gone.Addrs()}
+	gone.Close()
+
+	bd, err := NewBootstrapDiscovery(h, nil)
+	if err != nil {
+		t.Fatalf("Failed to create bootstrap discovery: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := bd.Start(ctx); err != nil {
+		t.Fatalf("Failed to start bootstrap discovery: %v", err)
+	}
+	defer bd.Stop()
+
+	targetInfo := peer.AddrInfo{ID: target.ID(), Addrs: target.Addrs()}
+	if !bd.AddBootstrapPeer(targetInfo) {
+		t.Fatal("Expected the peer to be added")
+	}
+	if bd.AddBootstrapPeer(targetInfo) {
+		t.Error("Adding a bootstrap peer twice should not add it again")
+	}
+	bd.AddBootstrapPeer(goneInfo)
+
+	if !h.ConnManager().IsProtected(target.ID(), ProtectTagBootstrap) {
+		t.Error("Bootstrap peer should be protected")
+	}
+
+	// The connection opens before the attempt is recorded, so wait for both
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status, _ := bd.PeerStatus(target.ID())
+		if h.Network().Connectedness(target.ID()) == network.Connected && status.Attempts > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Bootstrap peer added at runtime was not connected, got %+v", status)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	deadline = time.Now().Add(5 * time.Second)
+	for {
+		status, ok := bd.PeerStatus(gone.ID())
+		if !ok {
+			t.Fatal("Unreachable bootstrap peer should be listed")
+		}
+		if status.Attempts > 0 && status.LastError != "" && !status.Connected {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected a failed attempt for the unreachable peer, got %+v", status)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	status, _ := bd.PeerStatus(target.ID())
+	if !status.Connected || status.Attempts != 1 || status.LastConnected == nil || status.LastError != "" {
+		t.Errorf("Unexpected status for the connected peer: %+v", status)
+	}
+	if addrs := bd.BootstrapAddrs(); len(addrs) != len(target.Addrs())+len(goneInfo.Addrs) {
+		t.Errorf("Expected one address per bootstrap peer address, got %v", addrs)
+	}
+
+	if !bd.RemoveBootstrapPeer(gone.ID()) {
+		t.Fatal("Expected the peer to be removed")
+	}
+	if bd.RemoveBootstrapPeer(gone.ID()) {
+		t.Error("Removing an unknown bootstrap peer should report false")
+	}
+	if h.ConnManager().IsProtected(gone.ID(), ProtectTagBootstrap) {
+		t.Error("Removed bootstrap peer should no longer be protected")
+	}
+	if statuses := bd.Status(); len(statuses) != 1 || statuses[0].ID != target.ID().String() {
+		t.Errorf("Expected only the remaining bootstrap peer, got %+v", statuses)
+	}
+}
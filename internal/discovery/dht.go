@@ -2,7 +2,9 @@ package discovery
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"sync"
 	"time"
 
 	dht "github.com/libp2p/go-libp2p-kad-dht"
@@ -12,18 +14,65 @@ import (
 	"github.com/libp2p/go-libp2p/p2p/discovery/util"
 )
 
+// DHT modes
+const (
+	DHTModeAuto   = "auto"   // Act as a server once the node is publicly reachable
+	DHTModeServer = "server" // Store and serve records for other peers
+	DHTModeClient = "client" // Only query the DHT
+)
+
+// defaultDHTRendezvous is advertised when no rendezvous is configured
+const defaultDHTRendezvous = "realentity-dht"
+
+// dhtProtocolPrefix keeps the RealEntity DHT separate from the public IPFS DHT
+const dhtProtocolPrefix = "/realentity"
+
+// DHTConfig contains settings for DHT discovery
+type DHTConfig struct {
+	Rendezvous     string          // Namespace advertised by every node
+	BootstrapPeers []peer.AddrInfo // Peers used to join the DHT
+	Mode           string          // One of the DHTMode* values (empty = auto)
+
+	// Services returns the names of the local services, each advertised
+	// under its own rendezvous (nil = only advertise the node itself)
+	Services func() []string
+}
+
 // DHTDiscovery uses DHT for peer discovery
 type DHTDiscovery struct {
-	host        host.Host
-	dht         *dht.IpfsDHT
-	routingDisc *routing.RoutingDiscovery
-	rendezvous  string
+	host           host.Host
+	dht            *dht.IpfsDHT
+	routingDisc    *routing.RoutingDiscovery
+	rendezvous     string
+	bootstrapPeers []peer.AddrInfo
+	services       func() []string
+	advertised     map[string]context.CancelFunc
+	mu             sync.Mutex
 }
 
 // NewDHTDiscovery creates a new DHT-based discovery mechanism
 func NewDHTDiscovery(h host.Host, rendezvous string, bootstrapPeers []peer.AddrInfo) (*DHTDiscovery, error) {
+	return NewDHTDiscoveryWithConfig(h, DHTConfig{
+		Rendezvous:     rendezvous,
+		BootstrapPeers: bootstrapPeers,
+	})
+}
+
+// NewDHTDiscoveryWithConfig creates a DHT-based discovery mechanism with custom settings
+func NewDHTDiscoveryWithConfig(h host.Host, config DHTConfig) (*DHTDiscovery, error) {
+	mode, err := parseDHTMode(config.Mode)
+	if err != nil {
+		return nil, err
+	}
+	if config.Rendezvous == "" {
+		config.Rendezvous = defaultDHTRendezvous
+	}
+
 	// Create DHT
-	kademliaDHT, err := dht.New(context.Background(), h)
+	kademliaDHT, err := dht.New(context.Background(), h,
+		dht.Mode(mode),
+		dht.ProtocolPrefix(dhtProtocolPrefix),
+		dht.BootstrapPeers(config.BootstrapPeers...))
 	if err != nil {
 		return nil, err
 	}
@@ -32,15 +81,37 @@ func NewDHTDiscovery(h host.Host, rendezvous string, bootstrapPeers []peer.AddrI
 	routingDiscovery := routing.NewRoutingDiscovery(kademliaDHT)
 
 	dd := &DHTDiscovery{
-		host:        h,
-		dht:         kademliaDHT,
-		routingDisc: routingDiscovery,
-		rendezvous:  rendezvous,
+		host:           h,
+		dht:            kademliaDHT,
+		routingDisc:    routingDiscovery,
+		rendezvous:     config.Rendezvous,
+		bootstrapPeers: config.BootstrapPeers,
+		services:       config.Services,
+		advertised:     make(map[string]context.CancelFunc),
 	}
 
 	return dd, nil
 }
 
+// parseDHTMode converts a configured mode to a DHT option value
+func parseDHTMode(mode string) (dht.ModeOpt, error) {
+	switch mode {
+	case "", DHTModeAuto:
+		return dht.ModeAuto, nil
+	case DHTModeServer:
+		return dht.ModeServer, nil
+	case DHTModeClient:
+		return dht.ModeClient, nil
+	default:
+		return 0, fmt.Errorf("unknown DHT mode: %s", mode)
+	}
+}
+
+// ServiceRendezvous returns the namespace under which providers of a service are advertised
+func ServiceRendezvous(rendezvous, service string) string {
+	return rendezvous + "/service/" + service
+}
+
 func (dd *DHTDiscovery) Name() string {
 	return "dht"
 }
@@ -48,6 +119,9 @@ func (dd *DHTDiscovery) Name() string {
 func (dd *DHTDiscovery) Start(ctx context.Context) error {
 	log.Println("Starting DHT discovery...")
 
+	// Join the DHT through the bootstrap peers
+	dd.connectToBootstrapPeers(ctx)
+
 	// Bootstrap the DHT
 	if err := dd.dht.Bootstrap(ctx); err != nil {
 		return err
@@ -60,7 +134,36 @@ func (dd *DHTDiscovery) Start(ctx context.Context) error {
 	return nil
 }
 
+// connectToBootstrapPeers connects to the bootstrap peers so the routing table isn't empty
+func (dd *DHTDiscovery) connectToBootstrapPeers(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, addrInfo := range dd.bootstrapPeers {
+		if addrInfo.ID == dd.host.ID() {
+			continue
+		}
+
+		wg.Add(1)
+		go func(ai peer.AddrInfo) {
+			defer wg.Done()
+
+			connectCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+			defer cancel()
+			if err := dd.host.Connect(connectCtx, ai); err != nil {
+				log.Printf("Failed to connect to DHT bootstrap peer %s: %v\n", ai.ID.String(), err)
+			}
+		}(addrInfo)
+	}
+	wg.Wait()
+}
+
 func (dd *DHTDiscovery) Stop() error {
+	dd.mu.Lock()
+	for namespace, cancel := range dd.advertised {
+		cancel()
+		delete(dd.advertised, namespace)
+	}
+	dd.mu.Unlock()
+
 	if dd.dht != nil {
 		return dd.dht.Close()
 	}
@@ -69,8 +172,18 @@ func (dd *DHTDiscovery) Stop() error {
 
 func (dd *DHTDiscovery) FindPeers(ctx context.Context, limit int) ([]peer.AddrInfo, error) {
 	log.Printf("Searching for peers via DHT (rendezvous: %s)\n", dd.rendezvous)
+	return dd.findPeers(ctx, dd.rendezvous, limit)
+}
+
+// FindServiceProviders searches the DHT for peers advertising a service
+func (dd *DHTDiscovery) FindServiceProviders(ctx context.Context, service string, limit int) ([]peer.AddrInfo, error) {
+	log.Printf("Searching for providers of %s via DHT\n", service)
+	return dd.findPeers(ctx, ServiceRendezvous(dd.rendezvous, service), limit)
+}
 
-	peerChan, err := dd.routingDisc.FindPeers(ctx, dd.rendezvous)
+// findPeers collects up to limit peers advertising the namespace
+func (dd *DHTDiscovery) findPeers(ctx context.Context, namespace string, limit int) ([]peer.AddrInfo, error) {
+	peerChan, err := dd.routingDisc.FindPeers(ctx, namespace)
 	if err != nil {
 		return nil, err
 	}
@@ -101,6 +214,7 @@ func (dd *DHTDiscovery) FindPeers(ctx context.Context, limit int) ([]peer.AddrIn
 	}
 }
 
+// advertise keeps the node and its current services advertised until ctx is done
 func (dd *DHTDiscovery) advertise(ctx context.Context) {
 	ticker := time.NewTicker(1 * time.Minute)
 	defer ticker.Stop()
@@ -118,11 +232,38 @@ func (dd *DHTDiscovery) advertise(ctx context.Context) {
 	}
 }
 
+// doAdvertise starts advertising namespaces that are new and stops
+// advertising services that are no longer registered. util.Advertise renews
+// each advertisement on its own until its context is cancelled.
 func (dd *DHTDiscovery) doAdvertise(ctx context.Context) {
-	log.Printf("Advertising presence on DHT (rendezvous: %s)\n", dd.rendezvous)
+	namespaces := map[string]bool{dd.rendezvous: true}
+	if dd.services != nil {
+		for _, service := range dd.services() {
+			namespaces[ServiceRendezvous(dd.rendezvous, service)] = true
+		}
+	}
+
+	dd.mu.Lock()
+	defer dd.mu.Unlock()
+
+	for namespace, cancel := range dd.advertised {
+		if !namespaces[namespace] {
+			log.Printf("Stopped advertising on DHT (rendezvous: %s)\n", namespace)
+			cancel()
+			delete(dd.advertised, namespace)
+		}
+	}
 
-	// Use util.Advertise for easier advertising
-	util.Advertise(ctx, dd.routingDisc, dd.rendezvous)
+	for namespace := range namespaces {
+		if _, exists := dd.advertised[namespace]; exists {
+			continue
+		}
+
+		log.Printf("Advertising presence on DHT (rendezvous: %s)\n", namespace)
+		advertiseCtx, cancel := context.WithCancel(ctx)
+		dd.advertised[namespace] = cancel
+		util.Advertise(advertiseCtx, dd.routingDisc, namespace)
+	}
 }
 
 // GetDHT returns the underlying DHT instance
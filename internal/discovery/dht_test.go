@@ -0,0 +1,69 @@
+package discovery
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// startDHTPeer starts a TCP-only host running DHT discovery in server mode
+func startDHTPeer(t *testing.T, bootstrap []peer.AddrInfo, services ...string) (host.Host, *DiscoveryManager) {
+	h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatalf("Failed to create host: %v", err)
+	}
+	t.Cleanup(func() { h.Close() })
+
+	dd, err := NewDHTDiscoveryWithConfig(h, DHTConfig{
+		Rendezvous:     "test-dht",
+		BootstrapPeers: bootstrap,
+		Mode:           DHTModeServer,
+		Services:       func() []string { return services },
+	})
+	if err != nil {
+		t.Fatalf("Failed to create DHT discovery: %v", err)
+	}
+
+	dm := NewDiscoveryManager(h)
+	dm.AddMechanism(dd)
+	if err := dm.Start(); err != nil {
+		t.Fatalf("Failed to start discovery: %v", err)
+	}
+	t.Cleanup(func() { dm.Stop() })
+	return h, dm
+}
+
+// TestDiscoverProvidersViaDHT tests that a peer finds and connects to the
+// provider of a service through the DHT
+func TestDiscoverProvidersViaDHT(t *testing.T) {
+	hub, _ := startDHTPeer(t, nil)
+	hubInfo := []peer.AddrInfo{{ID: hub.ID(), Addrs: hub.Addrs()}}
+	provider, _ := startDHTPeer(t, hubInfo, "text.process")
+	seeker, dm := startDHTPeer(t, hubInfo)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	// The provider's advertisement may not have reached the DHT yet
+	for {
+		providers := dm.DiscoverProviders(ctx, "text.process", 5)
+		if len(providers) == 1 && providers[0] == provider.ID() {
+			break
+		}
+		if ctx.Err() != nil {
+			t.Fatalf("Provider not found via DHT, got %v", providers)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	if providers := dm.DiscoverProviders(ctx, "echo", 5); len(providers) != 0 {
+		t.Errorf("Expected no providers of an unadvertised service, got %v", providers)
+	}
+	if len(seeker.Network().ConnsToPeer(provider.ID())) == 0 {
+		t.Error("Expected seeker to be connected to the provider")
+	}
+}
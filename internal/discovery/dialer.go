@@ -0,0 +1,268 @@
+package discovery
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/realentity/realentity-node/internal/utils"
+)
+
+// DialPolicy controls which discovered peers the node connects to
+type DialPolicy struct {
+	TargetPeers        int           // Connections to maintain
+	MaxConcurrentDials int           // Dials in flight at once
+	DialTimeout        time.Duration // Time allowed for one dial
+	Interval           time.Duration // How often the connection count is checked
+	InitialBackoff     time.Duration // Wait after the first failed dial of a peer
+	MaxBackoff         time.Duration // Upper bound for the wait, doubled on each failure
+
+	// SourcePriority is added to a peer's score when ranking dial candidates
+	SourcePriority map[string]float64
+}
+
+// DefaultDialPolicy returns the policy used when auto-dial is enabled without settings
+func DefaultDialPolicy() *DialPolicy {
+	return &DialPolicy{
+		TargetPeers:        20,
+		MaxConcurrentDials: 4,
+		DialTimeout:        10 * time.Second,
+		Interval:           10 * time.Second,
+		InitialBackoff:     30 * time.Second,
+		MaxBackoff:         30 * time.Minute,
+		SourcePriority: map[string]float64{
+			"pinned":    1.0, // Must stay connected
+			"static":    0.3, // Listed by the operator
+			"bootstrap": 0.3, // Well known, long running nodes
+			"mdns":      0.2, // Same network, cheap to reach
+			"dns":       0.2, // Published by the operator
+			"dht":       0.1,
+		},
+	}
+}
+
+// withDefaults fills unset fields from the default policy
+func (p *DialPolicy) withDefaults() *DialPolicy {
+	defaults := DefaultDialPolicy()
+	if p == nil {
+		return defaults
+	}
+
+	result := *p
+	if result.TargetPeers <= 0 {
+		result.TargetPeers = defaults.TargetPeers
+	}
+	if result.MaxConcurrentDials <= 0 {
+		result.MaxConcurrentDials = defaults.MaxConcurrentDials
+	}
+	if result.DialTimeout <= 0 {
+		result.DialTimeout = defaults.DialTimeout
+	}
+	if result.Interval <= 0 {
+		result.Interval = defaults.Interval
+	}
+	if result.InitialBackoff <= 0 {
+		result.InitialBackoff = defaults.InitialBackoff
+	}
+	if result.MaxBackoff <= 0 {
+		result.MaxBackoff = defaults.MaxBackoff
+	}
+	if result.SourcePriority == nil {
+		result.SourcePriority = defaults.SourcePriority
+	}
+	return &result
+}
+
+// dialBackoff tracks failed dials of one peer
+type dialBackoff struct {
+	failures    int
+	nextAttempt time.Time
+}
+
+// AutoDialer connects to discovered peers from every discovery mechanism
+// until the target number of connections is reached
+type AutoDialer struct {
+	dm      *DiscoveryManager
+	policy  *DialPolicy
+	backoff map[peer.ID]*dialBackoff
+	dialing map[peer.ID]bool
+	mu      sync.Mutex
+}
+
+// NewAutoDialer creates an auto-dialer for the peers known to the discovery manager
+func NewAutoDialer(dm *DiscoveryManager, policy *DialPolicy) *AutoDialer {
+	return &AutoDialer{
+		dm:      dm,
+		policy:  policy.withDefaults(),
+		backoff: make(map[peer.ID]*dialBackoff),
+		dialing: make(map[peer.ID]bool),
+	}
+}
+
+// Start dials peers when they are discovered, when a connection is lost and
+// periodically, until ctx is cancelled
+func (ad *AutoDialer) Start(ctx context.Context) {
+	ticker := time.NewTicker(ad.policy.Interval)
+	defer ticker.Stop()
+
+	sub := ad.dm.events.Subscribe(0, EventPeerDiscovered, EventPeerDisconnected)
+	defer sub.Close()
+
+	ad.dialRound(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sub.C:
+			ad.dialRound(ctx)
+		case <-ticker.C:
+			ad.dialRound(ctx)
+		}
+	}
+}
+
+// dialRound starts dials to the best candidates if the node has fewer
+// connections than the target
+func (ad *AutoDialer) dialRound(ctx context.Context) {
+	h := ad.dm.host
+	connected := len(h.Network().Peers())
+
+	ad.mu.Lock()
+	defer ad.mu.Unlock()
+
+	ad.pruneBackoffLocked()
+
+	inFlight := len(ad.dialing)
+	free := ad.policy.MaxConcurrentDials - inFlight
+	if free <= 0 {
+		return
+	}
+
+	// Protected peers are redialed whatever the number of connections
+	protected := ad.candidatesLocked(free, true)
+	ad.startDialsLocked(ctx, protected)
+	free -= len(protected)
+
+	slots := ad.policy.TargetPeers - connected - inFlight - len(protected)
+	if free < slots {
+		slots = free
+	}
+	if slots <= 0 {
+		return
+	}
+	ad.startDialsLocked(ctx, ad.candidatesLocked(slots, false))
+}
+
+// pruneBackoffLocked forgets the backoff of peers no longer in the peer
+// store, which are never dialed again. Must be called with ad.mu held.
+func (ad *AutoDialer) pruneBackoffLocked() {
+	for id := range ad.backoff {
+		if !ad.dm.peerStore.HasPeer(id) {
+			delete(ad.backoff, id)
+		}
+	}
+}
+
+// startDialsLocked dials the given peers in the background. Must be called
+// with ad.mu held.
+func (ad *AutoDialer) startDialsLocked(ctx context.Context, peers []*PeerInfo) {
+	for _, info := range peers {
+		ad.dialing[info.AddrInfo.ID] = true
+		go ad.dial(ctx, info.AddrInfo)
+	}
+}
+
+// candidatesLocked returns up to limit disconnected peers that are not
+// backing off, best first, optionally only those protected from trimming.
+// Must be called with ad.mu held.
+func (ad *AutoDialer) candidatesLocked(limit int, protectedOnly bool) []*PeerInfo {
+	h := ad.dm.host
+	now := time.Now()
+
+	var candidates []*PeerInfo
+	for id, info := range ad.dm.peerStore.GetAllPeers() {
+		if id == h.ID() || ad.dialing[id] || len(info.AddrInfo.Addrs) == 0 {
+			continue
+		}
+		if h.Network().Connectedness(id) == network.Connected {
+			continue
+		}
+		if protectedOnly && !h.ConnManager().IsProtected(id, "") {
+			continue
+		}
+		if b, exists := ad.backoff[id]; exists && now.Before(b.nextAttempt) {
+			continue
+		}
+		candidates = append(candidates, info)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return ad.priority(candidates[i]) > ad.priority(candidates[j])
+	})
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+	return candidates
+}
+
+// priority ranks a dial candidate by its score and discovery source
+func (ad *AutoDialer) priority(info *PeerInfo) float64 {
+	return info.Score() + ad.policy.SourcePriority[info.Source]
+}
+
+// dial connects to a peer and records the outcome
+func (ad *AutoDialer) dial(ctx context.Context, ai peer.AddrInfo) {
+	dialCtx, cancel := context.WithTimeout(ctx, ad.policy.DialTimeout)
+	err := ad.dm.host.Connect(dialCtx, ai)
+	cancel()
+
+	ad.mu.Lock()
+	delete(ad.dialing, ai.ID)
+	if err == nil {
+		delete(ad.backoff, ai.ID)
+	} else {
+		b, exists := ad.backoff[ai.ID]
+		if !exists {
+			b = &dialBackoff{}
+			ad.backoff[ai.ID] = b
+		}
+		b.failures++
+		b.nextAttempt = time.Now().Add(ad.backoffDelay(b.failures))
+	}
+	ad.mu.Unlock()
+
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Auto-dial of peer %s failed: %v\n", utils.FormatPeerID(ai.ID), err)
+			ad.dm.peerStore.UpdatePeerStatus(ai.ID, PeerStatusUnreachable, err)
+		}
+		return
+	}
+
+	log.Printf("Auto-dialed peer: %s\n", utils.FormatPeerID(ai.ID))
+	ad.dm.peerStore.UpdatePeerStatus(ai.ID, PeerStatusConnected, nil)
+}
+
+// backoffDelay returns the wait after the given number of failed dials
+func (ad *AutoDialer) backoffDelay(failures int) time.Duration {
+	delay := ad.policy.InitialBackoff
+	for i := 1; i < failures && delay < ad.policy.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > ad.policy.MaxBackoff {
+		delay = ad.policy.MaxBackoff
+	}
+	return delay
+}
+
+// EnableAutoDial connects to discovered peers from every mechanism according to the policy
+func (dm *DiscoveryManager) EnableAutoDial(policy *DialPolicy) *AutoDialer {
+	dialer := NewAutoDialer(dm, policy)
+	go dialer.Start(dm.ctx)
+	log.Printf("Auto-dial enabled (target peers: %d)\n", dialer.policy.TargetPeers)
+	return dialer
+}
@@ -0,0 +1,182 @@
+package discovery
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// newTestHost creates a TCP-only host closed when the test ends
+func newTestHost(t *testing.T) host.Host {
+	h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatalf("Failed to create host: %v", err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+// TestBackoffDelay tests that the dial backoff doubles up to the maximum
+func TestBackoffDelay(t *testing.T) {
+	ad := NewAutoDialer(nil, &DialPolicy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second})
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, want := range expected {
+		if got := ad.backoffDelay(i + 1); got != want {
+			t.Errorf("Expected delay %v after %d failures, got %v", want, i+1, got)
+		}
+	}
+}
+
+// TestAutoDialDiscoveredPeers tests that peers found by any mechanism are
+// dialed and that unreachable ones back off
+func TestAutoDialDiscoveredPeers(t *testing.T) {
+	h := newTestHost(t)
+	target := newTestHost(t)
+
+	gone := newTestHost(t)
+	goneInfo := peer.AddrInfo{ID: gone.ID(), Addrs: gone.Addrs()}
+	gone.Close()
+
+	dm := NewDiscoveryManager(h)
+	if err := dm.Start(); err != nil {
+		t.Fatalf("Failed to start discovery: %v", err)
+	}
+	defer dm.Stop()
+
+	status := func(id peer.ID) PeerStatus {
+		if info, exists := dm.GetPeers()[id]; exists {
+			return info.Status
+		}
+		return PeerStatusUnknown
+	}
+
+	dialer := dm.EnableAutoDial(&DialPolicy{Interval: 50 * time.Millisecond, DialTimeout: 2 * time.Second})
+
+	dm.handleFoundPeer(peer.AddrInfo{ID: target.ID(), Addrs: target.Addrs()}, "bootstrap")
+	dm.handleFoundPeer(goneInfo, "dht")
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if status(target.ID()) == PeerStatusConnected && status(gone.ID()) == PeerStatusUnreachable {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected target connected and closed peer unreachable, got %v and %v",
+				status(target.ID()), status(gone.ID()))
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	if h.Network().Connectedness(target.ID()) != network.Connected {
+		t.Errorf("Expected host to be connected to the discovered peer")
+	}
+
+	dialer.mu.Lock()
+	backoff, exists := dialer.backoff[gone.ID()]
+	dialer.mu.Unlock()
+	if !exists || backoff.failures != 1 {
+		t.Errorf("Expected one failed dial of the closed peer to back off, got %+v", backoff)
+	}
+
+	// Peers the store forgot lose their backoff on the next round
+	dm.RemovePeer(gone.ID(), "removed")
+	deadline = time.Now().Add(5 * time.Second)
+	for {
+		dialer.mu.Lock()
+		_, exists = dialer.backoff[gone.ID()]
+		dialer.mu.Unlock()
+		if !exists {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the backoff of a removed peer to be pruned")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// TestAutoDialPinnedPeers tests that pinned peers are protected and dialed
+// even when the node already has its target number of connections
+func TestAutoDialPinnedPeers(t *testing.T) {
+	h := newTestHost(t)
+	other := newTestHost(t)
+	pinned := newTestHost(t)
+
+	dm := NewDiscoveryManager(h)
+	if err := dm.Start(); err != nil {
+		t.Fatalf("Failed to start discovery: %v", err)
+	}
+	defer dm.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := h.Connect(ctx, peer.AddrInfo{ID: other.ID(), Addrs: other.Addrs()}); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+
+	dm.PinPeer(peer.AddrInfo{ID: pinned.ID(), Addrs: pinned.Addrs()})
+	if !dm.IsProtected(pinned.ID()) {
+		t.Errorf("Expected pinned peer to be protected")
+	}
+
+	dm.EnableAutoDial(&DialPolicy{TargetPeers: 1, Interval: 50 * time.Millisecond})
+	for h.Network().Connectedness(pinned.ID()) != network.Connected {
+		if ctx.Err() != nil {
+			t.Fatalf("Pinned peer was not dialed")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	dm.UnpinPeer(pinned.ID())
+	if dm.IsProtected(pinned.ID()) {
+		t.Errorf("Expected unpinned peer to no longer be protected")
+	}
+}
+
+// TestPinnedPeerRedialed tests that a pinned peer is reconnected after a
+// disconnect even when auto-dial is off and the peer store forgot it
+func TestPinnedPeerRedialed(t *testing.T) {
+	h := newTestHost(t)
+	pinned := newTestHost(t)
+
+	dm := NewDiscoveryManager(h)
+	if err := dm.Start(); err != nil {
+		t.Fatalf("Failed to start discovery: %v", err)
+	}
+	defer dm.Stop()
+
+	waitConnected := func(message string) {
+		deadline := time.Now().Add(10 * time.Second)
+		for h.Network().Connectedness(pinned.ID()) != network.Connected {
+			if time.Now().After(deadline) {
+				t.Fatal(message)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+
+	dm.PinPeer(peer.AddrInfo{ID: pinned.ID(), Addrs: pinned.Addrs()})
+	waitConnected("Pinned peer was not connected")
+
+	dm.RemovePeer(pinned.ID(), "removed")
+	if err := h.Network().ClosePeer(pinned.ID()); err != nil {
+		t.Fatalf("Failed to disconnect: %v", err)
+	}
+	waitConnected("Pinned peer was not reconnected")
+
+	// Unpinned peers stay disconnected
+	dm.UnpinPeer(pinned.ID())
+	if err := h.Network().ClosePeer(pinned.ID()); err != nil {
+		t.Fatalf("Failed to disconnect: %v", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if h.Network().Connectedness(pinned.ID()) == network.Connected {
+		t.Error("Unpinned peer should not be reconnected")
+	}
+}
@@ -0,0 +1,369 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// DNS record conventions
+const (
+	dnsaddrPrefix     = "_dnsaddr."     // TXT records listing peer multiaddrs live under this label
+	dnsaddrValue      = "dnsaddr="      // Prefix of a TXT value holding a multiaddr
+	srvPeerIDValue    = "peer_id="      // Prefix of a TXT value on an SRV target holding its peer ID
+	maxDNSAddrDepth   = 4               // Nested /dnsaddr/ lookups followed before giving up
+	dnsLookupTimeout  = 5 * time.Second // Time allowed for one lookup
+	maxHealthResponse = 64 << 10        // Largest /health response read for a peer ID
+)
+
+// DNSResolver looks up the records used by DNS discovery; *net.Resolver
+// implements it
+type DNSResolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// NewDNSResolver returns a resolver that queries the given server (host:port),
+// or the system resolver when server is empty
+func NewDNSResolver(server string) DNSResolver {
+	if server == "" {
+		return net.DefaultResolver
+	}
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// DNSConfig contains settings for DNS discovery
+type DNSConfig struct {
+	// DNSAddrs are domains whose _dnsaddr TXT records list peer multiaddrs
+	// ("dnsaddr=/ip4/.../p2p/<peer ID>"), as used by libp2p /dnsaddr/ addresses
+	DNSAddrs []string
+
+	// SRVNames are full SRV record names such as
+	// _realentity._tcp.peers.default.svc.cluster.local. The peer ID of each
+	// target comes from its TXT record "peer_id=<peer ID>" or, failing that,
+	// from PeerIDPort. _udp records are dialed over QUIC.
+	SRVNames []string
+
+	// PeerIDPort is the HTTP API port asked for the peer ID of SRV targets
+	// without a peer_id TXT record, such as the pods of a Kubernetes headless
+	// service, whose DNS serves no TXT records (0 = TXT records only)
+	PeerIDPort int
+
+	Resolver DNSResolver   // nil = system resolver
+	Interval time.Duration // How often the records are resolved
+}
+
+// DNSDiscovery finds peers in DNS records
+type DNSDiscovery struct {
+	dm       *DiscoveryManager
+	config   DNSConfig
+	resolver DNSResolver
+	peers    map[peer.ID]peer.AddrInfo
+	mu       sync.Mutex
+}
+
+// NewDNSDiscovery creates a mechanism resolving the configured records into
+// peers for the discovery manager
+func NewDNSDiscovery(dm *DiscoveryManager, config DNSConfig) *DNSDiscovery {
+	if config.Interval <= 0 {
+		config.Interval = time.Minute
+	}
+	resolver := config.Resolver
+	if resolver == nil {
+		resolver = NewDNSResolver("")
+	}
+
+	return &DNSDiscovery{
+		dm:       dm,
+		config:   config,
+		resolver: resolver,
+		peers:    make(map[peer.ID]peer.AddrInfo),
+	}
+}
+
+func (dd *DNSDiscovery) Name() string {
+	return "dns"
+}
+
+func (dd *DNSDiscovery) Start(ctx context.Context) error {
+	go dd.resolveLoop(ctx)
+
+	log.Printf("DNS discovery started with %d dnsaddr and %d SRV names\n",
+		len(dd.config.DNSAddrs), len(dd.config.SRVNames))
+	return nil
+}
+
+func (dd *DNSDiscovery) Stop() error {
+	log.Println("DNS discovery stopped")
+	return nil
+}
+
+// FindPeers returns the peers found by the last resolution
+func (dd *DNSDiscovery) FindPeers(ctx context.Context, limit int) ([]peer.AddrInfo, error) {
+	dd.mu.Lock()
+	defer dd.mu.Unlock()
+
+	var found []peer.AddrInfo
+	for _, ai := range dd.peers {
+		if len(found) >= limit {
+			break
+		}
+		found = append(found, ai)
+	}
+	return found, nil
+}
+
+// resolveLoop resolves the records immediately and then on every interval
+func (dd *DNSDiscovery) resolveLoop(ctx context.Context) {
+	ticker := time.NewTicker(dd.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		dd.Refresh(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh resolves all configured records and hands the peers found to the
+// discovery manager. Names that fail to resolve are logged and skipped, and
+// the last failure is reported in the mechanism status.
+func (dd *DNSDiscovery) Refresh(ctx context.Context) []peer.AddrInfo {
+	var lastErr error
+	found := make(map[peer.ID]peer.AddrInfo)
+	add := func(ai peer.AddrInfo) {
+		existing := found[ai.ID]
+		existing.ID = ai.ID
+		existing.Addrs = removeDuplicateAddrs(append(existing.Addrs, ai.Addrs...))
+		found[ai.ID] = existing
+	}
+
+	for _, name := range dd.config.DNSAddrs {
+		peers, err := dd.ResolveDNSAddr(ctx, name)
+		if err != nil {
+			log.Printf("Failed to resolve dnsaddr %s: %v\n", name, err)
+			lastErr = fmt.Errorf("failed to resolve dnsaddr %s: %v", name, err)
+			continue
+		}
+		for _, ai := range peers {
+			add(ai)
+		}
+	}
+
+	for _, name := range dd.config.SRVNames {
+		peers, err := dd.ResolveSRV(ctx, name)
+		if err != nil {
+			log.Printf("Failed to resolve SRV %s: %v\n", name, err)
+			lastErr = fmt.Errorf("failed to resolve SRV %s: %v", name, err)
+			continue
+		}
+		for _, ai := range peers {
+			add(ai)
+		}
+	}
+
+	dd.mu.Lock()
+	dd.peers = found
+	dd.mu.Unlock()
+
+	if dd.dm != nil {
+		dd.dm.recordRun(dd.Name(), lastErr)
+	}
+
+	result := make([]peer.AddrInfo, 0, len(found))
+	for _, ai := range found {
+		if dd.dm != nil {
+			dd.dm.handleFoundPeer(ai, dd.Name())
+		}
+		result = append(result, ai)
+	}
+	return result
+}
+
+// ResolveDNSAddr returns the peers listed in the _dnsaddr TXT records of a
+// domain, following nested /dnsaddr/ addresses
+func (dd *DNSDiscovery) ResolveDNSAddr(ctx context.Context, name string) ([]peer.AddrInfo, error) {
+	var addrs []multiaddr.Multiaddr
+	if err := dd.resolveDNSAddr(ctx, strings.TrimPrefix(name, "/dnsaddr/"), 0, &addrs); err != nil {
+		return nil, err
+	}
+
+	infos, err := peer.AddrInfosFromP2pAddrs(addrs...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid peer address in dnsaddr records: %v", err)
+	}
+	return infos, nil
+}
+
+// resolveDNSAddr appends the addresses listed for a domain to addrs
+func (dd *DNSDiscovery) resolveDNSAddr(ctx context.Context, name string, depth int, addrs *[]multiaddr.Multiaddr) error {
+	if depth >= maxDNSAddrDepth {
+		return fmt.Errorf("too many nested dnsaddr lookups at %s", name)
+	}
+
+	lookupCtx, cancel := context.WithTimeout(ctx, dnsLookupTimeout)
+	records, err := dd.resolver.LookupTXT(lookupCtx, dnsaddrPrefix+name)
+	cancel()
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		if !strings.HasPrefix(record, dnsaddrValue) {
+			continue
+		}
+
+		addr, err := multiaddr.NewMultiaddr(strings.TrimPrefix(record, dnsaddrValue))
+		if err != nil {
+			log.Printf("Skipping invalid dnsaddr record %q: %v\n", record, err)
+			continue
+		}
+
+		// A /dnsaddr/ address points at another domain to resolve
+		if nested, err := addr.ValueForProtocol(multiaddr.P_DNSADDR); err == nil {
+			if err := dd.resolveDNSAddr(ctx, nested, depth+1, addrs); err != nil {
+				log.Printf("Failed to resolve nested dnsaddr %s: %v\n", nested, err)
+			}
+			continue
+		}
+
+		if _, err := addr.ValueForProtocol(multiaddr.P_P2P); err != nil {
+			log.Printf("Skipping dnsaddr record without peer ID: %s\n", record)
+			continue
+		}
+		*addrs = append(*addrs, addr)
+	}
+	return nil
+}
+
+// ResolveSRV returns the peers named by an SRV record, with addresses built
+// from each target's IP addresses and port
+func (dd *DNSDiscovery) ResolveSRV(ctx context.Context, name string) ([]peer.AddrInfo, error) {
+	lookupCtx, cancel := context.WithTimeout(ctx, dnsLookupTimeout)
+	_, records, err := dd.resolver.LookupSRV(lookupCtx, "", "", name)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+	udp := strings.Contains(name, "._udp.")
+
+	var found []peer.AddrInfo
+	for _, srv := range records {
+		lookupCtx, cancel := context.WithTimeout(ctx, dnsLookupTimeout)
+		ips, err := dd.resolver.LookupIPAddr(lookupCtx, srv.Target)
+		cancel()
+		if err != nil {
+			log.Printf("Failed to resolve SRV target %s: %v\n", srv.Target, err)
+			continue
+		}
+
+		id, err := dd.srvPeerID(ctx, srv.Target, ips)
+		if err != nil {
+			log.Printf("Skipping SRV target %s: %v\n", srv.Target, err)
+			continue
+		}
+
+		ai := peer.AddrInfo{ID: id}
+		for _, ip := range ips {
+			if addr, err := srvMultiaddr(ip.IP, srv.Port, udp); err == nil {
+				ai.Addrs = append(ai.Addrs, addr)
+			}
+		}
+		if len(ai.Addrs) > 0 {
+			found = append(found, ai)
+		}
+	}
+	return found, nil
+}
+
+// srvPeerID finds the peer ID of an SRV target in its TXT records or, when
+// it has none and PeerIDPort is set, from the HTTP API of the target
+func (dd *DNSDiscovery) srvPeerID(ctx context.Context, target string, ips []net.IPAddr) (peer.ID, error) {
+	lookupCtx, cancel := context.WithTimeout(ctx, dnsLookupTimeout)
+	records, err := dd.resolver.LookupTXT(lookupCtx, target)
+	cancel()
+	if err == nil {
+		for _, record := range records {
+			if strings.HasPrefix(record, srvPeerIDValue) {
+				return peer.Decode(strings.TrimPrefix(record, srvPeerIDValue))
+			}
+		}
+	}
+
+	if dd.config.PeerIDPort == 0 {
+		return "", fmt.Errorf("no %s TXT record", strings.TrimSuffix(srvPeerIDValue, "="))
+	}
+	for _, ip := range ips {
+		id, err := dd.healthPeerID(ctx, ip.IP)
+		if err == nil {
+			return id, nil
+		}
+		log.Printf("Failed to get the peer ID of SRV target %s from %s: %v\n", target, ip.IP, err)
+	}
+	return "", fmt.Errorf("no %s TXT record and no peer ID from its HTTP API", strings.TrimSuffix(srvPeerIDValue, "="))
+}
+
+// healthPeerID reads the peer ID reported by the /health endpoint of a node.
+// The ID is verified by the libp2p handshake when the peer is dialed.
+func (dd *DNSDiscovery) healthPeerID(ctx context.Context, ip net.IP) (peer.ID, error) {
+	ctx, cancel := context.WithTimeout(ctx, dnsLookupTimeout)
+	defer cancel()
+
+	url := fmt.Sprintf("http://%s/health", net.JoinHostPort(ip.String(), strconv.Itoa(dd.config.PeerIDPort)))
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %s", response.Status)
+	}
+
+	var health struct {
+		PeerID string `json:"peer_id"`
+	}
+	if err := json.NewDecoder(io.LimitReader(response.Body, maxHealthResponse)).Decode(&health); err != nil {
+		return "", fmt.Errorf("invalid health response: %v", err)
+	}
+	return peer.Decode(health.PeerID)
+}
+
+// srvMultiaddr builds the multiaddr of an SRV target address
+func srvMultiaddr(ip net.IP, port uint16, udp bool) (multiaddr.Multiaddr, error) {
+	family := "ip6"
+	if ip.To4() != nil {
+		family = "ip4"
+	}
+
+	if udp {
+		return multiaddr.NewMultiaddr(fmt.Sprintf("/%s/%s/udp/%d/quic-v1", family, ip.String(), port))
+	}
+	return multiaddr.NewMultiaddr(fmt.Sprintf("/%s/%s/tcp/%d", family, ip.String(), port))
+}
@@ -0,0 +1,151 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// fakeResolver answers DNS lookups from fixed records
+type fakeResolver struct {
+	txt map[string][]string
+	srv map[string][]*net.SRV
+	ip  map[string][]net.IPAddr
+}
+
+func (r *fakeResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if records, exists := r.txt[name]; exists {
+		return records, nil
+	}
+	return nil, fmt.Errorf("no such host: %s", name)
+}
+
+func (r *fakeResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	if records, exists := r.srv[name]; exists {
+		return name, records, nil
+	}
+	return "", nil, fmt.Errorf("no such host: %s", name)
+}
+
+func (r *fakeResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	if addrs, exists := r.ip[host]; exists {
+		return addrs, nil
+	}
+	return nil, fmt.Errorf("no such host: %s", host)
+}
+
+// TestDNSDiscovery tests that dnsaddr and SRV records resolve to peers
+func TestDNSDiscovery(t *testing.T) {
+	first, second, third := newTestPeerID(t), newTestPeerID(t), newTestPeerID(t)
+
+	resolver := &fakeResolver{
+		txt: map[string][]string{
+			"_dnsaddr.peers.example.com": {
+				"dnsaddr=/ip4/10.0.0.1/tcp/4001/p2p/" + first.String(),
+				"dnsaddr=/dnsaddr/eu.peers.example.com",
+				"unrelated record",
+			},
+			"_dnsaddr.eu.peers.example.com": {
+				"dnsaddr=/ip4/10.0.1.1/tcp/4001/p2p/" + second.String(),
+			},
+			"node-0.peers.svc.": {"peer_id=" + third.String()},
+		},
+		srv: map[string][]*net.SRV{
+			"_realentity._tcp.peers.svc": {
+				{Target: "node-0.peers.svc.", Port: 4001},
+				{Target: "node-1.peers.svc.", Port: 4001}, // No peer ID record
+			},
+		},
+		ip: map[string][]net.IPAddr{
+			"node-0.peers.svc.": {{IP: net.ParseIP("10.1.0.5")}},
+		},
+	}
+
+	dd := NewDNSDiscovery(nil, DNSConfig{
+		DNSAddrs: []string{"/dnsaddr/peers.example.com"},
+		SRVNames: []string{"_realentity._tcp.peers.svc", "_missing._tcp.peers.svc"},
+		Resolver: resolver,
+	})
+
+	found := make(map[string]string)
+	for _, ai := range dd.Refresh(context.Background()) {
+		if len(ai.Addrs) != 1 {
+			t.Fatalf("Expected one address for %s, got %v", ai.ID, ai.Addrs)
+		}
+		found[ai.ID.String()] = ai.Addrs[0].String()
+	}
+
+	expected := map[string]string{
+		first.String():  "/ip4/10.0.0.1/tcp/4001",
+		second.String(): "/ip4/10.0.1.1/tcp/4001",
+		third.String():  "/ip4/10.1.0.5/tcp/4001",
+	}
+	if len(found) != len(expected) {
+		t.Fatalf("Expected %d peers, got %v", len(expected), found)
+	}
+	for id, addr := range expected {
+		if found[id] != addr {
+			t.Errorf("Expected %s at %s, got %q", id, addr, found[id])
+		}
+	}
+
+	peers, _ := dd.FindPeers(context.Background(), 10)
+	if len(peers) != 3 {
+		t.Errorf("Expected FindPeers to return the resolved peers, got %d", len(peers))
+	}
+}
+
+// TestDNSDiscoverySRVPeerIDFromHTTP tests that SRV targets without TXT
+// records, as in Kubernetes headless services, get their peer ID from the
+// HTTP API of the node
+func TestDNSDiscoverySRVPeerIDFromHTTP(t *testing.T) {
+	id := newTestPeerID(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"status": "healthy", "peer_id": id.String()})
+	}))
+	defer server.Close()
+
+	_, portStr, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to parse server address: %v", err)
+	}
+	port, _ := strconv.Atoi(portStr)
+
+	resolver := &fakeResolver{
+		srv: map[string][]*net.SRV{
+			"_realentity._tcp.peers.default.svc.cluster.local": {
+				{Target: "10-0-0-5.peers.default.svc.cluster.local.", Port: 4001},
+			},
+		},
+		ip: map[string][]net.IPAddr{
+			"10-0-0-5.peers.default.svc.cluster.local.": {{IP: net.ParseIP("127.0.0.1")}},
+		},
+	}
+	config := DNSConfig{
+		SRVNames: []string{"_realentity._tcp.peers.default.svc.cluster.local"},
+		Resolver: resolver,
+	}
+
+	// Without the HTTP port, targets without TXT records are skipped
+	if found := NewDNSDiscovery(nil, config).Refresh(context.Background()); len(found) != 0 {
+		t.Fatalf("Expected no peers without a peer ID source, got %v", found)
+	}
+
+	config.PeerIDPort = port
+	found := NewDNSDiscovery(nil, config).Refresh(context.Background())
+	if len(found) != 1 || found[0].ID != id {
+		t.Fatalf("Expected peer %s, got %v", id, found)
+	}
+	if addr := found[0].Addrs[0].String(); addr != "/ip4/127.0.0.1/tcp/4001" {
+		t.Errorf("Expected address /ip4/127.0.0.1/tcp/4001, got %s", addr)
+	}
+}
@@ -0,0 +1,181 @@
+package discovery
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// PeerEventType identifies what happened to a peer
+type PeerEventType string
+
+// Peer event types
+const (
+	EventPeerDiscovered      PeerEventType = "peer_discovered"       // A discovery mechanism found the peer
+	EventPeerConnected       PeerEventType = "peer_connected"        // The first connection to the peer opened
+	EventPeerDisconnected    PeerEventType = "peer_disconnected"     // The last connection to the peer closed
+	EventPeerStatusChanged   PeerEventType = "peer_status_changed"   // The peer's status in the peer store changed
+	EventPeerServicesUpdated PeerEventType = "peer_services_updated" // The peer advertises a different set of services
+	EventPeerEvicted         PeerEventType = "peer_evicted"          // The peer was removed from the peer store
+)
+
+// defaultSubscriptionBuffer is the number of events queued for a subscriber
+const defaultSubscriptionBuffer = 64
+
+// PeerEvent describes a change to a peer
+type PeerEvent struct {
+	Type      PeerEventType `json:"type"`
+	PeerID    peer.ID       `json:"peer_id"`
+	Time      time.Time     `json:"time"`
+	Source    string        `json:"source,omitempty"`     // Discovery mechanism, for discovered peers
+	Addrs     []string      `json:"addrs,omitempty"`      // Known addresses, for discovered peers
+	OldStatus string        `json:"old_status,omitempty"` // For status changes
+	NewStatus string        `json:"new_status,omitempty"` // For status changes
+	Services  []string      `json:"services,omitempty"`   // For service updates
+	Reason    string        `json:"reason,omitempty"`     // For evictions: "capacity", "expired" or "removed"
+}
+
+// AddrInfo returns the peer and addresses carried by the event
+func (e PeerEvent) AddrInfo() peer.AddrInfo {
+	info := peer.AddrInfo{ID: e.PeerID}
+	for _, addrStr := range e.Addrs {
+		if addr, err := multiaddr.NewMultiaddr(addrStr); err == nil {
+			info.Addrs = append(info.Addrs, addr)
+		}
+	}
+	return info
+}
+
+// EventBus delivers peer events to any number of subscribers. Publishing
+// never blocks: events for a subscriber whose buffer is full are dropped
+// and counted.
+type EventBus struct {
+	subscribers map[*Subscription]struct{}
+	mu          sync.RWMutex
+}
+
+// Subscription receives the events it subscribed to on C until closed
+type Subscription struct {
+	C <-chan PeerEvent
+
+	bus     *EventBus
+	events  chan PeerEvent
+	types   map[PeerEventType]bool // nil = all types
+	dropped atomic.Int64           // Publishers hold only the bus read lock
+	once    sync.Once
+}
+
+// NewEventBus creates an event bus without subscribers
+func NewEventBus() *EventBus {
+	return &EventBus{
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscribe returns a subscription to the given event types, or to all events
+// when no type is given. A buffer of 0 uses the default size.
+func (b *EventBus) Subscribe(buffer int, types ...PeerEventType) *Subscription {
+	if buffer <= 0 {
+		buffer = defaultSubscriptionBuffer
+	}
+
+	events := make(chan PeerEvent, buffer)
+	sub := &Subscription{
+		C:      events,
+		bus:    b,
+		events: events,
+	}
+	if len(types) > 0 {
+		sub.types = make(map[PeerEventType]bool, len(types))
+		for _, t := range types {
+			sub.types[t] = true
+		}
+	}
+
+	b.mu.Lock()
+	b.subscribers[sub] = struct{}{}
+	b.mu.Unlock()
+	return sub
+}
+
+// Publish delivers an event to the matching subscribers
+func (b *EventBus) Publish(event PeerEvent) {
+	if b == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for sub := range b.subscribers {
+		if sub.types != nil && !sub.types[event.Type] {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+}
+
+// Close stops the subscription and closes its channel
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.bus.mu.Lock()
+		delete(s.bus.subscribers, s)
+		close(s.events)
+		s.bus.mu.Unlock()
+	})
+}
+
+// Dropped returns how many events were dropped because the subscriber fell behind
+func (s *Subscription) Dropped() int {
+	return int(s.dropped.Load())
+}
+
+// Events returns the bus on which the discovery manager publishes peer events
+func (dm *DiscoveryManager) Events() *EventBus {
+	return dm.events
+}
+
+// connectionNotifiee tracks the status of known peers and publishes
+// connected and disconnected events for the first and last connection to a peer
+func (dm *DiscoveryManager) connectionNotifiee() network.Notifiee {
+	return &network.NotifyBundle{
+		ConnectedF: func(n network.Network, conn network.Conn) {
+			if len(n.ConnsToPeer(conn.RemotePeer())) == 1 {
+				dm.peerStore.SetPeerStatus(conn.RemotePeer(), PeerStatusConnected)
+				dm.events.Publish(PeerEvent{Type: EventPeerConnected, PeerID: conn.RemotePeer()})
+			}
+		},
+		DisconnectedF: func(n network.Network, conn network.Conn) {
+			if n.Connectedness(conn.RemotePeer()) != network.Connected {
+				// The peer was reachable, so it can likely be dialed again
+				dm.peerStore.SetPeerStatus(conn.RemotePeer(), PeerStatusConnectable)
+				dm.events.Publish(PeerEvent{Type: EventPeerDisconnected, PeerID: conn.RemotePeer()})
+			}
+		},
+	}
+}
+
+// String returns the name of a peer status used in events and the API
+func (s PeerStatus) String() string {
+	switch s {
+	case PeerStatusConnectable:
+		return "connectable"
+	case PeerStatusUnreachable:
+		return "unreachable"
+	case PeerStatusConnected:
+		return "connected"
+	default:
+		return "unknown"
+	}
+}
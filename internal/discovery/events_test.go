@@ -0,0 +1,121 @@
+package discovery
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// TestEventBusSubscribers tests that every matching subscriber receives an event
+func TestEventBusSubscribers(t *testing.T) {
+	bus := NewEventBus()
+	all := bus.Subscribe(0)
+	defer all.Close()
+	connected := bus.Subscribe(0, EventPeerConnected)
+	defer connected.Close()
+
+	bus.Publish(PeerEvent{Type: EventPeerDiscovered, PeerID: "a"})
+	bus.Publish(PeerEvent{Type: EventPeerConnected, PeerID: "a"})
+
+	if event := <-all.C; event.Type != EventPeerDiscovered || event.Time.IsZero() {
+		t.Errorf("Expected discovered event with a time, got %+v", event)
+	}
+	if event := <-all.C; event.Type != EventPeerConnected {
+		t.Errorf("Expected connected event, got %+v", event)
+	}
+	if event := <-connected.C; event.Type != EventPeerConnected {
+		t.Errorf("Expected filtered subscriber to get only the connected event, got %+v", event)
+	}
+	if len(connected.C) != 0 {
+		t.Errorf("Expected no more events for the filtered subscriber")
+	}
+}
+
+// TestEventBusSlowSubscriber tests that a full subscriber loses events without blocking others
+func TestEventBusSlowSubscriber(t *testing.T) {
+	bus := NewEventBus()
+	slow := bus.Subscribe(1)
+	defer slow.Close()
+	fast := bus.Subscribe(10)
+	defer fast.Close()
+
+	for i := 0; i < 3; i++ {
+		bus.Publish(PeerEvent{Type: EventPeerConnected, PeerID: "a"})
+	}
+
+	if slow.Dropped() != 2 || len(fast.C) != 3 {
+		t.Errorf("Expected slow subscriber to drop 2 events and fast one to get 3, got %d dropped, %d queued",
+			slow.Dropped(), len(fast.C))
+	}
+
+	// Concurrent publishers count drops without racing
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				bus.Publish(PeerEvent{Type: EventPeerDisconnected, PeerID: "a"})
+			}
+		}()
+	}
+	wg.Wait()
+	if slow.Dropped() != 42 {
+		t.Errorf("Expected slow subscriber to drop 42 events, got %d", slow.Dropped())
+	}
+
+	// Closed subscriptions no longer receive events
+	slow.Close()
+	bus.Publish(PeerEvent{Type: EventPeerConnected, PeerID: "a"})
+}
+
+// TestPeerFoundCallback tests that every found peer reaches the callbacks,
+// even more than an event subscription buffers
+func TestPeerFoundCallback(t *testing.T) {
+	dm := NewDiscoveryManager(newTestHost(t))
+	defer dm.Stop()
+
+	found := 0
+	dm.SetPeerFoundCallback(func(peer.AddrInfo) { found++ })
+
+	for i := 0; i < 2*defaultSubscriptionBuffer; i++ {
+		dm.handleFoundPeer(peer.AddrInfo{ID: newTestPeerID(t)}, "mdns")
+	}
+	if found != 2*defaultSubscriptionBuffer {
+		t.Errorf("Expected %d callbacks, got %d", 2*defaultSubscriptionBuffer, found)
+	}
+}
+
+// TestPeerStoreEvents tests that the peer store publishes status, service and eviction changes
+func TestPeerStoreEvents(t *testing.T) {
+	bus := NewEventBus()
+	sub := bus.Subscribe(0)
+	defer sub.Close()
+
+	ps := NewPeerStoreWithConfig(&PeerStoreConfig{MaxPeers: 1})
+	ps.events = bus
+
+	ps.AddPeer(peer.AddrInfo{ID: "a"}, "mdns")
+	ps.UpdatePeerStatus("a", PeerStatusConnectable, nil)
+	ps.UpdatePeerStatus("a", PeerStatusConnectable, nil) // Unchanged, no event
+	ps.UpdatePeerServices("a", []string{"echo"})
+	ps.UpdatePeerServices("a", []string{"echo"}) // Unchanged, no event
+	ps.AddPeer(peer.AddrInfo{ID: "b"}, "mdns")   // Evicts a
+
+	expected := []PeerEvent{
+		{Type: EventPeerStatusChanged, PeerID: "a", OldStatus: "unknown", NewStatus: "connectable"},
+		{Type: EventPeerServicesUpdated, PeerID: "a"},
+		{Type: EventPeerEvicted, PeerID: "a", Reason: "capacity"},
+	}
+	for _, want := range expected {
+		got := <-sub.C
+		if got.Type != want.Type || got.PeerID != want.PeerID || got.OldStatus != want.OldStatus ||
+			got.NewStatus != want.NewStatus || got.Reason != want.Reason {
+			t.Errorf("Expected %+v, got %+v", want, got)
+		}
+	}
+	if len(sub.C) != 0 {
+		t.Errorf("Expected no more events, got %d", len(sub.C))
+	}
+}
@@ -0,0 +1,130 @@
+package discovery
+
+import (
+	"log"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Bonuses added to a peer's score when choosing which peer to evict
+const (
+	bootstrapRetentionBonus = 1.0  // Bootstrap, static and pinned peers are chosen by the operator
+	connectedRetentionBonus = 0.25 // Peers we connected to before are likely to accept again
+)
+
+// PeerStoreConfig contains capacity and expiry settings for a PeerStore
+type PeerStoreConfig struct {
+	MaxPeers      int           // Maximum number of known peers
+	PeerTTL       time.Duration // Peers not seen for this long are removed
+	UnreliableTTL time.Duration // Peers with low reliability not seen for this long are removed
+}
+
+// DefaultPeerStoreConfig returns the settings used by NewDiscoveryManager
+func DefaultPeerStoreConfig() *PeerStoreConfig {
+	return &PeerStoreConfig{
+		MaxPeers:      1000,
+		PeerTTL:       24 * time.Hour,
+		UnreliableTTL: 10 * time.Minute,
+	}
+}
+
+// withDefaults fills unset fields from the default configuration
+func (c *PeerStoreConfig) withDefaults() *PeerStoreConfig {
+	defaults := DefaultPeerStoreConfig()
+	if c == nil {
+		return defaults
+	}
+
+	result := *c
+	if result.MaxPeers <= 0 {
+		result.MaxPeers = defaults.MaxPeers
+	}
+	if result.PeerTTL <= 0 {
+		result.PeerTTL = defaults.PeerTTL
+	}
+	if result.UnreliableTTL <= 0 {
+		result.UnreliableTTL = defaults.UnreliableTTL
+	}
+	return &result
+}
+
+// PeerStoreStats counts the peers known to a PeerStore and those it dropped
+type PeerStoreStats struct {
+	Peers    int `json:"peers"`
+	Capacity int `json:"capacity"`
+	Evicted  int `json:"evicted"`  // Removed to make room for a new peer
+	Expired  int `json:"expired"`  // Removed by cleanup after their TTL
+	Rejected int `json:"rejected"` // Not added because every known peer is connected
+}
+
+// Stats returns the peer store counters
+func (ps *PeerStore) Stats() PeerStoreStats {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	stats := ps.stats
+	stats.Peers = len(ps.peers)
+	stats.Capacity = ps.maxPeers
+	return stats
+}
+
+// connectedLocked reports whether a peer is currently connected. Must be
+// called with ps.mu held.
+func (ps *PeerStore) connectedLocked(id peer.ID, info *PeerInfo) bool {
+	if ps.isConnected != nil {
+		return ps.isConnected(id)
+	}
+	return info.Status == PeerStatusConnected
+}
+
+// retentionLocked returns how much the store wants to keep a peer; the peer
+// with the lowest value is evicted first. Bootstrap peers are recognized by
+// the configured set rather than by source, since bootstrap discovery also
+// reports other peers it sees. Must be called with ps.mu held.
+func (ps *PeerStore) retentionLocked(id peer.ID, info *PeerInfo) float64 {
+	value := info.Score()
+	if info.Source == "static" || info.Source == "pinned" || (ps.isBootstrap != nil && ps.isBootstrap(id)) {
+		value += bootstrapRetentionBonus
+	}
+	if info.ConnectCount > 0 {
+		value += connectedRetentionBonus
+	}
+	return value
+}
+
+// evictLocked removes the disconnected peer with the lowest retention, the
+// least recently seen one on ties. It returns false when every peer is
+// connected. Must be called with ps.mu held.
+func (ps *PeerStore) evictLocked() bool {
+	var victim peer.ID
+	var victimInfo *PeerInfo
+	var victimRetention float64
+
+	for id, info := range ps.peers {
+		if ps.connectedLocked(id, info) {
+			continue
+		}
+
+		value := ps.retentionLocked(id, info)
+		if victimInfo == nil || value < victimRetention ||
+			(value == victimRetention && info.LastSeen.Before(victimInfo.LastSeen)) {
+			victim, victimInfo, victimRetention = id, info, value
+		}
+	}
+
+	if victimInfo == nil {
+		return false
+	}
+
+	delete(ps.peers, victim)
+	ps.stats.Evicted++
+	ps.events.Publish(PeerEvent{Type: EventPeerEvicted, PeerID: victim, Reason: "capacity"})
+	log.Printf("Evicted peer %s from full peer store (retention %.2f)\n", victim.String(), victimRetention)
+	return true
+}
+
+// PeerStoreStats returns the counters of the discovery manager's peer store
+func (dm *DiscoveryManager) PeerStoreStats() PeerStoreStats {
+	return dm.peerStore.Stats()
+}
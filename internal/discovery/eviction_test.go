@@ -0,0 +1,70 @@
+package discovery
+
+import (
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// TestPeerStoreEviction tests that a full store evicts its least valuable
+// disconnected peer, keeping configured bootstrap peers longer
+func TestPeerStoreEviction(t *testing.T) {
+	connected := map[peer.ID]bool{"connected": true}
+	ps := NewPeerStoreWithConfig(&PeerStoreConfig{MaxPeers: 3})
+	ps.isConnected = func(id peer.ID) bool { return connected[id] }
+	ps.isBootstrap = func(id peer.ID) bool { return id == "bootstrap" }
+
+	ps.AddPeer(peer.AddrInfo{ID: "connected"}, "mdns")
+	ps.AddPeer(peer.AddrInfo{ID: "bootstrap"}, "bootstrap")
+	ps.AddPeer(peer.AddrInfo{ID: "flaky"}, "bootstrap")          // Seen by bootstrap discovery, not a bootstrap peer
+	ps.UpdatePeerStatus("connected", PeerStatusUnreachable, nil) // Lowest score, but connected
+	ps.UpdatePeerStatus("bootstrap", PeerStatusUnreachable, nil)
+	ps.UpdatePeerStatus("flaky", PeerStatusUnreachable, nil)
+
+	ps.AddPeer(peer.AddrInfo{ID: "new"}, "dht")
+	peers := ps.GetAllPeers()
+	if _, exists := peers["flaky"]; exists {
+		t.Error("Expected the lowest value disconnected peer to be evicted")
+	}
+	for _, id := range []peer.ID{"connected", "bootstrap", "new"} {
+		if _, exists := peers[id]; !exists {
+			t.Errorf("Expected peer %s to be kept", id)
+		}
+	}
+
+	// With every peer connected there is nothing to evict
+	connected["bootstrap"], connected["new"] = true, true
+	ps.AddPeer(peer.AddrInfo{ID: "rejected"}, "dht")
+	if _, exists := ps.GetAllPeers()["rejected"]; exists {
+		t.Error("Expected new peer to be rejected while all peers are connected")
+	}
+
+	stats := ps.Stats()
+	if stats.Peers != 3 || stats.Capacity != 3 || stats.Evicted != 1 || stats.Rejected != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+// TestPeerStoreCleanupTTL tests that peers past their TTL expire unless connected
+func TestPeerStoreCleanupTTL(t *testing.T) {
+	connected := map[peer.ID]bool{"old-connected": true}
+	ps := NewPeerStoreWithConfig(&PeerStoreConfig{PeerTTL: time.Hour})
+	ps.isConnected = func(id peer.ID) bool { return connected[id] }
+
+	for _, id := range []peer.ID{"old", "old-connected", "recent"} {
+		ps.AddPeer(peer.AddrInfo{ID: id}, "mdns")
+	}
+	ps.peers["old"].LastSeen = time.Now().Add(-2 * time.Hour)
+	ps.peers["old-connected"].LastSeen = time.Now().Add(-2 * time.Hour)
+
+	ps.cleanup()
+
+	peers := ps.GetAllPeers()
+	if _, exists := peers["old"]; exists {
+		t.Error("Expected peer past its TTL to expire")
+	}
+	if len(peers) != 2 || ps.Stats().Expired != 1 {
+		t.Errorf("Expected connected and recent peers to be kept, got %d peers, stats %+v", len(peers), ps.Stats())
+	}
+}
@@ -3,12 +3,15 @@ package discovery
 import (
 	"context"
 	"log"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/multiformats/go-multiaddr"
+	"github.com/realentity/realentity-node/internal/utils"
 )
 
 // DiscoveryManager coordinates different discovery mechanisms
@@ -19,7 +22,14 @@ type DiscoveryManager struct {
 	ctx         context.Context
 	cancel      context.CancelFunc
 	mu          sync.RWMutex
-	onPeerFound func(peer.AddrInfo)
+	events      *EventBus
+	notifiee    network.Notifiee
+	persistence *PersistenceConfig // nil when the peer store isn't saved
+	schedule    *ScheduleConfig
+	status      map[string]*mechanismState
+	statusMu    sync.Mutex
+	onPeerFound []func(peer.AddrInfo)
+	pinned      map[peer.ID]peer.AddrInfo // Peers kept connected, see PinPeer
 }
 
 // DiscoveryMechanism interface for different discovery methods
@@ -30,24 +40,39 @@ type DiscoveryMechanism interface {
 	FindPeers(ctx context.Context, limit int) ([]peer.AddrInfo, error)
 }
 
+// ProviderDiscovery is implemented by mechanisms that can find the providers
+// of a specific service
+type ProviderDiscovery interface {
+	FindServiceProviders(ctx context.Context, service string, limit int) ([]peer.AddrInfo, error)
+}
+
 // PeerStore manages discovered peers with metadata
 type PeerStore struct {
 	peers       map[peer.ID]*PeerInfo
 	mu          sync.RWMutex
 	maxPeers    int
-	cleanupTime time.Duration
+	cleanupTime time.Duration      // Stale peers with low reliability are removed after this
+	peerTTL     time.Duration      // Any peer not seen for this long is removed
+	isConnected func(peer.ID) bool // Reports live connections (nil = use peer status)
+	isBootstrap func(peer.ID) bool // Reports configured bootstrap peers (nil = none)
+	stats       PeerStoreStats
+	events      *EventBus // Receives status, service and eviction events (nil = none)
 }
 
 // PeerInfo contains metadata about discovered peers
 type PeerInfo struct {
-	AddrInfo     peer.AddrInfo
-	LastSeen     time.Time
-	Source       string // Which discovery mechanism found this peer
-	Status       PeerStatus
-	Services     []string
-	Reliability  float64 // 0.0 to 1.0
-	LastError    error
-	ConnectCount int
+	AddrInfo      peer.AddrInfo
+	LastSeen      time.Time
+	Source        string // Which discovery mechanism found this peer
+	Status        PeerStatus
+	Services      []string
+	ServiceHints  []string // Services other peers claim it provides, until it describes itself
+	Labels        []string // Labels the peer advertises about itself
+	Reliability   float64  // 0.0 to 1.0
+	LastError     error
+	ConnectCount  int
+	Quality       PeerQuality              // Results of latency and health probes
+	ServiceHealth map[string]ServiceHealth // Results of service probes by service name
 }
 
 type PeerStatus int
@@ -61,14 +86,33 @@ const (
 
 // NewDiscoveryManager creates a new discovery manager
 func NewDiscoveryManager(h host.Host) *DiscoveryManager {
+	return NewDiscoveryManagerWithConfig(h, DefaultPeerStoreConfig())
+}
+
+// NewDiscoveryManagerWithConfig creates a discovery manager with custom peer store limits
+func NewDiscoveryManagerWithConfig(h host.Host, config *PeerStoreConfig) *DiscoveryManager {
 	ctx, cancel := context.WithCancel(context.Background())
 
+	events := NewEventBus()
+	peerStore := NewPeerStoreWithConfig(config)
+	peerStore.events = events
+	peerStore.isConnected = func(id peer.ID) bool {
+		return h.Network().Connectedness(id) == network.Connected
+	}
+	peerStore.isBootstrap = func(id peer.ID) bool {
+		return h.ConnManager().IsProtected(id, ProtectTagBootstrap)
+	}
+
 	dm := &DiscoveryManager{
 		host:       h,
 		mechanisms: make([]DiscoveryMechanism, 0),
-		peerStore:  NewPeerStore(1000, 10*time.Minute),
+		peerStore:  peerStore,
 		ctx:        ctx,
 		cancel:     cancel,
+		events:     events,
+		status:     make(map[string]*mechanismState),
+		schedule:   DefaultScheduleConfig(),
+		pinned:     make(map[peer.ID]peer.AddrInfo),
 	}
 
 	return dm
@@ -76,10 +120,20 @@ func NewDiscoveryManager(h host.Host) *DiscoveryManager {
 
 // NewPeerStore creates a new peer store
 func NewPeerStore(maxPeers int, cleanupTime time.Duration) *PeerStore {
+	return NewPeerStoreWithConfig(&PeerStoreConfig{
+		MaxPeers:      maxPeers,
+		UnreliableTTL: cleanupTime,
+	})
+}
+
+// NewPeerStoreWithConfig creates a peer store with custom limits
+func NewPeerStoreWithConfig(config *PeerStoreConfig) *PeerStore {
+	config = config.withDefaults()
 	return &PeerStore{
 		peers:       make(map[peer.ID]*PeerInfo),
-		maxPeers:    maxPeers,
-		cleanupTime: cleanupTime,
+		maxPeers:    config.MaxPeers,
+		cleanupTime: config.UnreliableTTL,
+		peerTTL:     config.PeerTTL,
 	}
 }
 
@@ -88,14 +142,22 @@ func (dm *DiscoveryManager) AddMechanism(mechanism DiscoveryMechanism) {
 	dm.mu.Lock()
 	defer dm.mu.Unlock()
 	dm.mechanisms = append(dm.mechanisms, mechanism)
+
+	dm.statusMu.Lock()
+	dm.stateLocked(mechanism.Name())
+	dm.statusMu.Unlock()
+
 	log.Printf("Added discovery mechanism: %s\n", mechanism.Name())
 }
 
-// SetPeerFoundCallback sets the callback for when peers are found
+// SetPeerFoundCallback calls callback for every peer found by a discovery
+// mechanism, synchronously on the goroutine that found it. Each call adds a
+// callback. Events().Subscribe offers more event types, but a subscriber that
+// falls behind loses events.
 func (dm *DiscoveryManager) SetPeerFoundCallback(callback func(peer.AddrInfo)) {
 	dm.mu.Lock()
 	defer dm.mu.Unlock()
-	dm.onPeerFound = callback
+	dm.onPeerFound = append(dm.onPeerFound, callback)
 }
 
 // Start begins all discovery mechanisms
@@ -108,13 +170,24 @@ func (dm *DiscoveryManager) Start() error {
 	for _, mechanism := range mechanisms {
 		if err := mechanism.Start(dm.ctx); err != nil {
 			log.Printf("Failed to start discovery mechanism %s: %v\n", mechanism.Name(), err)
+			dm.setRunning(mechanism.Name(), false, err)
 			continue
 		}
+		dm.setRunning(mechanism.Name(), true, nil)
 		log.Printf("Started discovery mechanism: %s\n", mechanism.Name())
 	}
 
-	// Start periodic discovery
-	go dm.periodicDiscovery()
+	// Publish connection events
+	dm.mu.Lock()
+	dm.notifiee = dm.connectionNotifiee()
+	dm.mu.Unlock()
+	dm.host.Network().Notify(dm.notifiee)
+
+	// Run the mechanisms on their schedule
+	go dm.runSchedule()
+
+	// Keep pinned peers connected
+	go dm.maintainPinned()
 
 	// Start peer store cleanup
 	go dm.peerStore.startCleanup(dm.ctx)
@@ -129,53 +202,25 @@ func (dm *DiscoveryManager) Stop() error {
 	dm.mu.RLock()
 	defer dm.mu.RUnlock()
 
+	if dm.notifiee != nil {
+		dm.host.Network().StopNotify(dm.notifiee)
+	}
+
 	for _, mechanism := range dm.mechanisms {
-		if err := mechanism.Stop(); err != nil {
+		err := mechanism.Stop()
+		if err != nil {
 			log.Printf("Error stopping discovery mechanism %s: %v\n", mechanism.Name(), err)
 		}
+		dm.setRunning(mechanism.Name(), false, err)
 	}
 
-	return nil
-}
-
-// periodicDiscovery runs continuous peer discovery
-func (dm *DiscoveryManager) periodicDiscovery() {
-	ticker := time.NewTicker(30 * time.Second)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-dm.ctx.Done():
-			return
-		case <-ticker.C:
-			dm.discoverPeers()
+	if dm.persistence != nil {
+		if err := dm.peerStore.Save(dm.persistence.Path); err != nil {
+			log.Printf("Failed to save peer store: %v\n", err)
 		}
 	}
-}
 
-// discoverPeers actively searches for peers using all mechanisms
-func (dm *DiscoveryManager) discoverPeers() {
-	dm.mu.RLock()
-	mechanisms := make([]DiscoveryMechanism, len(dm.mechanisms))
-	copy(mechanisms, dm.mechanisms)
-	dm.mu.RUnlock()
-
-	for _, mechanism := range mechanisms {
-		go func(m DiscoveryMechanism) {
-			ctx, cancel := context.WithTimeout(dm.ctx, 10*time.Second)
-			defer cancel()
-
-			peers, err := m.FindPeers(ctx, 10)
-			if err != nil {
-				log.Printf("Discovery mechanism %s failed: %v\n", m.Name(), err)
-				return
-			}
-
-			for _, peerInfo := range peers {
-				dm.handleFoundPeer(peerInfo, m.Name())
-			}
-		}(mechanism)
-	}
+	return nil
 }
 
 // handleFoundPeer processes a newly found peer
@@ -186,23 +231,47 @@ func (dm *DiscoveryManager) handleFoundPeer(addrInfo peer.AddrInfo, source strin
 	}
 
 	// Add to peer store
-	dm.peerStore.AddPeer(addrInfo, source)
+	if dm.peerStore.AddPeer(addrInfo, source) {
+		dm.recordFound(source)
+	}
+
+	addrs := make([]string, len(addrInfo.Addrs))
+	for i, addr := range addrInfo.Addrs {
+		addrs[i] = addr.String()
+	}
+	dm.events.Publish(PeerEvent{
+		Type:   EventPeerDiscovered,
+		PeerID: addrInfo.ID,
+		Source: source,
+		Addrs:  addrs,
+	})
 
-	// Notify callback
 	dm.mu.RLock()
-	callback := dm.onPeerFound
+	callbacks := dm.onPeerFound
 	dm.mu.RUnlock()
-
-	if callback != nil {
+	for _, callback := range callbacks {
 		callback(addrInfo)
 	}
 }
 
+// EnableProbing starts periodic latency and health probes of connected peers
+func (dm *DiscoveryManager) EnableProbing(client *utils.ServiceClient, interval time.Duration) *PeerProber {
+	prober := NewPeerProber(dm, client, interval)
+	go prober.Start(dm.ctx)
+	log.Printf("Peer probing enabled (interval: %v)\n", prober.interval)
+	return prober
+}
+
 // HandleFoundPeer makes the handleFoundPeer method accessible
 func (dm *DiscoveryManager) HandleFoundPeer(addrInfo peer.AddrInfo, source string) {
 	dm.handleFoundPeer(addrInfo, source)
 }
 
+// RemovePeer forgets a peer found by a discovery mechanism
+func (dm *DiscoveryManager) RemovePeer(peerID peer.ID, reason string) bool {
+	return dm.peerStore.RemovePeer(peerID, reason)
+}
+
 // GetPeers returns all known peers
 func (dm *DiscoveryManager) GetPeers() map[peer.ID]*PeerInfo {
 	return dm.peerStore.GetAllPeers()
@@ -213,8 +282,94 @@ func (dm *DiscoveryManager) GetConnectablePeers() []*PeerInfo {
 	return dm.peerStore.GetConnectablePeers()
 }
 
-// AddPeer adds a peer to the store
-func (ps *PeerStore) AddPeer(addrInfo peer.AddrInfo, source string) {
+// UpdatePeerServices records the services a peer provides, adding the peer if it is unknown
+func (dm *DiscoveryManager) UpdatePeerServices(peerID peer.ID, services []string) {
+	if !dm.peerStore.HasPeer(peerID) {
+		dm.peerStore.AddPeer(peer.AddrInfo{
+			ID:    peerID,
+			Addrs: dm.host.Peerstore().Addrs(peerID),
+		}, "connection")
+	}
+	dm.peerStore.UpdatePeerServices(peerID, services)
+}
+
+// UpdatePeerLabels records the labels a known peer advertises
+func (dm *DiscoveryManager) UpdatePeerLabels(peerID peer.ID, labels []string) {
+	dm.peerStore.UpdatePeerLabels(peerID, labels)
+}
+
+// GetPeersWithService returns peers known to provide the given service
+func (dm *DiscoveryManager) GetPeersWithService(service string) []*PeerInfo {
+	return dm.peerStore.GetPeersWithService(service)
+}
+
+// FindProviders returns the connected peers providing a service, best scored first
+func (dm *DiscoveryManager) FindProviders(service string) []peer.ID {
+	var candidates []*PeerInfo
+	for _, info := range dm.peerStore.GetPeersWithService(service) {
+		if info.Status == PeerStatusUnreachable {
+			continue
+		}
+		if dm.host.Network().Connectedness(info.AddrInfo.ID) != network.Connected {
+			continue
+		}
+		candidates = append(candidates, info)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Score() > candidates[j].Score()
+	})
+
+	ids := make([]peer.ID, len(candidates))
+	for i, info := range candidates {
+		ids[i] = info.AddrInfo.ID
+	}
+	return ids
+}
+
+// DiscoverProviders searches the mechanisms that support it for providers of
+// a service, connects to them and returns the connected providers, best
+// scored first
+func (dm *DiscoveryManager) DiscoverProviders(ctx context.Context, service string, limit int) []peer.ID {
+	dm.mu.RLock()
+	mechanisms := make([]DiscoveryMechanism, len(dm.mechanisms))
+	copy(mechanisms, dm.mechanisms)
+	dm.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, mechanism := range mechanisms {
+		finder, ok := mechanism.(ProviderDiscovery)
+		if !ok {
+			continue
+		}
+
+		providers, err := finder.FindServiceProviders(ctx, service, limit)
+		if err != nil {
+			log.Printf("Provider discovery via %s failed: %v\n", mechanism.Name(), err)
+		}
+
+		for _, addrInfo := range providers {
+			dm.handleFoundPeer(addrInfo, mechanism.Name())
+
+			wg.Add(1)
+			go func(ai peer.AddrInfo) {
+				defer wg.Done()
+				if err := dm.host.Connect(ctx, ai); err != nil {
+					dm.peerStore.UpdatePeerStatus(ai.ID, PeerStatusUnreachable, err)
+					return
+				}
+				dm.peerStore.AddPeerService(ai.ID, service)
+			}(addrInfo)
+		}
+	}
+	wg.Wait()
+
+	return dm.FindProviders(service)
+}
+
+// AddPeer adds a peer to the store, or updates it if known. It returns
+// whether the peer is new to the store.
+func (ps *PeerStore) AddPeer(addrInfo peer.AddrInfo, source string) bool {
 	ps.mu.Lock()
 	defer ps.mu.Unlock()
 
@@ -225,28 +380,37 @@ func (ps *PeerStore) AddPeer(addrInfo peer.AddrInfo, source string) {
 		existing.AddrInfo.Addrs = append(existing.AddrInfo.Addrs, addrInfo.Addrs...)
 		// Remove duplicates
 		existing.AddrInfo.Addrs = removeDuplicateAddrs(existing.AddrInfo.Addrs)
-	} else {
-		// Add new peer
-		ps.peers[addrInfo.ID] = &PeerInfo{
-			AddrInfo:     addrInfo,
-			LastSeen:     time.Now(),
-			Source:       source,
-			Status:       PeerStatusUnknown,
-			Services:     make([]string, 0),
-			Reliability:  0.5, // Start with neutral reliability
-			ConnectCount: 0,
-		}
+		return false
+	}
+
+	// Make room for the new peer
+	if len(ps.peers) >= ps.maxPeers && !ps.evictLocked() {
+		ps.stats.Rejected++
+		return false
+	}
+
+	// Add new peer
+	ps.peers[addrInfo.ID] = &PeerInfo{
+		AddrInfo:     addrInfo,
+		LastSeen:     time.Now(),
+		Source:       source,
+		Status:       PeerStatusUnknown,
+		Services:     make([]string, 0),
+		Reliability:  0.5, // Start with neutral reliability
+		ConnectCount: 0,
 	}
+	return true
 }
 
-// GetAllPeers returns all peers
+// GetAllPeers returns a snapshot of all peers
 func (ps *PeerStore) GetAllPeers() map[peer.ID]*PeerInfo {
 	ps.mu.RLock()
 	defer ps.mu.RUnlock()
 
 	result := make(map[peer.ID]*PeerInfo)
 	for id, info := range ps.peers {
-		result[id] = info
+		snapshot := *info
+		result[id] = &snapshot
 	}
 	return result
 }
@@ -259,19 +423,137 @@ func (ps *PeerStore) GetConnectablePeers() []*PeerInfo {
 	var connectable []*PeerInfo
 	for _, info := range ps.peers {
 		if info.Status == PeerStatusConnectable || info.Status == PeerStatusConnected {
-			connectable = append(connectable, info)
+			snapshot := *info
+			connectable = append(connectable, &snapshot)
 		}
 	}
 	return connectable
 }
 
+// HasPeer reports whether the peer is in the store
+func (ps *PeerStore) HasPeer(peerID peer.ID) bool {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	_, exists := ps.peers[peerID]
+	return exists
+}
+
+// UpdatePeerServices replaces the list of services advertised by a peer.
+// The peer's own answer supersedes any service hints from other peers.
+func (ps *PeerStore) UpdatePeerServices(peerID peer.ID, services []string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if info, exists := ps.peers[peerID]; exists {
+		changed := !sameStrings(info.Services, services)
+		info.Services = append([]string(nil), services...)
+		info.ServiceHints = nil
+		info.LastSeen = time.Now()
+		if changed {
+			ps.publishServicesLocked(peerID, info)
+		}
+	}
+}
+
+// SetServiceHints records the services another peer claims a peer provides.
+// Hints are kept apart from Services, which only the peer itself sets, and
+// are ignored once the peer has described itself.
+func (ps *PeerStore) SetServiceHints(peerID peer.ID, hints []string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if info, exists := ps.peers[peerID]; exists && len(info.Services) == 0 {
+		info.ServiceHints = append([]string(nil), hints...)
+	}
+}
+
+// AddPeerService records that a peer provides a service, keeping the
+// services already known
+func (ps *PeerStore) AddPeerService(peerID peer.ID, service string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if info, exists := ps.peers[peerID]; exists && !containsString(info.Services, service) {
+		info.Services = append(append([]string(nil), info.Services...), service)
+		ps.publishServicesLocked(peerID, info)
+	}
+}
+
+// publishServicesLocked publishes the services of a peer after they changed.
+// Must be called with ps.mu held.
+func (ps *PeerStore) publishServicesLocked(peerID peer.ID, info *PeerInfo) {
+	ps.events.Publish(PeerEvent{
+		Type:     EventPeerServicesUpdated,
+		PeerID:   peerID,
+		Services: info.Services,
+	})
+}
+
+// setStatusLocked changes the status of a peer, publishing the change. Must
+// be called with ps.mu held.
+func (ps *PeerStore) setStatusLocked(peerID peer.ID, info *PeerInfo, status PeerStatus) {
+	if info.Status == status {
+		return
+	}
+
+	old := info.Status
+	info.Status = status
+	ps.events.Publish(PeerEvent{
+		Type:      EventPeerStatusChanged,
+		PeerID:    peerID,
+		OldStatus: old.String(),
+		NewStatus: status.String(),
+	})
+}
+
+// RemovePeer removes a peer from the store, reporting whether it was known
+func (ps *PeerStore) RemovePeer(peerID peer.ID, reason string) bool {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if _, exists := ps.peers[peerID]; !exists {
+		return false
+	}
+	delete(ps.peers, peerID)
+	ps.events.Publish(PeerEvent{Type: EventPeerEvicted, PeerID: peerID, Reason: reason})
+	return true
+}
+
+// UpdatePeerLabels replaces the list of labels advertised by a peer
+func (ps *PeerStore) UpdatePeerLabels(peerID peer.ID, labels []string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if info, exists := ps.peers[peerID]; exists {
+		info.Labels = append([]string(nil), labels...)
+	}
+}
+
+// GetPeersWithService returns peers that advertise the given service
+func (ps *PeerStore) GetPeersWithService(service string) []*PeerInfo {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	var providers []*PeerInfo
+	for _, info := range ps.peers {
+		for _, name := range info.Services {
+			if name == service {
+				snapshot := *info
+				providers = append(providers, &snapshot)
+				break
+			}
+		}
+	}
+	return providers
+}
+
 // UpdatePeerStatus updates the status of a peer
 func (ps *PeerStore) UpdatePeerStatus(peerID peer.ID, status PeerStatus, err error) {
 	ps.mu.Lock()
 	defer ps.mu.Unlock()
 
 	if info, exists := ps.peers[peerID]; exists {
-		info.Status = status
+		ps.setStatusLocked(peerID, info, status)
 		info.LastError = err
 		info.LastSeen = time.Now()
 
@@ -285,6 +567,20 @@ func (ps *PeerStore) UpdatePeerStatus(peerID peer.ID, status PeerStatus, err err
 	}
 }
 
+// SetPeerStatus changes the status of a known peer without counting it as a
+// connection attempt
+func (ps *PeerStore) SetPeerStatus(peerID peer.ID, status PeerStatus) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if info, exists := ps.peers[peerID]; exists {
+		ps.setStatusLocked(peerID, info, status)
+		if status == PeerStatusConnected {
+			info.LastSeen = time.Now()
+		}
+	}
+}
+
 // startCleanup periodically removes old/unreliable peers
 func (ps *PeerStore) startCleanup(ctx context.Context) {
 	ticker := time.NewTicker(ps.cleanupTime)
@@ -300,28 +596,47 @@ func (ps *PeerStore) startCleanup(ctx context.Context) {
 	}
 }
 
-// cleanup removes old or unreliable peers
+// cleanup removes peers that haven't been seen for the peer TTL, and
+// unreliable peers that haven't been seen recently. Connected peers are kept.
 func (ps *PeerStore) cleanup() {
 	ps.mu.Lock()
 	defer ps.mu.Unlock()
 
-	cutoff := time.Now().Add(-ps.cleanupTime)
+	now := time.Now()
 	removed := 0
 
 	for id, info := range ps.peers {
-		// Remove peers that haven't been seen recently and have low reliability
-		if info.LastSeen.Before(cutoff) && info.Reliability < 0.3 {
+		if ps.connectedLocked(id, info) {
+			continue
+		}
+
+		age := now.Sub(info.LastSeen)
+		if age > ps.peerTTL || (age > ps.cleanupTime && info.Reliability < 0.3) {
 			delete(ps.peers, id)
+			ps.events.Publish(PeerEvent{Type: EventPeerEvicted, PeerID: id, Reason: "expired"})
 			removed++
 		}
 	}
 
 	if removed > 0 {
+		ps.stats.Expired += removed
 		log.Printf("Cleaned up %d old/unreliable peers\n", removed)
 	}
 }
 
 // Helper functions
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
 func removeDuplicateAddrs(addrs []multiaddr.Multiaddr) []multiaddr.Multiaddr {
 	seen := make(map[string]bool)
 	result := make([]multiaddr.Multiaddr, 0)
@@ -0,0 +1,328 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	bolt "go.etcd.io/bbolt"
+)
+
+// peerStoreVersion is the format version of the persisted peer store
+const peerStoreVersion = 1
+
+// Redial settings for peers loaded from disk
+const (
+	redialMinReliability = 0.5
+	redialMaxPeers       = 10
+	redialTimeout        = 15 * time.Second
+)
+
+// openTimeout bounds the wait for another process holding the peer store
+const openTimeout = time.Second
+
+// Buckets and keys of the peer store database
+var (
+	peersBucket = []byte("peers") // One record per peer, keyed by peer ID
+	metaBucket  = []byte("meta")
+	versionKey  = []byte("version")
+)
+
+// PersistenceConfig controls how the peer store is kept on disk
+type PersistenceConfig struct {
+	Path         string        // Database file the peer store is saved to
+	SaveInterval time.Duration // How often the peer store is saved
+	MaxAge       time.Duration // Peers not seen for longer are not reloaded
+}
+
+// persistedPeer is the part of a PeerInfo kept across restarts
+type persistedPeer struct {
+	ID           string    `json:"id"`
+	Addrs        []string  `json:"addrs"`
+	Source       string    `json:"source"`
+	Services     []string  `json:"services,omitempty"`
+	Labels       []string  `json:"labels,omitempty"`
+	Reliability  float64   `json:"reliability"`
+	ConnectCount int       `json:"connect_count"`
+	LastSeen     time.Time `json:"last_seen"`
+}
+
+// Save writes the peer store to an embedded bbolt database, one record per
+// peer. Peers no longer in the store are deleted from it. Each save is a
+// single transaction, so a crash while saving leaves the previous contents
+// intact. A file that isn't a peer store database is replaced.
+func (ps *PeerStore) Save(path string) error {
+	ps.mu.RLock()
+	records := make(map[string][]byte, len(ps.peers))
+	for id, info := range ps.peers {
+		addrs := make([]string, len(info.AddrInfo.Addrs))
+		for i, addr := range info.AddrInfo.Addrs {
+			addrs[i] = addr.String()
+		}
+
+		record, err := json.Marshal(persistedPeer{
+			ID:           id.String(),
+			Addrs:        addrs,
+			Source:       info.Source,
+			Services:     info.Services,
+			Labels:       info.Labels,
+			Reliability:  info.Reliability,
+			ConnectCount: info.ConnectCount,
+			LastSeen:     info.LastSeen,
+		})
+		if err != nil {
+			ps.mu.RUnlock()
+			return fmt.Errorf("failed to marshal peer %s: %v", id, err)
+		}
+		records[id.String()] = record
+	}
+	ps.mu.RUnlock()
+
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create peer store directory: %v", err)
+		}
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: openTimeout})
+	if errors.Is(err, bolt.ErrInvalid) {
+		log.Printf("Replacing %s, which is not a peer store database\n", path)
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to replace peer store: %v", err)
+		}
+		db, err = bolt.Open(path, 0600, &bolt.Options{Timeout: openTimeout})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open peer store: %v", err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(metaBucket)
+		if err != nil {
+			return err
+		}
+		if err := meta.Put(versionKey, []byte(strconv.Itoa(peerStoreVersion))); err != nil {
+			return err
+		}
+
+		peers, err := tx.CreateBucketIfNotExists(peersBucket)
+		if err != nil {
+			return err
+		}
+		var removed [][]byte
+		if err := peers.ForEach(func(k, v []byte) error {
+			if _, exists := records[string(k)]; !exists {
+				removed = append(removed, k)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		for _, k := range removed {
+			if err := peers.Delete(k); err != nil {
+				return err
+			}
+		}
+		for id, record := range records {
+			if err := peers.Put([]byte(id), record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write peer store: %v", err)
+	}
+	return nil
+}
+
+// Load adds the peers saved in a database to the store, skipping peers not
+// seen within maxAge (0 = keep all). When the saved peers don't all fit, the
+// ones the store would evict last are kept. A missing file is not an error.
+func (ps *PeerStore) Load(path string, maxAge time.Duration) (int, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return 0, nil
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: openTimeout, ReadOnly: true})
+	if err != nil {
+		return 0, fmt.Errorf("failed to open peer store: %v", err)
+	}
+	defer db.Close()
+
+	var records []persistedPeer
+	err = db.View(func(tx *bolt.Tx) error {
+		if meta := tx.Bucket(metaBucket); meta != nil {
+			if version := string(meta.Get(versionKey)); version != strconv.Itoa(peerStoreVersion) {
+				return fmt.Errorf("unsupported peer store version: %s", version)
+			}
+		}
+
+		peers := tx.Bucket(peersBucket)
+		if peers == nil {
+			return nil
+		}
+		return peers.ForEach(func(k, v []byte) error {
+			var record persistedPeer
+			if err := json.Unmarshal(v, &record); err != nil {
+				log.Printf("Skipping unreadable saved peer %s: %v\n", k, err)
+				return nil
+			}
+			records = append(records, record)
+			return nil
+		})
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to read peer store: %v", err)
+	}
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	var candidates []*PeerInfo
+	for _, saved := range records {
+		if maxAge > 0 && time.Since(saved.LastSeen) > maxAge {
+			continue
+		}
+
+		id, err := peer.Decode(saved.ID)
+		if err != nil {
+			log.Printf("Skipping saved peer with invalid ID %s: %v\n", saved.ID, err)
+			continue
+		}
+		if _, exists := ps.peers[id]; exists {
+			continue // Information found since start is more recent
+		}
+
+		var addrs []multiaddr.Multiaddr
+		for _, addrStr := range saved.Addrs {
+			addr, err := multiaddr.NewMultiaddr(addrStr)
+			if err != nil {
+				continue
+			}
+			addrs = append(addrs, addr)
+		}
+		if len(addrs) == 0 {
+			continue
+		}
+
+		candidates = append(candidates, &PeerInfo{
+			AddrInfo:     peer.AddrInfo{ID: id, Addrs: addrs},
+			LastSeen:     saved.LastSeen,
+			Source:       saved.Source,
+			Status:       PeerStatusUnknown,
+			Services:     append([]string{}, saved.Services...),
+			Labels:       saved.Labels,
+			Reliability:  saved.Reliability,
+			ConnectCount: saved.ConnectCount,
+		})
+	}
+
+	// Most valuable first, in case the store fills up
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a := ps.retentionLocked(candidates[i].AddrInfo.ID, candidates[i])
+		b := ps.retentionLocked(candidates[j].AddrInfo.ID, candidates[j])
+		if a != b {
+			return a > b
+		}
+		return candidates[i].LastSeen.After(candidates[j].LastSeen)
+	})
+
+	loaded := 0
+	for _, info := range candidates {
+		if len(ps.peers) >= ps.maxPeers {
+			break
+		}
+		if _, exists := ps.peers[info.AddrInfo.ID]; exists {
+			continue // Same peer saved under another key
+		}
+		ps.peers[info.AddrInfo.ID] = info
+		loaded++
+	}
+
+	return loaded, nil
+}
+
+// EnablePersistence saves the peer store periodically and on Stop, loads the
+// peers saved by a previous run and redials the reliable ones. A file that
+// isn't a peer store database is reported and replaced by the next save.
+func (dm *DiscoveryManager) EnablePersistence(config PersistenceConfig) error {
+	if config.SaveInterval <= 0 {
+		config.SaveInterval = time.Minute
+	}
+
+	dm.mu.Lock()
+	dm.persistence = &config
+	dm.mu.Unlock()
+	go dm.periodicSave(config)
+
+	loaded, err := dm.peerStore.Load(config.Path, config.MaxAge)
+	if err != nil {
+		return err
+	}
+	log.Printf("Loaded %d peers from %s\n", loaded, config.Path)
+
+	go dm.redialKnownPeers()
+	return nil
+}
+
+// redialKnownPeers connects to the most reliable peers known from a previous run
+func (dm *DiscoveryManager) redialKnownPeers() {
+	var candidates []*PeerInfo
+	for _, info := range dm.peerStore.GetAllPeers() {
+		if info.Reliability >= redialMinReliability && info.AddrInfo.ID != dm.host.ID() {
+			candidates = append(candidates, info)
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Reliability != candidates[j].Reliability {
+			return candidates[i].Reliability > candidates[j].Reliability
+		}
+		return candidates[i].LastSeen.After(candidates[j].LastSeen)
+	})
+	if len(candidates) > redialMaxPeers {
+		candidates = candidates[:redialMaxPeers]
+	}
+
+	for _, info := range candidates {
+		go func(ai peer.AddrInfo) {
+			ctx, cancel := context.WithTimeout(dm.ctx, redialTimeout)
+			defer cancel()
+
+			if err := dm.host.Connect(ctx, ai); err != nil {
+				dm.peerStore.UpdatePeerStatus(ai.ID, PeerStatusUnreachable, err)
+				return
+			}
+			dm.peerStore.UpdatePeerStatus(ai.ID, PeerStatusConnected, nil)
+			log.Printf("Reconnected to known peer %s\n", ai.ID.String())
+		}(info.AddrInfo)
+	}
+}
+
+// periodicSave saves the peer store until the discovery manager stops
+func (dm *DiscoveryManager) periodicSave(config PersistenceConfig) {
+	ticker := time.NewTicker(config.SaveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-dm.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := dm.peerStore.Save(config.Path); err != nil {
+				log.Printf("Failed to save peer store: %v\n", err)
+			}
+		}
+	}
+}
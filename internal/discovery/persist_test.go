@@ -0,0 +1,131 @@
+package discovery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/test"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// TestPeerStorePersistence tests that saved peers are reloaded and stale ones aged out
+func TestPeerStorePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers.db")
+	addr := multiaddr.StringCast("/ip4/127.0.0.1/tcp/4001")
+
+	fresh, err := test.RandPeerID()
+	if err != nil {
+		t.Fatalf("Failed to create peer ID: %v", err)
+	}
+	stale, err := test.RandPeerID()
+	if err != nil {
+		t.Fatalf("Failed to create peer ID: %v", err)
+	}
+
+	ps := NewPeerStore(10, time.Minute)
+	ps.AddPeer(peer.AddrInfo{ID: fresh, Addrs: []multiaddr.Multiaddr{addr}}, "mdns")
+	ps.AddPeer(peer.AddrInfo{ID: stale, Addrs: []multiaddr.Multiaddr{addr}}, "dht")
+	ps.UpdatePeerServices(fresh, []string{"echo"})
+	ps.UpdatePeerStatus(fresh, PeerStatusConnected, nil)
+	ps.peers[stale].LastSeen = time.Now().Add(-48 * time.Hour)
+
+	if err := ps.Save(path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	restored := NewPeerStore(10, time.Minute)
+	loaded, err := restored.Load(path, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if loaded != 1 {
+		t.Fatalf("Expected 1 peer to be loaded, got %d", loaded)
+	}
+
+	info, exists := restored.GetAllPeers()[fresh]
+	if !exists {
+		t.Fatal("Expected fresh peer to be restored")
+	}
+	if info.Source != "mdns" || len(info.Services) != 1 || info.Services[0] != "echo" {
+		t.Errorf("Unexpected restored peer: %+v", info)
+	}
+	if info.Reliability != ps.peers[fresh].Reliability || len(info.AddrInfo.Addrs) != 1 {
+		t.Errorf("Expected reliability and addresses to be restored, got %+v", info)
+	}
+	if info.Status != PeerStatusUnknown {
+		t.Errorf("Expected restored peer status to be unknown until redialed, got %v", info.Status)
+	}
+}
+
+// TestPeerStoreLoadKeepsBest tests that when saved peers don't fit, the most
+// valuable ones are loaded
+func TestPeerStoreLoadKeepsBest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers.db")
+	addr := multiaddr.StringCast("/ip4/127.0.0.1/tcp/4001")
+
+	ps := NewPeerStore(10, time.Minute)
+	reliability := map[peer.ID]float64{}
+	for i, value := range []float64{0.2, 0.9, 0.1, 0.8, 0.3} {
+		id := newTestPeerID(t)
+		ps.AddPeer(peer.AddrInfo{ID: id, Addrs: []multiaddr.Multiaddr{addr}}, "mdns")
+		ps.peers[id].Reliability = value
+		ps.peers[id].LastSeen = time.Now().Add(-time.Duration(i) * time.Minute)
+		reliability[id] = value
+	}
+	if err := ps.Save(path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	restored := NewPeerStore(2, time.Minute)
+	if loaded, err := restored.Load(path, 0); err != nil || loaded != 2 {
+		t.Fatalf("Expected 2 peers to be loaded, got %d, %v", loaded, err)
+	}
+	for id := range restored.GetAllPeers() {
+		if reliability[id] < 0.8 {
+			t.Errorf("Expected only the most reliable peers, loaded one with reliability %f", reliability[id])
+		}
+	}
+}
+
+// TestPeerStoreLoadMissingFile tests that a first start without a saved store succeeds
+func TestPeerStoreLoadMissingFile(t *testing.T) {
+	ps := NewPeerStore(10, time.Minute)
+	loaded, err := ps.Load(filepath.Join(t.TempDir(), "missing.db"), 0)
+	if err != nil || loaded != 0 {
+		t.Fatalf("Expected no peers and no error, got %d, %v", loaded, err)
+	}
+}
+
+// TestPeerStoreSaveReplaces tests that saving drops peers no longer in the
+// store and replaces a file that isn't a peer store database
+func TestPeerStoreSaveReplaces(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers.db")
+	if err := os.WriteFile(path, []byte(`{"version": 1, "peers": []}`), 0644); err != nil {
+		t.Fatalf("Failed to write peer store file: %v", err)
+	}
+	addr := multiaddr.StringCast("/ip4/127.0.0.1/tcp/4001")
+
+	ps := NewPeerStore(10, time.Minute)
+	kept, removed := newTestPeerID(t), newTestPeerID(t)
+	ps.AddPeer(peer.AddrInfo{ID: kept, Addrs: []multiaddr.Multiaddr{addr}}, "mdns")
+	ps.AddPeer(peer.AddrInfo{ID: removed, Addrs: []multiaddr.Multiaddr{addr}}, "mdns")
+	if err := ps.Save(path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	ps.RemovePeer(removed, "test")
+	if err := ps.Save(path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	restored := NewPeerStore(10, time.Minute)
+	if loaded, err := restored.Load(path, 0); err != nil || loaded != 1 {
+		t.Fatalf("Expected 1 peer to be loaded, got %d, %v", loaded, err)
+	}
+	if _, exists := restored.GetAllPeers()[kept]; !exists {
+		t.Error("Expected the remaining peer to be restored")
+	}
+}
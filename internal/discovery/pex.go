@@ -0,0 +1,388 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+	rprotocol "github.com/realentity/realentity-node/internal/protocol"
+	"github.com/realentity/realentity-node/internal/utils"
+)
+
+// Limits applied to peer exchange messages
+const (
+	pexStreamTimeout   = 10 * time.Second
+	maxPEXMessageBytes = 64 * 1024
+	maxPEXAddrsPerPeer = 8
+	maxPEXLearned      = 256              // Peers remembered for FindPeers
+	maxPEXLearnedAge   = 10 * time.Minute // How long a learned peer is returned by FindPeers
+	maxPEXHints        = 16               // Service hints accepted per peer
+	maxPEXHintLength   = 64
+)
+
+// PEXConfig contains settings for peer exchange
+type PEXConfig struct {
+	Interval        time.Duration // How often connected peers are asked for their peers
+	Fanout          int           // Connected peers asked per round
+	SampleSize      int           // Peers shared per response, and accepted from one
+	MinScore        float64       // Peers scoring lower are not shared
+	RequestInterval time.Duration // Minimum time between requests served to one peer
+}
+
+// DefaultPEXConfig returns the settings used when peer exchange is enabled without settings
+func DefaultPEXConfig() *PEXConfig {
+	return &PEXConfig{
+		Interval:        time.Minute,
+		Fanout:          3,
+		SampleSize:      16,
+		MinScore:        0.4,
+		RequestInterval: 30 * time.Second,
+	}
+}
+
+// withDefaults fills unset fields from the default configuration
+func (c *PEXConfig) withDefaults() *PEXConfig {
+	defaults := DefaultPEXConfig()
+	if c == nil {
+		return defaults
+	}
+
+	result := *c
+	if result.Interval <= 0 {
+		result.Interval = defaults.Interval
+	}
+	if result.Fanout <= 0 {
+		result.Fanout = defaults.Fanout
+	}
+	if result.SampleSize <= 0 {
+		result.SampleSize = defaults.SampleSize
+	}
+	if result.MinScore <= 0 {
+		result.MinScore = defaults.MinScore
+	}
+	if result.RequestInterval <= 0 {
+		result.RequestInterval = defaults.RequestInterval
+	}
+	return &result
+}
+
+// PEXPeer is a peer shared over peer exchange. The services the sender
+// knows for the peer are shared as hints only: a peer's services are only
+// trusted when the peer describes itself.
+type PEXPeer struct {
+	ID           string   `json:"id"`
+	Addrs        []string `json:"addrs"`
+	Score        float64  `json:"score"`                   // The sender's score for the peer, for information only
+	ServiceHints []string `json:"service_hints,omitempty"` // Unverified until the peer describes itself
+}
+
+// learnedPeer is a peer learned over peer exchange
+type learnedPeer struct {
+	addrInfo peer.AddrInfo
+	learned  time.Time
+}
+
+// pexResponse is the message answering a peer exchange request
+type pexResponse struct {
+	Peers []PEXPeer `json:"peers"`
+}
+
+// PEXDiscovery shares good peers with connected peers and learns theirs.
+// Received peers are checked before use: only peers the node doesn't know
+// yet are added, and addresses that could not belong to them are dropped.
+type PEXDiscovery struct {
+	dm      *DiscoveryManager
+	config  *PEXConfig
+	served  map[peer.ID]time.Time // Last request served per peer
+	learned map[peer.ID]learnedPeer
+	mu      sync.Mutex
+}
+
+// NewPEXDiscovery creates a peer exchange mechanism for the discovery manager
+func NewPEXDiscovery(dm *DiscoveryManager, config *PEXConfig) *PEXDiscovery {
+	return &PEXDiscovery{
+		dm:      dm,
+		config:  config.withDefaults(),
+		served:  make(map[peer.ID]time.Time),
+		learned: make(map[peer.ID]learnedPeer),
+	}
+}
+
+func (pd *PEXDiscovery) Name() string {
+	return "pex"
+}
+
+func (pd *PEXDiscovery) Start(ctx context.Context) error {
+	pd.dm.host.SetStreamHandler(protocol.ID(rprotocol.PEXProtocolID), pd.handleStream)
+	go pd.exchangeLoop(ctx)
+
+	log.Printf("Peer exchange started (interval: %v, sample size: %d)\n", pd.config.Interval, pd.config.SampleSize)
+	return nil
+}
+
+func (pd *PEXDiscovery) Stop() error {
+	pd.dm.host.RemoveStreamHandler(protocol.ID(rprotocol.PEXProtocolID))
+	log.Println("Peer exchange stopped")
+	return nil
+}
+
+// FindPeers returns peers recently learned from other peers
+func (pd *PEXDiscovery) FindPeers(ctx context.Context, limit int) ([]peer.AddrInfo, error) {
+	pd.mu.Lock()
+	defer pd.mu.Unlock()
+
+	pd.pruneLearnedLocked()
+	var found []peer.AddrInfo
+	for _, lp := range pd.learned {
+		if len(found) >= limit {
+			break
+		}
+		found = append(found, lp.addrInfo)
+	}
+	return found, nil
+}
+
+// pruneLearnedLocked forgets learned peers that are too old or that the peer
+// store no longer holds, so that evicted and expired peers aren't added
+// again. Must be called with pd.mu held.
+func (pd *PEXDiscovery) pruneLearnedLocked() {
+	for id, lp := range pd.learned {
+		if time.Since(lp.learned) >= maxPEXLearnedAge || !pd.dm.peerStore.HasPeer(id) {
+			delete(pd.learned, id)
+		}
+	}
+}
+
+// exchangeLoop asks a few random connected peers for their peers every interval
+func (pd *PEXDiscovery) exchangeLoop(ctx context.Context) {
+	ticker := time.NewTicker(pd.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pd.pruneServed()
+
+			peers := pd.dm.host.Network().Peers()
+			rand.Shuffle(len(peers), func(i, j int) { peers[i], peers[j] = peers[j], peers[i] })
+			if len(peers) > pd.config.Fanout {
+				peers = peers[:pd.config.Fanout]
+			}
+			for _, peerID := range peers {
+				go func(id peer.ID) {
+					_, err := pd.Exchange(ctx, id)
+					if err != nil {
+						log.Printf("Peer exchange with %s failed: %v\n", utils.FormatPeerID(id), err)
+						err = fmt.Errorf("exchange with %s failed: %v", utils.FormatPeerID(id), err)
+					}
+					pd.dm.recordRun(pd.Name(), err)
+				}(peerID)
+			}
+		}
+	}
+}
+
+// Exchange asks a connected peer for its peers and adds the acceptable ones
+// to the discovery manager, returning how many were new
+func (pd *PEXDiscovery) Exchange(ctx context.Context, peerID peer.ID) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, pexStreamTimeout)
+	defer cancel()
+
+	stream, err := pd.dm.host.NewStream(ctx, peerID, protocol.ID(rprotocol.PEXProtocolID))
+	if err != nil {
+		return 0, err
+	}
+	defer stream.Close()
+	stream.SetDeadline(time.Now().Add(pexStreamTimeout))
+
+	var response pexResponse
+	if err := json.NewDecoder(io.LimitReader(stream, maxPEXMessageBytes)).Decode(&response); err != nil {
+		stream.Reset()
+		return 0, fmt.Errorf("failed to read peer exchange response: %v", err)
+	}
+
+	senderAddr := stream.Conn().RemoteMultiaddr()
+	added := 0
+	for i, shared := range response.Peers {
+		if i >= pd.config.SampleSize {
+			break // A well-behaved peer never sends more
+		}
+
+		ai, ok := pd.sanitize(shared, peerID, senderAddr)
+		if !ok {
+			continue
+		}
+
+		pd.dm.handleFoundPeer(ai, pd.Name())
+		if hints := sanitizeHints(shared.ServiceHints); len(hints) > 0 {
+			pd.dm.peerStore.SetServiceHints(ai.ID, hints)
+		}
+
+		pd.mu.Lock()
+		if len(pd.learned) >= maxPEXLearned {
+			pd.pruneLearnedLocked()
+		}
+		if len(pd.learned) < maxPEXLearned {
+			pd.learned[ai.ID] = learnedPeer{addrInfo: ai, learned: time.Now()}
+		}
+		pd.mu.Unlock()
+		added++
+	}
+
+	if added > 0 {
+		log.Printf("Learned %d peers from %s via peer exchange\n", added, utils.FormatPeerID(peerID))
+	}
+	return added, nil
+}
+
+// sanitize checks a shared peer and keeps only the addresses it could be
+// reached at. Known peers are rejected so that a peer can't redirect traffic
+// for them to other addresses. The shared score is ignored, since the sender
+// chooses it.
+func (pd *PEXDiscovery) sanitize(shared PEXPeer, sender peer.ID, senderAddr multiaddr.Multiaddr) (peer.AddrInfo, bool) {
+	id, err := peer.Decode(shared.ID)
+	if err != nil || id == pd.dm.host.ID() || id == sender {
+		return peer.AddrInfo{}, false
+	}
+	if pd.dm.peerStore.HasPeer(id) {
+		return peer.AddrInfo{}, false
+	}
+
+	ai := peer.AddrInfo{ID: id}
+	for i, addrStr := range shared.Addrs {
+		if i >= maxPEXAddrsPerPeer {
+			break
+		}
+		addr, err := multiaddr.NewMultiaddr(addrStr)
+		if err != nil || !acceptablePEXAddr(addr, senderAddr) {
+			continue
+		}
+		ai.Addrs = append(ai.Addrs, addr)
+	}
+	return ai, len(ai.Addrs) > 0
+}
+
+// sanitizeHints keeps a limited number of plausible service names
+func sanitizeHints(hints []string) []string {
+	var kept []string
+	for _, hint := range hints {
+		if len(kept) >= maxPEXHints {
+			break
+		}
+		if hint == "" || len(hint) > maxPEXHintLength || containsString(kept, hint) {
+			continue
+		}
+		kept = append(kept, hint)
+	}
+	return kept
+}
+
+// acceptablePEXAddr reports whether a shared address is usable. Loopback and
+// private addresses are only accepted from a sender in the same kind of
+// network, since they mean something else everywhere else.
+func acceptablePEXAddr(addr, senderAddr multiaddr.Multiaddr) bool {
+	if _, err := addr.ValueForProtocol(multiaddr.P_P2P); err == nil {
+		return false // Peer IDs belong in PEXPeer.ID
+	}
+	if manet.IsIPUnspecified(addr) {
+		return false
+	}
+
+	switch {
+	case manet.IsIPLoopback(addr):
+		return manet.IsIPLoopback(senderAddr)
+	case manet.IsPrivateAddr(addr):
+		return manet.IsPrivateAddr(senderAddr)
+	default:
+		return manet.IsPublicAddr(addr)
+	}
+}
+
+// handleStream answers a peer exchange request with a sample of good peers
+func (pd *PEXDiscovery) handleStream(stream network.Stream) {
+	defer stream.Close()
+
+	requester := stream.Conn().RemotePeer()
+	pd.mu.Lock()
+	last, served := pd.served[requester]
+	limited := served && time.Since(last) < pd.config.RequestInterval
+	if !limited {
+		pd.served[requester] = time.Now()
+	}
+	pd.mu.Unlock()
+
+	if limited {
+		stream.Reset()
+		return
+	}
+
+	stream.SetDeadline(time.Now().Add(pexStreamTimeout))
+	response := pexResponse{Peers: pd.Sample(requester)}
+	if err := json.NewEncoder(stream).Encode(response); err != nil {
+		log.Printf("Failed to send peer exchange response: %v\n", err)
+	}
+}
+
+// Sample returns a random selection of good peers to share with a peer.
+// Good peers are ones the node connected to with at least the minimum score.
+func (pd *PEXDiscovery) Sample(requester peer.ID) []PEXPeer {
+	var good []PEXPeer
+	for id, info := range pd.dm.peerStore.GetAllPeers() {
+		if id == requester || len(info.AddrInfo.Addrs) == 0 {
+			continue
+		}
+		if info.Status != PeerStatusConnected && info.Status != PeerStatusConnectable {
+			continue
+		}
+		if info.Score() < pd.config.MinScore {
+			continue
+		}
+
+		shared := PEXPeer{
+			ID:    id.String(),
+			Score: info.Score(),
+		}
+		for _, addr := range info.AddrInfo.Addrs {
+			if len(shared.Addrs) >= maxPEXAddrsPerPeer {
+				break
+			}
+			shared.Addrs = append(shared.Addrs, addr.String())
+		}
+		if len(info.Services) > maxPEXHints {
+			shared.ServiceHints = info.Services[:maxPEXHints]
+		} else {
+			shared.ServiceHints = info.Services
+		}
+		good = append(good, shared)
+	}
+
+	rand.Shuffle(len(good), func(i, j int) { good[i], good[j] = good[j], good[i] })
+	if len(good) > pd.config.SampleSize {
+		good = good[:pd.config.SampleSize]
+	}
+	return good
+}
+
+// pruneServed forgets requesters that are no longer rate limited
+func (pd *PEXDiscovery) pruneServed() {
+	pd.mu.Lock()
+	defer pd.mu.Unlock()
+
+	for id, last := range pd.served {
+		if time.Since(last) >= pd.config.RequestInterval {
+			delete(pd.served, id)
+		}
+	}
+}
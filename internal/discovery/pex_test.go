@@ -0,0 +1,169 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// startPEXPeer starts a discovery manager running only peer exchange
+func startPEXPeer(t *testing.T) (*DiscoveryManager, *PEXDiscovery) {
+	dm := NewDiscoveryManager(newTestHost(t))
+	pex := NewPEXDiscovery(dm, nil)
+	dm.AddMechanism(pex)
+	if err := dm.Start(); err != nil {
+		t.Fatalf("Failed to start discovery: %v", err)
+	}
+	t.Cleanup(func() { dm.Stop() })
+	return dm, pex
+}
+
+// TestPeerExchange tests that a node learns the good peers of a connected
+// peer, keeping the services the peer claims they provide as hints only
+func TestPeerExchange(t *testing.T) {
+	hub, _ := startPEXPeer(t)
+	seeker, seekerPEX := startPEXPeer(t)
+	other := newTestHost(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// The hub knows and is connected to the other peer
+	otherInfo := peer.AddrInfo{ID: other.ID(), Addrs: other.Addrs()}
+	hub.HandleFoundPeer(otherInfo, "mdns")
+	if err := hub.host.Connect(ctx, otherInfo); err != nil {
+		t.Fatalf("Failed to connect hub to other peer: %v", err)
+	}
+	hub.UpdatePeerServices(other.ID(), []string{"echo"})
+
+	if err := seeker.host.Connect(ctx, peer.AddrInfo{ID: hub.host.ID(), Addrs: hub.host.Addrs()}); err != nil {
+		t.Fatalf("Failed to connect to hub: %v", err)
+	}
+
+	// Wait for the connection notification to mark the other peer connected
+	for hub.GetPeers()[other.ID()].Status != PeerStatusConnected {
+		if ctx.Err() != nil {
+			t.Fatalf("Other peer never marked connected")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	added, err := seekerPEX.Exchange(ctx, hub.host.ID())
+	if err != nil {
+		t.Fatalf("Peer exchange failed: %v", err)
+	}
+	if added != 1 {
+		t.Fatalf("Expected to learn 1 peer, learned %d", added)
+	}
+
+	info, exists := seeker.GetPeers()[other.ID()]
+	if !exists || info.Source != "pex" || len(info.Services) != 0 {
+		t.Errorf("Expected other peer learned via pex without services, got %+v", info)
+	}
+	if len(info.ServiceHints) != 1 || info.ServiceHints[0] != "echo" {
+		t.Errorf("Expected service hint echo, got %v", info.ServiceHints)
+	}
+
+	// The peer describing itself replaces the hints
+	seeker.UpdatePeerServices(other.ID(), []string{"time"})
+	info = seeker.GetPeers()[other.ID()]
+	if len(info.Services) != 1 || info.Services[0] != "time" || len(info.ServiceHints) != 0 {
+		t.Errorf("Expected confirmed services to replace hints, got %v and %v", info.Services, info.ServiceHints)
+	}
+
+	// A second request within the rate limit is refused
+	if _, err := seekerPEX.Exchange(ctx, hub.host.ID()); err == nil {
+		t.Errorf("Expected rate limited request to fail")
+	}
+}
+
+// TestPEXSanitize tests that shared peers that could poison the peer store are rejected
+func TestPEXSanitize(t *testing.T) {
+	dm := NewDiscoveryManager(newTestHost(t))
+	pex := NewPEXDiscovery(dm, nil)
+
+	sender, known, fresh := newTestPeerID(t), newTestPeerID(t), newTestPeerID(t)
+	dm.HandleFoundPeer(peer.AddrInfo{ID: known, Addrs: []multiaddr.Multiaddr{
+		multiaddr.StringCast("/ip4/1.2.3.4/tcp/4001"),
+	}}, "bootstrap")
+
+	publicSender := multiaddr.StringCast("/ip4/8.8.8.8/tcp/4001")
+	shared := func(id peer.ID, score float64, addrs ...string) PEXPeer {
+		return PEXPeer{ID: id.String(), Score: score, Addrs: addrs}
+	}
+
+	rejected := map[string]PEXPeer{
+		"known peer":    shared(known, 0.9, "/ip4/5.6.7.8/tcp/4001"),
+		"sender itself": shared(sender, 0.9, "/ip4/5.6.7.8/tcp/4001"),
+		"ourselves":     shared(dm.host.ID(), 0.9, "/ip4/5.6.7.8/tcp/4001"),
+		"no usable address": shared(fresh, 0.9,
+			"/ip4/127.0.0.1/tcp/4001", "/ip4/10.0.0.1/tcp/4001", "/ip4/0.0.0.0/tcp/4001",
+			"/ip4/5.6.7.8/tcp/4001/p2p/"+known.String(), "garbage"),
+		"invalid ID": {ID: "not-a-peer", Score: 0.9, Addrs: []string{"/ip4/5.6.7.8/tcp/4001"}},
+	}
+	for name, p := range rejected {
+		if _, ok := pex.sanitize(p, sender, publicSender); ok {
+			t.Errorf("Expected %s to be rejected", name)
+		}
+	}
+
+	ai, ok := pex.sanitize(shared(fresh, 0.9, "/ip4/10.0.0.1/tcp/4001", "/ip4/5.6.7.8/tcp/4001"), sender, publicSender)
+	if !ok || len(ai.Addrs) != 1 || ai.Addrs[0].String() != "/ip4/5.6.7.8/tcp/4001" {
+		t.Errorf("Expected only the public address to be kept, got %v", ai.Addrs)
+	}
+
+	// A sender on the same private network may share private addresses
+	privateSender := multiaddr.StringCast("/ip4/10.0.0.9/tcp/4001")
+	if ai, ok := pex.sanitize(shared(fresh, 0.9, "/ip4/10.0.0.1/tcp/4001"), sender, privateSender); !ok || len(ai.Addrs) != 1 {
+		t.Errorf("Expected private address from private sender to be kept, got %v", ai.Addrs)
+	}
+}
+
+// TestPEXLearnedPruned tests that learned peers stop being returned once the
+// peer store drops them or they grow too old
+func TestPEXLearnedPruned(t *testing.T) {
+	dm := NewDiscoveryManager(newTestHost(t))
+	pex := NewPEXDiscovery(dm, nil)
+
+	kept, evicted, old := newTestPeerID(t), newTestPeerID(t), newTestPeerID(t)
+	addrs := []multiaddr.Multiaddr{multiaddr.StringCast("/ip4/5.6.7.8/tcp/4001")}
+	for _, id := range []peer.ID{kept, evicted, old} {
+		ai := peer.AddrInfo{ID: id, Addrs: addrs}
+		dm.HandleFoundPeer(ai, "pex")
+		pex.learned[id] = learnedPeer{addrInfo: ai, learned: time.Now()}
+	}
+	pex.learned[old] = learnedPeer{addrInfo: pex.learned[old].addrInfo, learned: time.Now().Add(-maxPEXLearnedAge)}
+	dm.RemovePeer(evicted, "removed")
+
+	found, err := pex.FindPeers(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("Failed to find peers: %v", err)
+	}
+	if len(found) != 1 || found[0].ID != kept {
+		t.Errorf("Expected only the kept peer, got %v", found)
+	}
+	if len(pex.learned) != 1 {
+		t.Errorf("Expected pruned peers to be forgotten, %d remembered", len(pex.learned))
+	}
+}
+
+// TestSanitizeHints tests that service hints are limited and deduplicated
+func TestSanitizeHints(t *testing.T) {
+	long := string(make([]byte, maxPEXHintLength+1))
+	hints := sanitizeHints([]string{"echo", "", long, "echo", "time"})
+	if len(hints) != 2 || hints[0] != "echo" || hints[1] != "time" {
+		t.Errorf("Expected echo and time, got %v", hints)
+	}
+
+	many := make([]string, 0, maxPEXHints+5)
+	for i := 0; i < maxPEXHints+5; i++ {
+		many = append(many, fmt.Sprintf("service-%d", i))
+	}
+	if hints := sanitizeHints(many); len(hints) != maxPEXHints {
+		t.Errorf("Expected %d hints, got %d", maxPEXHints, len(hints))
+	}
+}
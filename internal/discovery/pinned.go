@@ -0,0 +1,98 @@
+package discovery
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/realentity/realentity-node/internal/utils"
+)
+
+// Connection manager tags protecting peers from being trimmed
+const (
+	ProtectTagBootstrap = "realentity-bootstrap"
+	ProtectTagPinned    = "realentity-pinned"
+)
+
+// Timing of pinned peer connections
+const (
+	pinnedDialTimeout   = 15 * time.Second
+	pinnedCheckInterval = 30 * time.Second
+)
+
+// PinPeer keeps a peer connected until it is unpinned: the connection is
+// protected from the connection manager, and the peer is redialed whenever it
+// is lost, whatever the auto-dial target and even if the peer store forgets it
+func (dm *DiscoveryManager) PinPeer(addrInfo peer.AddrInfo) {
+	dm.mu.Lock()
+	if existing, exists := dm.pinned[addrInfo.ID]; exists {
+		addrInfo.Addrs = removeDuplicateAddrs(append(existing.Addrs, addrInfo.Addrs...))
+	}
+	dm.pinned[addrInfo.ID] = addrInfo
+	dm.mu.Unlock()
+
+	dm.host.ConnManager().Protect(addrInfo.ID, ProtectTagPinned)
+	dm.handleFoundPeer(addrInfo, "pinned")
+	log.Printf("Pinned peer: %s\n", utils.FormatPeerID(addrInfo.ID))
+
+	go dm.connectPinned(addrInfo.ID)
+}
+
+// UnpinPeer lets the connection manager trim the connection to a peer again,
+// unless it is protected for another reason, and stops redialing it
+func (dm *DiscoveryManager) UnpinPeer(peerID peer.ID) {
+	dm.mu.Lock()
+	delete(dm.pinned, peerID)
+	dm.mu.Unlock()
+
+	dm.host.ConnManager().Unprotect(peerID, ProtectTagPinned)
+}
+
+// IsProtected reports whether the connection to a peer is protected from trimming
+func (dm *DiscoveryManager) IsProtected(peerID peer.ID) bool {
+	return dm.host.ConnManager().IsProtected(peerID, "")
+}
+
+// maintainPinned redials pinned peers as soon as their connection is lost,
+// and checks them every pinnedCheckInterval, until the manager stops
+func (dm *DiscoveryManager) maintainPinned() {
+	disconnects := dm.events.Subscribe(0, EventPeerDisconnected)
+	defer disconnects.Close()
+
+	ticker := time.NewTicker(pinnedCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-dm.ctx.Done():
+			return
+		case event := <-disconnects.C:
+			go dm.connectPinned(event.PeerID)
+		case <-ticker.C:
+			dm.mu.RLock()
+			for id := range dm.pinned {
+				go dm.connectPinned(id)
+			}
+			dm.mu.RUnlock()
+		}
+	}
+}
+
+// connectPinned connects to a pinned peer unless it is already connected.
+// Peers that aren't pinned are ignored.
+func (dm *DiscoveryManager) connectPinned(peerID peer.ID) {
+	dm.mu.RLock()
+	addrInfo, pinned := dm.pinned[peerID]
+	dm.mu.RUnlock()
+	if !pinned || dm.host.Network().Connectedness(peerID) == network.Connected {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(dm.ctx, pinnedDialTimeout)
+	defer cancel()
+	if err := dm.host.Connect(ctx, addrInfo); err != nil && dm.ctx.Err() == nil {
+		log.Printf("Failed to connect to pinned peer %s: %v\n", utils.FormatPeerID(peerID), err)
+	}
+}
@@ -0,0 +1,121 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/protocol/ping"
+	"github.com/realentity/realentity-node/internal/protocol"
+	"github.com/realentity/realentity-node/internal/utils"
+)
+
+const (
+	// DefaultProbeInterval is used when no probe interval is configured
+	DefaultProbeInterval = 30 * time.Second
+	// probeTimeout bounds a single probe of one peer
+	probeTimeout = 10 * time.Second
+)
+
+// PeerProber periodically measures latency and health of connected peers
+type PeerProber struct {
+	dm       *DiscoveryManager
+	client   *utils.ServiceClient
+	interval time.Duration
+}
+
+// NewPeerProber creates a prober for the peers known to the discovery
+// manager, querying them with client
+func NewPeerProber(dm *DiscoveryManager, client *utils.ServiceClient, interval time.Duration) *PeerProber {
+	if interval <= 0 {
+		interval = DefaultProbeInterval
+	}
+
+	return &PeerProber{
+		dm:       dm,
+		client:   client,
+		interval: interval,
+	}
+}
+
+// Start probes newly connected peers right away and all connected peers
+// periodically until ctx is cancelled
+func (pp *PeerProber) Start(ctx context.Context) {
+	ticker := time.NewTicker(pp.interval)
+	defer ticker.Stop()
+
+	connected := pp.dm.events.Subscribe(0, EventPeerConnected)
+	defer connected.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-connected.C:
+			go pp.ProbePeer(ctx, event.PeerID)
+		case <-ticker.C:
+			pp.probeAll(ctx)
+		}
+	}
+}
+
+// probeAll probes every connected peer concurrently
+func (pp *PeerProber) probeAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, peerID := range pp.dm.host.Network().Peers() {
+		wg.Add(1)
+		go func(id peer.ID) {
+			defer wg.Done()
+			pp.ProbePeer(ctx, id)
+		}(peerID)
+	}
+	wg.Wait()
+}
+
+// ProbePeer pings a peer and checks that it answers service queries
+func (pp *PeerProber) ProbePeer(ctx context.Context, peerID peer.ID) error {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	rtt, err := pp.ping(ctx, peerID)
+	if err == nil {
+		// Service level health check, which also refreshes the advertised services and labels
+		var description *protocol.PeerDescription
+		description, err = pp.client.DescribeRemotePeer(ctx, peerID)
+		if err == nil {
+			pp.dm.UpdatePeerServices(peerID, description.Services)
+			pp.dm.UpdatePeerLabels(peerID, description.Labels)
+		} else {
+			err = fmt.Errorf("health check failed: %v", err)
+		}
+	}
+
+	if !pp.dm.peerStore.HasPeer(peerID) {
+		pp.dm.peerStore.AddPeer(peer.AddrInfo{
+			ID:    peerID,
+			Addrs: pp.dm.host.Peerstore().Addrs(peerID),
+		}, "connection")
+	}
+	pp.dm.peerStore.RecordProbe(peerID, rtt, err)
+
+	if err != nil {
+		log.Printf("Probe of peer %s failed: %v\n", utils.FormatPeerID(peerID), err)
+	}
+	return err
+}
+
+// ping measures the round trip time to a peer using the libp2p ping protocol
+func (pp *PeerProber) ping(ctx context.Context, peerID peer.ID) (time.Duration, error) {
+	select {
+	case result := <-ping.Ping(ctx, pp.dm.host, peerID):
+		if result.Error != nil {
+			return 0, fmt.Errorf("ping failed: %v", result.Error)
+		}
+		return result.RTT, nil
+	case <-ctx.Done():
+		return 0, fmt.Errorf("ping failed: %v", ctx.Err())
+	}
+}
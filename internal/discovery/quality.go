@@ -0,0 +1,103 @@
+package discovery
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const (
+	// maxRTTSamples is the number of recent round trip times kept per peer
+	maxRTTSamples = 32
+	// scoreDecay controls how quickly old probe results lose weight
+	scoreDecay = 0.8
+	// referenceRTT is the round trip time at which a successful probe counts half
+	referenceRTT = time.Second
+)
+
+// PeerQuality tracks the results of probing a peer
+type PeerQuality struct {
+	RTTSamples []time.Duration // Recent round trip times, oldest first
+	Probes     int             // Total number of probes sent
+	Successes  int             // Number of successful probes
+	Score      float64         // Exponentially decayed probe score, 0.0 to 1.0
+	LastProbe  time.Time
+}
+
+// SuccessRate returns the fraction of probes that succeeded
+func (q PeerQuality) SuccessRate() float64 {
+	if q.Probes == 0 {
+		return 0
+	}
+	return float64(q.Successes) / float64(q.Probes)
+}
+
+// RTTPercentile returns the p-th percentile (0.0 to 1.0) of recent round trip times
+func (q PeerQuality) RTTPercentile(p float64) time.Duration {
+	if len(q.RTTSamples) == 0 {
+		return 0
+	}
+
+	sorted := append([]time.Duration(nil), q.RTTSamples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	index := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if index < 0 {
+		index = 0
+	}
+	if index >= len(sorted) {
+		index = len(sorted) - 1
+	}
+	return sorted[index]
+}
+
+// record folds a probe result into the quality metrics
+func (q *PeerQuality) record(rtt time.Duration, err error) {
+	outcome := 0.0
+	if err == nil {
+		q.Successes++
+		q.RTTSamples = append(q.RTTSamples, rtt)
+		if len(q.RTTSamples) > maxRTTSamples {
+			q.RTTSamples = append([]time.Duration(nil), q.RTTSamples[len(q.RTTSamples)-maxRTTSamples:]...)
+		}
+		// Fast peers score close to 1, slow ones progressively less
+		outcome = 1 / (1 + float64(rtt)/float64(referenceRTT))
+	}
+
+	if q.Probes == 0 {
+		q.Score = outcome
+	} else {
+		q.Score = scoreDecay*q.Score + (1-scoreDecay)*outcome
+	}
+	q.Probes++
+	q.LastProbe = time.Now()
+}
+
+// Score returns the best available quality estimate for the peer, preferring
+// probe results over the connection based reliability
+func (pi *PeerInfo) Score() float64 {
+	if pi.Quality.Probes > 0 {
+		return pi.Quality.Score
+	}
+	return pi.Reliability
+}
+
+// RecordProbe stores the result of a probe against a peer
+func (ps *PeerStore) RecordProbe(peerID peer.ID, rtt time.Duration, err error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	info, exists := ps.peers[peerID]
+	if !exists {
+		return
+	}
+
+	info.Quality.record(rtt, err)
+	info.LastError = err
+	if err == nil {
+		ps.setStatusLocked(peerID, info, PeerStatusConnected)
+		info.LastSeen = time.Now()
+	}
+}
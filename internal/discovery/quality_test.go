@@ -0,0 +1,65 @@
+package discovery
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// TestRTTPercentile tests percentile calculation over recent samples
+func TestRTTPercentile(t *testing.T) {
+	var quality PeerQuality
+	for i := 1; i <= 10; i++ {
+		quality.record(time.Duration(i)*time.Millisecond, nil)
+	}
+
+	if p50 := quality.RTTPercentile(0.5); p50 != 5*time.Millisecond {
+		t.Errorf("Expected p50 of 5ms, got %v", p50)
+	}
+	if p90 := quality.RTTPercentile(0.9); p90 != 9*time.Millisecond {
+		t.Errorf("Expected p90 of 9ms, got %v", p90)
+	}
+	if p99 := quality.RTTPercentile(0.99); p99 != 10*time.Millisecond {
+		t.Errorf("Expected p99 of 10ms, got %v", p99)
+	}
+}
+
+// TestRTTSampleWindow tests that only the most recent samples are kept
+func TestRTTSampleWindow(t *testing.T) {
+	var quality PeerQuality
+	for i := 0; i < maxRTTSamples+10; i++ {
+		quality.record(time.Millisecond, nil)
+	}
+
+	if len(quality.RTTSamples) != maxRTTSamples {
+		t.Errorf("Expected %d samples, got %d", maxRTTSamples, len(quality.RTTSamples))
+	}
+}
+
+// TestRecordProbeScore tests that failures pull the score down and successes restore it
+func TestRecordProbeScore(t *testing.T) {
+	ps := NewPeerStore(10, time.Minute)
+	peerID := peer.ID("test-peer")
+	ps.AddPeer(peer.AddrInfo{ID: peerID}, "test")
+
+	ps.RecordProbe(peerID, 10*time.Millisecond, nil)
+	healthy := ps.GetAllPeers()[peerID]
+	if healthy.Score() < 0.9 {
+		t.Errorf("Expected high score after fast probe, got %f", healthy.Score())
+	}
+	if healthy.Status != PeerStatusConnected {
+		t.Errorf("Expected connected status after successful probe, got %v", healthy.Status)
+	}
+
+	ps.RecordProbe(peerID, 0, errors.New("timeout"))
+	ps.RecordProbe(peerID, 0, errors.New("timeout"))
+	degraded := ps.GetAllPeers()[peerID]
+	if degraded.Score() >= healthy.Score() {
+		t.Errorf("Expected score to drop after failures, got %f", degraded.Score())
+	}
+	if rate := degraded.Quality.SuccessRate(); rate < 0.33 || rate > 0.34 {
+		t.Errorf("Expected success rate of 1/3, got %f", rate)
+	}
+}
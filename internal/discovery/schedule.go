@@ -0,0 +1,233 @@
+package discovery
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// ScheduleConfig decides when each discovery mechanism looks for peers.
+// Below TargetPeers connected peers, every mechanism runs every MinInterval.
+// Once the node has enough peers, a mechanism's interval starts at its
+// Interval and doubles after each round up to its MaxInterval. Losing a
+// connection while below the target starts a round right away.
+type ScheduleConfig struct {
+	TargetPeers int           // Connected peers the node should have
+	MinInterval time.Duration // Interval while below TargetPeers, and least time between triggered rounds
+
+	Defaults   MechanismSchedule            // Settings of mechanisms without their own
+	Mechanisms map[string]MechanismSchedule // Settings by mechanism name; unset fields use Defaults
+}
+
+// MechanismSchedule contains the settings of one discovery mechanism
+type MechanismSchedule struct {
+	Interval    time.Duration // Interval once the node has enough peers
+	MaxInterval time.Duration // Longest interval reached while the node has enough peers
+	Limit       int           // Peers asked for per round
+	Timeout     time.Duration // Time allowed for a round
+}
+
+// DefaultScheduleConfig returns the schedule used unless another one is set
+func DefaultScheduleConfig() *ScheduleConfig {
+	return &ScheduleConfig{
+		TargetPeers: DefaultDialPolicy().TargetPeers,
+		MinInterval: 10 * time.Second,
+		Defaults: MechanismSchedule{
+			Interval:    30 * time.Second,
+			MaxInterval: 5 * time.Minute,
+			Limit:       10,
+			Timeout:     10 * time.Second,
+		},
+	}
+}
+
+// withDefaults fills unset fields from the default schedule
+func (c *ScheduleConfig) withDefaults() *ScheduleConfig {
+	defaults := DefaultScheduleConfig()
+	if c == nil {
+		return defaults
+	}
+
+	result := *c
+	if result.TargetPeers <= 0 {
+		result.TargetPeers = defaults.TargetPeers
+	}
+	if result.MinInterval <= 0 {
+		result.MinInterval = defaults.MinInterval
+	}
+	result.Defaults = result.Defaults.withDefaults(defaults.Defaults)
+	return &result
+}
+
+// withDefaults fills unset fields from the given settings
+func (s MechanismSchedule) withDefaults(defaults MechanismSchedule) MechanismSchedule {
+	if s.Interval <= 0 {
+		s.Interval = defaults.Interval
+	}
+	if s.MaxInterval <= 0 {
+		s.MaxInterval = defaults.MaxInterval
+	}
+	if s.MaxInterval < s.Interval {
+		s.MaxInterval = s.Interval
+	}
+	if s.Limit <= 0 {
+		s.Limit = defaults.Limit
+	}
+	if s.Timeout <= 0 {
+		s.Timeout = defaults.Timeout
+	}
+	return s
+}
+
+// forMechanism returns the settings of a mechanism
+func (c *ScheduleConfig) forMechanism(name string) MechanismSchedule {
+	return c.Mechanisms[name].withDefaults(c.Defaults)
+}
+
+// nextInterval returns the wait before the next round of a mechanism, given
+// the previous wait and the number of connected peers
+func (c *ScheduleConfig) nextInterval(s MechanismSchedule, previous time.Duration, connected int) time.Duration {
+	if connected < c.TargetPeers {
+		if c.MinInterval < s.Interval {
+			return c.MinInterval
+		}
+		return s.Interval
+	}
+	if previous < s.Interval {
+		return s.Interval
+	}
+	if next := previous * 2; next < s.MaxInterval {
+		return next
+	}
+	return s.MaxInterval
+}
+
+// SetSchedule sets when the mechanisms look for peers. It must be called
+// before Start.
+func (dm *DiscoveryManager) SetSchedule(config *ScheduleConfig) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dm.schedule = config.withDefaults()
+}
+
+// scheduledMechanism is the schedule state of one mechanism
+type scheduledMechanism struct {
+	mechanism DiscoveryMechanism
+	settings  MechanismSchedule
+	interval  time.Duration
+	nextRun   time.Time
+	running   bool
+}
+
+// runSchedule runs every mechanism when it is due until the manager stops
+func (dm *DiscoveryManager) runSchedule() {
+	dm.mu.RLock()
+	schedule := dm.schedule
+	dm.mu.RUnlock()
+
+	disconnects := dm.events.Subscribe(0, EventPeerDisconnected)
+	defer disconnects.Close()
+
+	done := make(chan *scheduledMechanism)
+	scheduled := make(map[string]*scheduledMechanism)
+	var lastTriggered time.Time
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		now := time.Now()
+		connected := len(dm.host.Network().Peers())
+
+		// Pick up mechanisms added since the last pass
+		dm.mu.RLock()
+		for _, mechanism := range dm.mechanisms {
+			if _, exists := scheduled[mechanism.Name()]; exists {
+				continue
+			}
+			sm := &scheduledMechanism{mechanism: mechanism, settings: schedule.forMechanism(mechanism.Name())}
+			sm.interval = schedule.nextInterval(sm.settings, 0, connected)
+			sm.nextRun = now.Add(sm.interval)
+			scheduled[mechanism.Name()] = sm
+			dm.recordSchedule(mechanism.Name(), sm.interval, sm.nextRun)
+		}
+		dm.mu.RUnlock()
+
+		// Start due rounds and wait for the next one
+		var next time.Time
+		for _, sm := range scheduled {
+			if sm.running {
+				continue
+			}
+			if !sm.nextRun.After(now) {
+				sm.running = true
+				go func(sm *scheduledMechanism) {
+					dm.runMechanism(sm.mechanism, sm.settings)
+					select {
+					case done <- sm:
+					case <-dm.ctx.Done():
+					}
+				}(sm)
+				continue
+			}
+			if next.IsZero() || sm.nextRun.Before(next) {
+				next = sm.nextRun
+			}
+		}
+
+		wait := schedule.MinInterval // Also checks for new mechanisms
+		if !next.IsZero() && next.Sub(now) < wait {
+			wait = next.Sub(now)
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+
+		select {
+		case <-dm.ctx.Done():
+			return
+
+		case <-timer.C:
+
+		case sm := <-done:
+			sm.running = false
+			sm.interval = schedule.nextInterval(sm.settings, sm.interval, len(dm.host.Network().Peers()))
+			sm.nextRun = time.Now().Add(sm.interval)
+			dm.recordSchedule(sm.mechanism.Name(), sm.interval, sm.nextRun)
+
+		case <-disconnects.C:
+			// Look for peers right away when connectivity drops below the target
+			if len(dm.host.Network().Peers()) >= schedule.TargetPeers || time.Since(lastTriggered) < schedule.MinInterval {
+				continue
+			}
+			lastTriggered = time.Now()
+			log.Printf("Connected peers below target (%d), running discovery now\n", schedule.TargetPeers)
+			for _, sm := range scheduled {
+				if !sm.running {
+					sm.nextRun = lastTriggered
+				}
+			}
+		}
+	}
+}
+
+// runMechanism looks for peers with one mechanism and hands them to the manager
+func (dm *DiscoveryManager) runMechanism(m DiscoveryMechanism, settings MechanismSchedule) {
+	ctx, cancel := context.WithTimeout(dm.ctx, settings.Timeout)
+	defer cancel()
+
+	peers, err := m.FindPeers(ctx, settings.Limit)
+	dm.recordRun(m.Name(), err)
+	if err != nil {
+		log.Printf("Discovery mechanism %s failed: %v\n", m.Name(), err)
+		return
+	}
+
+	for _, peerInfo := range peers {
+		dm.handleFoundPeer(peerInfo, m.Name())
+	}
+}
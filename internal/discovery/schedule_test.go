@@ -0,0 +1,108 @@
+package discovery
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// TestNextInterval tests that mechanisms run every MinInterval below the
+// target and back off up to their maximum once the node has enough peers
+func TestNextInterval(t *testing.T) {
+	schedule := (&ScheduleConfig{
+		TargetPeers: 5,
+		MinInterval: 10 * time.Second,
+		Defaults:    MechanismSchedule{Interval: 30 * time.Second, MaxInterval: 100 * time.Second},
+		Mechanisms: map[string]MechanismSchedule{
+			"dht": {Interval: 5 * time.Second, Limit: 50},
+		},
+	}).withDefaults()
+
+	settings := schedule.forMechanism("mdns")
+	if settings.Interval != 30*time.Second || settings.Limit != 10 || settings.Timeout != 10*time.Second {
+		t.Errorf("Unexpected mdns settings: %+v", settings)
+	}
+	if dht := schedule.forMechanism("dht"); dht.Interval != 5*time.Second || dht.MaxInterval != 100*time.Second || dht.Limit != 50 {
+		t.Errorf("Unexpected dht settings: %+v", dht)
+	}
+
+	tests := []struct {
+		name      string
+		previous  time.Duration
+		connected int
+		want      time.Duration
+	}{
+		{"below target", 100 * time.Second, 4, 10 * time.Second},
+		{"reaches target", 10 * time.Second, 5, 30 * time.Second},
+		{"backs off", 30 * time.Second, 5, 60 * time.Second},
+		{"capped", 60 * time.Second, 8, 100 * time.Second},
+		{"stays at maximum", 100 * time.Second, 8, 100 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := schedule.nextInterval(settings, tt.previous, tt.connected); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+
+	// A mechanism slower than MinInterval keeps its own interval below the target
+	if got := schedule.nextInterval(schedule.forMechanism("dht"), 0, 0); got != 5*time.Second {
+		t.Errorf("Expected dht to keep its 5s interval, got %v", got)
+	}
+}
+
+// countingMechanism counts its rounds
+type countingMechanism struct {
+	rounds atomic.Int32
+}
+
+func (cm *countingMechanism) Name() string                    { return "counting" }
+func (cm *countingMechanism) Start(ctx context.Context) error { return nil }
+func (cm *countingMechanism) Stop() error                     { return nil }
+
+func (cm *countingMechanism) FindPeers(ctx context.Context, limit int) ([]peer.AddrInfo, error) {
+	cm.rounds.Add(1)
+	return nil, nil
+}
+
+// TestScheduleTriggersOnDisconnect tests that losing a peer below the target
+// starts a round without waiting for the interval
+func TestScheduleTriggersOnDisconnect(t *testing.T) {
+	h := newTestHost(t)
+	other := newTestHost(t)
+	if err := h.Connect(context.Background(), peer.AddrInfo{ID: other.ID(), Addrs: other.Addrs()}); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+
+	dm := NewDiscoveryManager(h)
+	mechanism := &countingMechanism{}
+	dm.AddMechanism(mechanism)
+	dm.SetSchedule(&ScheduleConfig{
+		TargetPeers: 1,
+		MinInterval: time.Hour,
+		Defaults:    MechanismSchedule{Interval: time.Hour},
+	})
+	if err := dm.Start(); err != nil {
+		t.Fatalf("Failed to start discovery: %v", err)
+	}
+	defer dm.Stop()
+
+	time.Sleep(100 * time.Millisecond)
+	if rounds := mechanism.rounds.Load(); rounds != 0 {
+		t.Fatalf("Expected no round with enough peers, got %d", rounds)
+	}
+
+	if err := h.Network().ClosePeer(other.ID()); err != nil {
+		t.Fatalf("Failed to disconnect: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for mechanism.rounds.Load() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Disconnect below the target did not start a round")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,62 @@
+package discovery
+
+import (
+	"sort"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// PeerSelector chooses connected peers as targets of a broadcast
+type PeerSelector struct {
+	Label string // Only peers advertising this label (empty = any)
+	TopK  int    // Only the K best scored peers (0 = all)
+}
+
+// HasLabel reports whether the peer advertises the given label
+func (p *PeerInfo) HasLabel(label string) bool {
+	for _, l := range p.Labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+// SelectPeers returns the connected peers matching the selector, best scored first
+func (dm *DiscoveryManager) SelectPeers(selector PeerSelector) []peer.ID {
+	known := dm.peerStore.GetAllPeers()
+
+	var candidates []*PeerInfo
+	for _, peerID := range dm.host.Network().Peers() {
+		if dm.host.Network().Connectedness(peerID) != network.Connected {
+			continue
+		}
+
+		info, exists := known[peerID]
+		if !exists {
+			// Connected but not discovered yet, nothing known about its labels
+			if selector.Label != "" {
+				continue
+			}
+			info = &PeerInfo{AddrInfo: peer.AddrInfo{ID: peerID}, Reliability: 0.5}
+		}
+		if selector.Label != "" && !info.HasLabel(selector.Label) {
+			continue
+		}
+		candidates = append(candidates, info)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Score() > candidates[j].Score()
+	})
+	if selector.TopK > 0 && len(candidates) > selector.TopK {
+		candidates = candidates[:selector.TopK]
+	}
+
+	ids := make([]peer.ID, len(candidates))
+	for i, info := range candidates {
+		ids[i] = info.AddrInfo.ID
+	}
+	return ids
+}
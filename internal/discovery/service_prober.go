@@ -0,0 +1,244 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/realentity/realentity-node/internal/services"
+	"github.com/realentity/realentity-node/internal/utils"
+)
+
+// defaultServiceProbeTimeout bounds a round of service probes of one peer
+const defaultServiceProbeTimeout = 10 * time.Second
+
+// errServiceNotProvided is returned by a probe of a service the peer doesn't offer
+var errServiceNotProvided = errors.New("service not provided by peer")
+
+// ServiceProbe is a service call used to check that a peer serves requests
+type ServiceProbe struct {
+	Service string
+	Payload json.RawMessage // Request payload (empty = {})
+}
+
+// ServiceProbePolicy controls which services are probed and when
+type ServiceProbePolicy struct {
+	Probes    []ServiceProbe
+	OnConnect bool          // Probe peers as soon as they connect and their services are known
+	Interval  time.Duration // Probe connected peers periodically (0 = never)
+	Timeout   time.Duration // Time allowed for a round of probes of one peer
+}
+
+// ServiceHealth tracks the results of probing one service on a peer
+type ServiceHealth struct {
+	Probes              int
+	Successes           int
+	ConsecutiveFailures int
+	LastLatency         time.Duration
+	LastError           string
+	LastProbe           time.Time
+}
+
+// ServiceProber calls the configured services on peers and records the
+// results in the peer store
+type ServiceProber struct {
+	dm      *DiscoveryManager
+	client  *utils.ServiceClient
+	policy  ServiceProbePolicy
+	probing map[peer.ID]bool
+	mu      sync.Mutex
+}
+
+// NewServiceProber creates a service prober calling services with client
+// according to the policy
+func NewServiceProber(dm *DiscoveryManager, client *utils.ServiceClient, policy ServiceProbePolicy) *ServiceProber {
+	if policy.Timeout <= 0 {
+		policy.Timeout = defaultServiceProbeTimeout
+	}
+
+	return &ServiceProber{
+		dm:      dm,
+		client:  client,
+		policy:  policy,
+		probing: make(map[peer.ID]bool),
+	}
+}
+
+// Start probes peers according to the policy until ctx is cancelled
+func (sp *ServiceProber) Start(ctx context.Context) {
+	// Services are usually learned just after connecting, so probe again
+	// once they are
+	var connected <-chan PeerEvent
+	if sp.policy.OnConnect {
+		sub := sp.dm.events.Subscribe(0, EventPeerConnected, EventPeerServicesUpdated)
+		defer sub.Close()
+		connected = sub.C
+	}
+
+	var tick <-chan time.Time
+	if sp.policy.Interval > 0 {
+		ticker := time.NewTicker(sp.policy.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-connected:
+			if sp.dm.host.Network().Connectedness(event.PeerID) == network.Connected {
+				go sp.ProbePeer(ctx, event.PeerID)
+			}
+		case <-tick:
+			for _, peerID := range sp.dm.host.Network().Peers() {
+				go sp.ProbePeer(ctx, peerID)
+			}
+		}
+	}
+}
+
+// ProbePeer calls every configured service the peer advertises. Peers whose
+// services aren't known yet are skipped.
+func (sp *ServiceProber) ProbePeer(ctx context.Context, peerID peer.ID) {
+	// A peer with several connections is probed only once at a time
+	sp.mu.Lock()
+	if sp.probing[peerID] {
+		sp.mu.Unlock()
+		return
+	}
+	sp.probing[peerID] = true
+	sp.mu.Unlock()
+
+	defer func() {
+		sp.mu.Lock()
+		delete(sp.probing, peerID)
+		sp.mu.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, sp.policy.Timeout)
+	defer cancel()
+
+	if !sp.dm.peerStore.HasPeer(peerID) {
+		sp.dm.peerStore.AddPeer(peer.AddrInfo{
+			ID:    peerID,
+			Addrs: sp.dm.host.Peerstore().Addrs(peerID),
+		}, "connection")
+	}
+	var advertised []string
+	if info, exists := sp.dm.GetPeers()[peerID]; exists {
+		advertised = info.Services
+	}
+	if len(advertised) == 0 {
+		return
+	}
+
+	for _, probe := range sp.policy.Probes {
+		if !containsString(advertised, probe.Service) {
+			continue
+		}
+
+		latency, err := sp.call(ctx, peerID, probe)
+		if errors.Is(err, errServiceNotProvided) {
+			// The advertisement is out of date, which says nothing about the peer's health
+			log.Printf("Peer %s no longer provides service %s\n", utils.FormatPeerID(peerID), probe.Service)
+			continue
+		}
+		sp.dm.peerStore.RecordServiceProbe(peerID, probe.Service, latency, err)
+		if err != nil {
+			log.Printf("Service probe %s on peer %s failed: %v\n", probe.Service, utils.FormatPeerID(peerID), err)
+		}
+	}
+}
+
+// call sends one probe request and measures its latency
+func (sp *ServiceProber) call(ctx context.Context, peerID peer.ID, probe ServiceProbe) (time.Duration, error) {
+	payload := probe.Payload
+	if len(payload) == 0 {
+		payload = json.RawMessage("{}")
+	}
+
+	request := &services.ServiceRequest{
+		Service:   probe.Service,
+		Payload:   payload,
+		RequestID: fmt.Sprintf("probe-%d", time.Now().UnixNano()),
+	}
+
+	started := time.Now()
+	response, err := sp.client.SendRequest(ctx, peerID, request)
+	latency := time.Since(started)
+	if err != nil {
+		return latency, err
+	}
+	if !response.Success && response.Code == services.ErrCodeServiceNotFound {
+		return latency, errServiceNotProvided
+	}
+	if !response.Success {
+		return latency, fmt.Errorf("service returned error: %s", response.Error)
+	}
+	return latency, nil
+}
+
+// RecordServiceProbe stores the result of a service probe. Successful probes
+// raise the peer's reliability and failed ones lower it.
+func (ps *PeerStore) RecordServiceProbe(peerID peer.ID, service string, latency time.Duration, err error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	info, exists := ps.peers[peerID]
+	if !exists {
+		return
+	}
+
+	// Replace the map so snapshots handed out earlier stay unchanged
+	health := make(map[string]ServiceHealth, len(info.ServiceHealth)+1)
+	for name, h := range info.ServiceHealth {
+		health[name] = h
+	}
+
+	h := health[service]
+	h.Probes++
+	h.LastLatency = latency
+	h.LastProbe = time.Now()
+	if err == nil {
+		h.Successes++
+		h.ConsecutiveFailures = 0
+		h.LastError = ""
+
+		ps.setStatusLocked(peerID, info, PeerStatusConnected)
+		info.LastSeen = time.Now()
+		info.Reliability = min(info.Reliability+0.05, 1.0)
+	} else {
+		h.ConsecutiveFailures++
+		h.LastError = err.Error()
+
+		info.LastError = err
+		info.Reliability = max(info.Reliability-0.1, 0.0)
+	}
+	health[service] = h
+	info.ServiceHealth = health
+}
+
+// EnableServiceProbing starts calling services on peers according to the policy
+func (dm *DiscoveryManager) EnableServiceProbing(client *utils.ServiceClient, policy ServiceProbePolicy) *ServiceProber {
+	prober := NewServiceProber(dm, client, policy)
+	go prober.Start(dm.ctx)
+	log.Printf("Service probing enabled (services: %d, on connect: %v, interval: %v)\n",
+		len(policy.Probes), policy.OnConnect, policy.Interval)
+	return prober
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
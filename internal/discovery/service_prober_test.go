@@ -0,0 +1,96 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/realentity/realentity-node/internal/protocol"
+	"github.com/realentity/realentity-node/internal/services"
+	"github.com/realentity/realentity-node/internal/utils"
+)
+
+// TestRecordServiceProbe tests that service probe results are tracked per service
+func TestRecordServiceProbe(t *testing.T) {
+	ps := NewPeerStore(10, time.Minute)
+	peerID := peer.ID("test-peer")
+	ps.AddPeer(peer.AddrInfo{ID: peerID}, "test")
+
+	ps.RecordServiceProbe(peerID, "echo", 5*time.Millisecond, nil)
+	before := ps.GetAllPeers()[peerID]
+
+	ps.RecordServiceProbe(peerID, "text.process", 0, errors.New("unknown service"))
+	ps.RecordServiceProbe(peerID, "text.process", 0, errors.New("unknown service"))
+	after := ps.GetAllPeers()[peerID]
+
+	echo := after.ServiceHealth["echo"]
+	if echo.Probes != 1 || echo.Successes != 1 || echo.LastLatency != 5*time.Millisecond {
+		t.Errorf("Unexpected echo health: %+v", echo)
+	}
+
+	text := after.ServiceHealth["text.process"]
+	if text.ConsecutiveFailures != 2 || text.LastError != "unknown service" {
+		t.Errorf("Unexpected text.process health: %+v", text)
+	}
+	if after.Reliability >= before.Reliability {
+		t.Errorf("Expected reliability to drop after failures, got %f", after.Reliability)
+	}
+
+	// Earlier snapshots are not affected by later probes
+	if _, exists := before.ServiceHealth["text.process"]; exists {
+		t.Errorf("Expected earlier snapshot to be unchanged")
+	}
+}
+
+// TestProbePeerAdvertisedServices tests that only advertised services are
+// probed and that a service the peer turns out not to provide costs no reliability
+func TestProbePeerAdvertisedServices(t *testing.T) {
+	original := services.GlobalRegistry
+	services.GlobalRegistry = services.NewRegistry()
+	t.Cleanup(func() { services.GlobalRegistry = original })
+	services.GlobalRegistry.RegisterService(&services.Service{
+		Name:    "echo",
+		Handler: func(payload []byte) ([]byte, error) { return payload, nil },
+	})
+
+	server := newTestHost(t)
+	protocol.RegisterHandler(server, protocol.ProtocolID)
+	protocol.RegisterPersistentHandler(server, protocol.DefaultHandlerConfig())
+
+	h := newTestHost(t)
+	if err := h.Connect(context.Background(), peer.AddrInfo{ID: server.ID(), Addrs: server.Addrs()}); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	dm := NewDiscoveryManager(h)
+	defer dm.Stop()
+
+	client := utils.NewServiceClient(h)
+	defer client.Close()
+	prober := NewServiceProber(dm, client, ServiceProbePolicy{
+		Probes: []ServiceProbe{{Service: "echo"}, {Service: "text.process"}},
+	})
+
+	// Services not known yet, nothing is probed
+	prober.ProbePeer(context.Background(), server.ID())
+	if health := dm.GetPeers()[server.ID()].ServiceHealth; len(health) != 0 {
+		t.Fatalf("Expected no probes before services are known, got %+v", health)
+	}
+
+	// The peer claims a service it doesn't provide
+	dm.UpdatePeerServices(server.ID(), []string{"echo", "text.process"})
+	before := dm.GetPeers()[server.ID()].Reliability
+	prober.ProbePeer(context.Background(), server.ID())
+
+	info := dm.GetPeers()[server.ID()]
+	if echo := info.ServiceHealth["echo"]; echo.Successes != 1 {
+		t.Errorf("Expected a successful echo probe, got %+v", echo)
+	}
+	if text, exists := info.ServiceHealth["text.process"]; exists {
+		t.Errorf("Expected missing service not to count as a probe, got %+v", text)
+	}
+	if info.Reliability < before {
+		t.Errorf("Expected reliability not to drop, went from %f to %f", before, info.Reliability)
+	}
+}
@@ -0,0 +1,229 @@
+package discovery
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// defaultStaticPeersInterval is how often the static peers file is checked for changes
+const defaultStaticPeersInterval = 5 * time.Second
+
+// StaticPeer is a peer listed in a static peers file
+type StaticPeer struct {
+	AddrInfo peer.AddrInfo
+	Labels   []string
+}
+
+// StaticPeersDiscovery provides the peers listed in a file. The file is
+// watched while the mechanism runs: peers added to it are handed to the
+// discovery manager and peers removed from it are forgotten.
+//
+// Each line holds a peer multiaddr ending in /p2p/<peer ID>, optionally
+// followed by labels separated by spaces. Text after # is a comment. A peer
+// listed on several lines gets all their addresses and labels.
+type StaticPeersDiscovery struct {
+	dm       *DiscoveryManager
+	path     string
+	interval time.Duration
+	peers    map[peer.ID]StaticPeer
+	modTime  time.Time
+	size     int64
+	mu       sync.Mutex
+}
+
+// NewStaticPeersDiscovery creates a mechanism for the peers listed in a file,
+// checked for changes every interval (0 = default)
+func NewStaticPeersDiscovery(dm *DiscoveryManager, path string, interval time.Duration) *StaticPeersDiscovery {
+	if interval <= 0 {
+		interval = defaultStaticPeersInterval
+	}
+
+	return &StaticPeersDiscovery{
+		dm:       dm,
+		path:     path,
+		interval: interval,
+		peers:    make(map[peer.ID]StaticPeer),
+	}
+}
+
+func (sd *StaticPeersDiscovery) Name() string {
+	return "static"
+}
+
+func (sd *StaticPeersDiscovery) Start(ctx context.Context) error {
+	if err := sd.Reload(); err != nil {
+		log.Printf("Failed to load static peers: %v\n", err)
+	}
+
+	go sd.watch(ctx)
+
+	log.Printf("Static peers discovery started with file: %s\n", sd.path)
+	return nil
+}
+
+func (sd *StaticPeersDiscovery) Stop() error {
+	log.Println("Static peers discovery stopped")
+	return nil
+}
+
+// FindPeers returns the listed peers, which keeps them fresh in the peer store
+func (sd *StaticPeersDiscovery) FindPeers(ctx context.Context, limit int) ([]peer.AddrInfo, error) {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+
+	var found []peer.AddrInfo
+	for _, sp := range sd.peers {
+		if len(found) >= limit {
+			break
+		}
+		found = append(found, sp.AddrInfo)
+	}
+	return found, nil
+}
+
+// Peers returns the peers currently listed in the file
+func (sd *StaticPeersDiscovery) Peers() []StaticPeer {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+
+	peers := make([]StaticPeer, 0, len(sd.peers))
+	for _, sp := range sd.peers {
+		peers = append(peers, sp)
+	}
+	return peers
+}
+
+// watch reloads the file whenever its size or modification time changes
+func (sd *StaticPeersDiscovery) watch(ctx context.Context) {
+	ticker := time.NewTicker(sd.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !sd.changed() {
+				continue
+			}
+			if err := sd.Reload(); err != nil {
+				log.Printf("Failed to reload static peers: %v\n", err)
+			}
+		}
+	}
+}
+
+// changed reports whether the file differs from the last loaded version
+func (sd *StaticPeersDiscovery) changed() bool {
+	var modTime time.Time
+	var size int64 = -1
+	if stat, err := os.Stat(sd.path); err == nil {
+		modTime, size = stat.ModTime(), stat.Size()
+	}
+
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	return !modTime.Equal(sd.modTime) || size != sd.size
+}
+
+// Reload reads the file and applies the differences to the discovery manager.
+// A missing file lists no peers. When the file cannot be parsed, the
+// previously loaded peers are kept.
+func (sd *StaticPeersDiscovery) Reload() (err error) {
+	defer func() { sd.dm.recordRun(sd.Name(), err) }()
+
+	var modTime time.Time
+	var size int64 = -1
+	peers := make(map[peer.ID]StaticPeer)
+
+	stat, err := os.Stat(sd.path)
+	switch {
+	case err == nil:
+		modTime, size = stat.ModTime(), stat.Size()
+		if peers, err = ParseStaticPeersFile(sd.path); err != nil {
+			sd.mu.Lock()
+			sd.modTime, sd.size = modTime, size // Don't retry until the file changes again
+			sd.mu.Unlock()
+			return err
+		}
+	case !os.IsNotExist(err):
+		return fmt.Errorf("failed to read static peers file: %v", err)
+	}
+
+	sd.mu.Lock()
+	previous := sd.peers
+	sd.peers = peers
+	sd.modTime, sd.size = modTime, size
+	sd.mu.Unlock()
+
+	for id := range previous {
+		if _, exists := peers[id]; !exists {
+			sd.dm.RemovePeer(id, "removed")
+			log.Printf("Removed static peer: %s\n", id.String())
+		}
+	}
+	for id, sp := range peers {
+		sd.dm.handleFoundPeer(sp.AddrInfo, sd.Name())
+		if len(sp.Labels) > 0 {
+			sd.dm.peerStore.UpdatePeerLabels(id, sp.Labels)
+		}
+		if _, exists := previous[id]; !exists {
+			log.Printf("Added static peer: %s\n", id.String())
+		}
+	}
+	return nil
+}
+
+// ParseStaticPeersFile reads the peers listed in a static peers file
+func ParseStaticPeersFile(path string) (map[peer.ID]StaticPeer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open static peers file: %v", err)
+	}
+	defer file.Close()
+
+	peers := make(map[peer.ID]StaticPeer)
+	scanner := bufio.NewScanner(file)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		addr, err := multiaddr.NewMultiaddr(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid address on line %d: %v", lineNum, err)
+		}
+		addrInfo, err := peer.AddrInfoFromP2pAddr(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid peer address on line %d: %v", lineNum, err)
+		}
+
+		sp := peers[addrInfo.ID]
+		sp.AddrInfo.ID = addrInfo.ID
+		sp.AddrInfo.Addrs = removeDuplicateAddrs(append(sp.AddrInfo.Addrs, addrInfo.Addrs...))
+		for _, label := range fields[1:] {
+			if strings.HasPrefix(label, "#") {
+				break // Trailing comment
+			}
+			if !containsString(sp.Labels, label) {
+				sp.Labels = append(sp.Labels, label)
+			}
+		}
+		peers[addrInfo.ID] = sp
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read static peers file: %v", err)
+	}
+
+	return peers, nil
+}
@@ -0,0 +1,85 @@
+package discovery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// newTestPeerID returns a random peer ID
+func newTestPeerID(t *testing.T) peer.ID {
+	_, pub, err := crypto.GenerateEd25519Key(nil)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	id, err := peer.IDFromPublicKey(pub)
+	if err != nil {
+		t.Fatalf("Failed to derive peer ID: %v", err)
+	}
+	return id
+}
+
+// TestStaticPeersReload tests that peers added to and removed from the file
+// are applied to the discovery manager
+func TestStaticPeersReload(t *testing.T) {
+	h := newTestHost(t)
+	dm := NewDiscoveryManager(h)
+	first, second := newTestPeerID(t), newTestPeerID(t)
+
+	path := filepath.Join(t.TempDir(), "static-peers.txt")
+	write := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write static peers file: %v", err)
+		}
+	}
+
+	write("# Lab peers\n" +
+		"/ip4/10.0.0.1/tcp/4001/p2p/" + first.String() + " lab gpu\n" +
+		"/ip4/10.0.0.2/tcp/4001/p2p/" + first.String() + " lab # second address\n")
+
+	sd := NewStaticPeersDiscovery(dm, path, time.Hour)
+	if err := sd.Reload(); err != nil {
+		t.Fatalf("Failed to load static peers: %v", err)
+	}
+
+	info, exists := dm.GetPeers()[first]
+	if !exists {
+		t.Fatalf("Expected static peer in the peer store")
+	}
+	if info.Source != "static" || len(info.AddrInfo.Addrs) != 2 {
+		t.Errorf("Expected static peer with 2 addresses, got source %s with %v", info.Source, info.AddrInfo.Addrs)
+	}
+	if len(info.Labels) != 2 || info.Labels[0] != "lab" || info.Labels[1] != "gpu" {
+		t.Errorf("Expected labels [lab gpu], got %v", info.Labels)
+	}
+
+	// Replace the first peer by the second
+	write("/ip4/10.0.0.3/tcp/4001/p2p/" + second.String() + "\n")
+	if !sd.changed() {
+		t.Fatalf("Expected the rewritten file to be detected as changed")
+	}
+	if err := sd.Reload(); err != nil {
+		t.Fatalf("Failed to reload static peers: %v", err)
+	}
+
+	peers := dm.GetPeers()
+	if _, exists := peers[first]; exists {
+		t.Errorf("Expected peer removed from the file to be forgotten")
+	}
+	if _, exists := peers[second]; !exists {
+		t.Errorf("Expected peer added to the file to be known")
+	}
+
+	// An invalid file keeps the peers loaded before
+	write("not-a-multiaddr\n")
+	if err := sd.Reload(); err == nil {
+		t.Errorf("Expected invalid file to fail")
+	}
+	if len(sd.Peers()) != 1 || sd.changed() {
+		t.Errorf("Expected the previous peers to be kept until the file changes again")
+	}
+}
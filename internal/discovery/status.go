@@ -0,0 +1,174 @@
+package discovery
+
+import (
+	"sort"
+	"time"
+)
+
+// builtinMechanisms are the mechanisms a node can be configured with. Those
+// not added to the manager are reported as disabled.
+var builtinMechanisms = []string{"bootstrap", "dht", "dns", "mdns", "pex", "static"}
+
+// MechanismStatus describes the state of a discovery mechanism
+type MechanismStatus struct {
+	Name            string      `json:"name"`
+	Enabled         bool        `json:"enabled"` // Added to the discovery manager
+	Running         bool        `json:"running"` // Started successfully and not stopped
+	LastRun         *time.Time  `json:"last_run,omitempty"`
+	PeersFound      int         `json:"peers_found"` // Peers new to the peer store when this mechanism found them
+	LastError       string      `json:"last_error,omitempty"`
+	LastErrorAt     *time.Time  `json:"last_error_at,omitempty"`
+	IntervalSeconds int         `json:"interval_seconds"` // Current wait between rounds
+	NextRun         *time.Time  `json:"next_run,omitempty"`
+	Details         interface{} `json:"details,omitempty"` // Set by mechanisms implementing StatusReporter
+}
+
+// StatusReporter is implemented by mechanisms that know more about their
+// state than the manager records, such as bootstrap dial errors
+type StatusReporter interface {
+	ReportStatus(status *MechanismStatus)
+}
+
+// mechanismState holds what a mechanism reported about its runs. Guarded by
+// DiscoveryManager.statusMu.
+type mechanismState struct {
+	running     bool
+	lastRun     time.Time
+	found       int
+	lastErr     error
+	lastErrorAt time.Time
+	interval    time.Duration
+	nextRun     time.Time
+}
+
+// stateLocked returns the state of a mechanism, creating it if needed. Must
+// be called with dm.statusMu held.
+func (dm *DiscoveryManager) stateLocked(name string) *mechanismState {
+	state, exists := dm.status[name]
+	if !exists {
+		state = &mechanismState{}
+		dm.status[name] = state
+	}
+	return state
+}
+
+// setRunning records that a mechanism started or stopped, with the error that
+// made it fail if any
+func (dm *DiscoveryManager) setRunning(name string, running bool, err error) {
+	dm.statusMu.Lock()
+	defer dm.statusMu.Unlock()
+
+	state := dm.stateLocked(name)
+	state.running = running
+	if err != nil {
+		state.lastErr = err
+		state.lastErrorAt = time.Now()
+	}
+}
+
+// recordRun records that a mechanism looked for peers, successfully if err is nil.
+// Mechanisms that search on their own schedule call it after each search.
+func (dm *DiscoveryManager) recordRun(name string, err error) {
+	dm.statusMu.Lock()
+	defer dm.statusMu.Unlock()
+
+	state := dm.stateLocked(name)
+	state.lastRun = time.Now()
+	if err != nil {
+		state.lastErr = err
+		state.lastErrorAt = state.lastRun
+	}
+}
+
+// recordSchedule records when a mechanism runs next
+func (dm *DiscoveryManager) recordSchedule(name string, interval time.Duration, nextRun time.Time) {
+	dm.statusMu.Lock()
+	defer dm.statusMu.Unlock()
+
+	state := dm.stateLocked(name)
+	state.interval = interval
+	state.nextRun = nextRun
+}
+
+// recordFound counts a peer a mechanism added to the peer store. Sources
+// that are not mechanisms, such as pinned peers, are ignored.
+func (dm *DiscoveryManager) recordFound(name string) {
+	dm.statusMu.Lock()
+	defer dm.statusMu.Unlock()
+
+	if state, exists := dm.status[name]; exists {
+		state.found++
+	}
+}
+
+// MechanismStatuses returns the status of every discovery mechanism, by name.
+// Built-in mechanisms the node wasn't configured with are reported as disabled.
+func (dm *DiscoveryManager) MechanismStatuses() []MechanismStatus {
+	dm.mu.RLock()
+	reporters := make(map[string]StatusReporter)
+	for _, mechanism := range dm.mechanisms {
+		if reporter, ok := mechanism.(StatusReporter); ok {
+			reporters[mechanism.Name()] = reporter
+		}
+	}
+	dm.mu.RUnlock()
+
+	statuses := dm.recordedStatuses()
+	for i := range statuses {
+		if reporter, exists := reporters[statuses[i].Name]; exists {
+			reporter.ReportStatus(&statuses[i])
+		}
+	}
+	return statuses
+}
+
+// recordedStatuses returns the status of every mechanism as recorded by the manager
+func (dm *DiscoveryManager) recordedStatuses() []MechanismStatus {
+	dm.statusMu.Lock()
+	defer dm.statusMu.Unlock()
+
+	statuses := make([]MechanismStatus, 0, len(dm.status)+len(builtinMechanisms))
+	for name, state := range dm.status {
+		status := MechanismStatus{
+			Name:            name,
+			Enabled:         true,
+			Running:         state.running,
+			PeersFound:      state.found,
+			IntervalSeconds: int(state.interval / time.Second),
+		}
+		if !state.lastRun.IsZero() {
+			lastRun := state.lastRun
+			status.LastRun = &lastRun
+		}
+		if !state.nextRun.IsZero() && state.running {
+			nextRun := state.nextRun
+			status.NextRun = &nextRun
+		}
+		if state.lastErr != nil {
+			lastErrorAt := state.lastErrorAt
+			status.LastError = state.lastErr.Error()
+			status.LastErrorAt = &lastErrorAt
+		}
+		statuses = append(statuses, status)
+	}
+
+	for _, name := range builtinMechanisms {
+		if _, exists := dm.status[name]; !exists {
+			statuses = append(statuses, MechanismStatus{Name: name})
+		}
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
+
+// MechanismsRunning reports for every discovery mechanism whether it is running
+func (dm *DiscoveryManager) MechanismsRunning() map[string]bool {
+	running := make(map[string]bool)
+	for _, status := range dm.MechanismStatuses() {
+		running[status.Name] = status.Running
+	}
+	return running
+}
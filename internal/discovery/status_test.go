@@ -0,0 +1,147 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// fakeMechanism returns fixed peers, or fails
+type fakeMechanism struct {
+	name     string
+	startErr error
+	findErr  error
+	peers    []peer.AddrInfo
+}
+
+func (fm *fakeMechanism) Name() string                    { return fm.name }
+func (fm *fakeMechanism) Start(ctx context.Context) error { return fm.startErr }
+func (fm *fakeMechanism) Stop() error                     { return nil }
+
+func (fm *fakeMechanism) FindPeers(ctx context.Context, limit int) ([]peer.AddrInfo, error) {
+	return fm.peers, fm.findErr
+}
+
+// TestMechanismStatuses tests that the status of every mechanism reflects
+// its runs, the peers it found and its errors
+func TestMechanismStatuses(t *testing.T) {
+	h := newTestHost(t)
+	dm := NewDiscoveryManager(h)
+
+	found := newTestHost(t)
+	dm.AddMechanism(&fakeMechanism{
+		name:  "mdns",
+		peers: []peer.AddrInfo{{ID: found.ID(), Addrs: found.Addrs()}},
+	})
+	dm.AddMechanism(&fakeMechanism{name: "dht", startErr: fmt.Errorf("no bootstrap peers")})
+	dm.AddMechanism(&fakeMechanism{name: "custom", findErr: fmt.Errorf("lookup failed")})
+
+	if err := dm.Start(); err != nil {
+		t.Fatalf("Failed to start discovery: %v", err)
+	}
+	discover := func() {
+		for _, m := range dm.mechanisms {
+			dm.runMechanism(m, dm.schedule.forMechanism(m.Name()))
+		}
+	}
+	discover()
+
+	statuses := func() map[string]MechanismStatus {
+		result := make(map[string]MechanismStatus)
+		for _, status := range dm.MechanismStatuses() {
+			result[status.Name] = status
+		}
+		return result
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		current := statuses()
+		if current["mdns"].LastRun != nil && current["custom"].LastRun != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Mechanism runs were not recorded: %+v", current)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	current := statuses()
+	if mdns := current["mdns"]; !mdns.Enabled || !mdns.Running || mdns.PeersFound != 1 || mdns.LastError != "" {
+		t.Errorf("Unexpected mdns status: %+v", mdns)
+	}
+	if dht := current["dht"]; !dht.Enabled || dht.Running || dht.LastError != "no bootstrap peers" {
+		t.Errorf("Unexpected dht status: %+v", dht)
+	}
+	if custom := current["custom"]; !custom.Running || custom.LastError != "lookup failed" || custom.LastErrorAt == nil {
+		t.Errorf("Unexpected custom status: %+v", custom)
+	}
+	for _, name := range []string{"bootstrap", "dns", "pex", "static"} {
+		if status, exists := current[name]; !exists || status.Enabled || status.Running {
+			t.Errorf("Expected %s to be reported as disabled, got %+v", name, status)
+		}
+	}
+
+	// Finding the same peer again, or a peer another mechanism found first, doesn't count it
+	dm.handleFoundPeer(peer.AddrInfo{ID: found.ID(), Addrs: found.Addrs()}, "custom")
+	discover()
+	if current := statuses(); current["mdns"].PeersFound != 1 || current["custom"].PeersFound != 0 {
+		t.Errorf("Expected only mdns to count the peer once, got %+v", current)
+	}
+
+	running := dm.MechanismsRunning()
+	if !running["mdns"] || running["dht"] || running["static"] {
+		t.Errorf("Unexpected running mechanisms: %v", running)
+	}
+
+	dm.Stop()
+	if running := dm.MechanismsRunning(); running["mdns"] || running["custom"] {
+		t.Errorf("Mechanisms should not be running after stop: %v", running)
+	}
+}
+
+// TestBootstrapReportsStatus tests that bootstrap discovery adds its peers
+// and their connection errors to its mechanism status
+func TestBootstrapReportsStatus(t *testing.T) {
+	h := newTestHost(t)
+	dm := NewDiscoveryManager(h)
+
+	gone := newTestHost(t)
+	goneAddr := fmt.Sprintf("%s/p2p/%s", gone.Addrs()[0], gone.ID())
+	gone.Close()
+
+	bd, err := NewBootstrapDiscovery(h, []string{goneAddr})
+	if err != nil {
+		t.Fatalf("Failed to create bootstrap discovery: %v", err)
+	}
+	dm.AddMechanism(bd)
+	if err := dm.Start(); err != nil {
+		t.Fatalf("Failed to start discovery: %v", err)
+	}
+	defer dm.Stop()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var bootstrap MechanismStatus
+		for _, status := range dm.MechanismStatuses() {
+			if status.Name == "bootstrap" {
+				bootstrap = status
+			}
+		}
+		details, _ := bootstrap.Details.(map[string]interface{})
+		if peers, _ := details["peers"].([]BootstrapPeerStatus); len(peers) == 1 && bootstrap.LastError != "" {
+			if !strings.Contains(bootstrap.LastError, gone.ID().String()) || bootstrap.LastErrorAt == nil {
+				t.Errorf("Expected the failed bootstrap peer in the last error, got %+v", bootstrap)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Bootstrap dial error was not reported, got %+v", bootstrap)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -0,0 +1,32 @@
+package fileutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestWriteFileAtomic tests that a file is replaced with the given
+// permissions and no temporary file is left behind
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "state.json")
+	if err := os.WriteFile(filename, []byte("old"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	if err := WriteFileAtomic(filename, []byte("new"), 0600); err != nil {
+		t.Fatalf("Failed to replace file: %v", err)
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil || string(data) != "new" {
+		t.Errorf("Expected new contents, got %q (%v)", data, err)
+	}
+	if info, err := os.Stat(filename); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected permissions 0600, got %v (%v)", info.Mode().Perm(), err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Expected only the replaced file, found %d entries", len(entries))
+	}
+}
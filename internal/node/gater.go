@@ -0,0 +1,458 @@
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/control"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+	"github.com/realentity/realentity-node/internal/fileutil"
+)
+
+// Rule lists of a ConnectionGater
+const (
+	RuleListAllow = "allow"
+	RuleListDeny  = "deny"
+)
+
+// GaterConfig contains the rules a ConnectionGater starts with. A rule is a
+// peer ID, an IP address or CIDR range, or a multiaddr pattern such as
+// /ip4/10.0.*/tcp/4001 where * matches within one part of the address.
+type GaterConfig struct {
+	Allow   []string // When not empty, only matching peers and addresses are accepted
+	Deny    []string // Never accepted, even when allowed
+	BanFile string   // Bans are kept in this file across restarts (empty = memory only)
+}
+
+// Ban blocks a peer or address range, temporarily or permanently
+type Ban struct {
+	Target    string     `json:"target"`
+	Reason    string     `json:"reason,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // Nil = permanent
+
+	rule gateRule
+}
+
+// expired reports whether a temporary ban is over
+func (b *Ban) expired(now time.Time) bool {
+	return b.ExpiresAt != nil && now.After(*b.ExpiresAt)
+}
+
+// gateRule matches peers or addresses
+type gateRule struct {
+	raw     string
+	peer    peer.ID
+	network *net.IPNet
+	pattern string
+}
+
+// parseGateRule classifies a rule as a multiaddr pattern, an address range or a peer ID
+func parseGateRule(raw string) (gateRule, error) {
+	raw = strings.TrimSpace(raw)
+	rule := gateRule{raw: raw}
+
+	switch {
+	case strings.HasPrefix(raw, "/"):
+		if _, err := path.Match(raw, ""); err != nil {
+			return rule, fmt.Errorf("invalid multiaddr pattern %s: %v", raw, err)
+		}
+		rule.pattern = raw
+	case strings.Contains(raw, "/"):
+		_, network, err := net.ParseCIDR(raw)
+		if err != nil {
+			return rule, fmt.Errorf("invalid CIDR %s: %v", raw, err)
+		}
+		rule.network = network
+	case net.ParseIP(raw) != nil:
+		ip := net.ParseIP(raw)
+		bits := 128
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 32
+		}
+		rule.network = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+	default:
+		id, err := peer.Decode(raw)
+		if err != nil {
+			return rule, fmt.Errorf("rule %s is not a peer ID, IP address, CIDR or multiaddr pattern", raw)
+		}
+		rule.peer = id
+	}
+	return rule, nil
+}
+
+// matchesPeer reports whether the rule names the peer
+func (r gateRule) matchesPeer(id peer.ID) bool {
+	return r.peer != "" && r.peer == id
+}
+
+// matchesAddr reports whether the rule covers the address. A pattern
+// matches addresses that start with the parts it lists.
+func (r gateRule) matchesAddr(addr multiaddr.Multiaddr) bool {
+	if addr == nil {
+		return false
+	}
+
+	switch {
+	case r.network != nil:
+		ip, err := manet.ToIP(addr)
+		return err == nil && r.network.Contains(ip)
+	case r.pattern != "":
+		parts := strings.Split(addr.String(), "/")
+		if n := strings.Count(r.pattern, "/") + 1; len(parts) > n {
+			parts = parts[:n]
+		}
+		matched, _ := path.Match(r.pattern, strings.Join(parts, "/"))
+		return matched
+	default:
+		return false
+	}
+}
+
+// isAddrRule reports whether the rule matches addresses rather than a peer
+func (r gateRule) isAddrRule() bool {
+	return r.peer == ""
+}
+
+// ConnectionGater accepts or refuses connections according to allow and
+// deny rules and bans. Deny rules and bans take precedence over allow rules.
+type ConnectionGater struct {
+	allow   []gateRule
+	deny    []gateRule
+	bans    map[string]*Ban
+	banFile string
+	mu      sync.RWMutex
+	saveMu  sync.Mutex // Serializes writes of the ban file
+}
+
+// NewConnectionGater creates a gater with the configured rules and loads the
+// bans saved in the ban file
+func NewConnectionGater(config GaterConfig) (*ConnectionGater, error) {
+	g := &ConnectionGater{
+		bans:    make(map[string]*Ban),
+		banFile: config.BanFile,
+	}
+
+	for _, raw := range config.Allow {
+		if err := g.AddRule(RuleListAllow, raw); err != nil {
+			return nil, err
+		}
+	}
+	for _, raw := range config.Deny {
+		if err := g.AddRule(RuleListDeny, raw); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := g.loadBans(); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// AddRule adds a rule to the allow or deny list
+func (g *ConnectionGater) AddRule(list, raw string) error {
+	rule, err := parseGateRule(raw)
+	if err != nil {
+		return err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	switch list {
+	case RuleListAllow:
+		g.allow = appendRule(g.allow, rule)
+	case RuleListDeny:
+		g.deny = appendRule(g.deny, rule)
+	default:
+		return fmt.Errorf("unknown rule list: %s", list)
+	}
+	return nil
+}
+
+// RemoveRule removes a rule from the allow or deny list, reporting whether it was present
+func (g *ConnectionGater) RemoveRule(list, raw string) bool {
+	raw = strings.TrimSpace(raw)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	rules := &g.allow
+	if list == RuleListDeny {
+		rules = &g.deny
+	} else if list != RuleListAllow {
+		return false
+	}
+
+	for i, rule := range *rules {
+		if rule.raw == raw {
+			*rules = append((*rules)[:i], (*rules)[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// appendRule adds a rule unless an identical one exists
+func appendRule(rules []gateRule, rule gateRule) []gateRule {
+	for _, existing := range rules {
+		if existing.raw == rule.raw {
+			return rules
+		}
+	}
+	return append(rules, rule)
+}
+
+// Rules returns the allow and deny rules
+func (g *ConnectionGater) Rules() (allow, deny []string) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	for _, rule := range g.allow {
+		allow = append(allow, rule.raw)
+	}
+	for _, rule := range g.deny {
+		deny = append(deny, rule.raw)
+	}
+	return allow, deny
+}
+
+// Ban blocks a peer ID, IP address, CIDR or multiaddr pattern for the given
+// duration (0 = permanently) and saves the ban list. It fails only for an
+// invalid target; failures to save are logged.
+func (g *ConnectionGater) Ban(target string, duration time.Duration, reason string) (Ban, error) {
+	rule, err := parseGateRule(target)
+	if err != nil {
+		return Ban{}, err
+	}
+
+	ban := &Ban{
+		Target:    rule.raw,
+		Reason:    reason,
+		CreatedAt: time.Now(),
+		rule:      rule,
+	}
+	if duration > 0 {
+		expiresAt := ban.CreatedAt.Add(duration)
+		ban.ExpiresAt = &expiresAt
+	}
+
+	g.mu.Lock()
+	for target, existing := range g.bans {
+		if existing.expired(ban.CreatedAt) {
+			delete(g.bans, target)
+		}
+	}
+	g.bans[rule.raw] = ban
+	g.mu.Unlock()
+
+	if duration > 0 {
+		log.Printf("Banned %s for %v (reason: %s)\n", rule.raw, duration, reason)
+	} else {
+		log.Printf("Banned %s permanently (reason: %s)\n", rule.raw, reason)
+	}
+	g.saveBans()
+	return *ban, nil
+}
+
+// Unban lifts a ban and saves the ban list, reporting whether the ban existed
+func (g *ConnectionGater) Unban(target string) bool {
+	target = strings.TrimSpace(target)
+
+	g.mu.Lock()
+	_, exists := g.bans[target]
+	delete(g.bans, target)
+	g.mu.Unlock()
+
+	if !exists {
+		return false
+	}
+	log.Printf("Unbanned %s\n", target)
+	g.saveBans()
+	return true
+}
+
+// Bans returns the bans in effect, oldest first
+func (g *ConnectionGater) Bans() []Ban {
+	now := time.Now()
+
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	bans := make([]Ban, 0, len(g.bans))
+	for _, ban := range g.bans {
+		if !ban.expired(now) {
+			bans = append(bans, *ban)
+		}
+	}
+	sort.Slice(bans, func(i, j int) bool { return bans[i].CreatedAt.Before(bans[j].CreatedAt) })
+	return bans
+}
+
+// deniedLocked reports whether a deny rule or ban covers the peer or address.
+// An empty peer ID or nil address is not checked. Must be called with g.mu held.
+func (g *ConnectionGater) deniedLocked(id peer.ID, addr multiaddr.Multiaddr) bool {
+	for _, rule := range g.deny {
+		if rule.matchesPeer(id) || rule.matchesAddr(addr) {
+			return true
+		}
+	}
+
+	now := time.Now()
+	for _, ban := range g.bans {
+		if !ban.expired(now) && (ban.rule.matchesPeer(id) || ban.rule.matchesAddr(addr)) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedLocked reports whether an allow rule covers the peer or address, or
+// no allow rule exists. Must be called with g.mu held.
+func (g *ConnectionGater) allowedLocked(id peer.ID, addr multiaddr.Multiaddr) bool {
+	if len(g.allow) == 0 {
+		return true
+	}
+
+	for _, rule := range g.allow {
+		if rule.matchesPeer(id) || rule.matchesAddr(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Blocks reports whether a connection to the peer at the address is refused
+func (g *ConnectionGater) Blocks(id peer.ID, addr multiaddr.Multiaddr) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.deniedLocked(id, addr) || !g.allowedLocked(id, addr)
+}
+
+// CloseBlocked closes the open connections that the current rules refuse,
+// returning how many were closed
+func (g *ConnectionGater) CloseBlocked(n network.Network) int {
+	closed := 0
+	for _, conn := range n.Conns() {
+		if g.Blocks(conn.RemotePeer(), conn.RemoteMultiaddr()) {
+			conn.Close()
+			closed++
+		}
+	}
+	return closed
+}
+
+// InterceptPeerDial refuses dials to denied peers, and to peers not allowed
+// by ID when no address rule could allow them
+func (g *ConnectionGater) InterceptPeerDial(id peer.ID) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	if g.deniedLocked(id, nil) {
+		return false
+	}
+	if g.allowedLocked(id, nil) {
+		return true
+	}
+	for _, rule := range g.allow {
+		if rule.isAddrRule() {
+			return true // Decided per address
+		}
+	}
+	return false
+}
+
+// InterceptAddrDial refuses dials to denied or not allowed addresses
+func (g *ConnectionGater) InterceptAddrDial(id peer.ID, addr multiaddr.Multiaddr) bool {
+	return !g.Blocks(id, addr)
+}
+
+// InterceptAccept refuses inbound connections from denied addresses. Allow
+// rules are checked once the peer is known.
+func (g *ConnectionGater) InterceptAccept(addrs network.ConnMultiaddrs) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return !g.deniedLocked("", addrs.RemoteMultiaddr())
+}
+
+// InterceptSecured refuses authenticated connections of denied or not allowed peers
+func (g *ConnectionGater) InterceptSecured(_ network.Direction, id peer.ID, addrs network.ConnMultiaddrs) bool {
+	return !g.Blocks(id, addrs.RemoteMultiaddr())
+}
+
+// InterceptUpgraded accepts all connections that passed the earlier checks
+func (g *ConnectionGater) InterceptUpgraded(network.Conn) (bool, control.DisconnectReason) {
+	return true, 0
+}
+
+// loadBans reads the ban file, dropping expired bans. A missing file is not an error.
+func (g *ConnectionGater) loadBans() error {
+	if g.banFile == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(g.banFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read ban file: %v", err)
+	}
+
+	var bans []*Ban
+	if err := json.Unmarshal(data, &bans); err != nil {
+		return fmt.Errorf("failed to parse ban file: %v", err)
+	}
+
+	now := time.Now()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, ban := range bans {
+		if ban.expired(now) {
+			continue
+		}
+		rule, err := parseGateRule(ban.Target)
+		if err != nil {
+			log.Printf("Skipping invalid ban: %v\n", err)
+			continue
+		}
+		ban.rule = rule
+		g.bans[rule.raw] = ban
+	}
+	return nil
+}
+
+// saveBans writes the bans in effect to the ban file
+func (g *ConnectionGater) saveBans() {
+	if g.banFile == "" {
+		return
+	}
+	if err := g.writeBanFile(); err != nil {
+		log.Printf("Failed to save bans: %v\n", err)
+	}
+}
+
+// writeBanFile replaces the ban file atomically
+func (g *ConnectionGater) writeBanFile() error {
+	g.saveMu.Lock()
+	defer g.saveMu.Unlock()
+
+	data, err := json.MarshalIndent(g.Bans(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal bans: %v", err)
+	}
+
+	return fileutil.WriteFileAtomic(g.banFile, data, 0600)
+}
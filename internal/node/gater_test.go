@@ -0,0 +1,160 @@
+package node
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// newPeerID returns a random peer ID
+func newPeerID(t *testing.T) peer.ID {
+	_, pub, err := crypto.GenerateEd25519Key(nil)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	id, err := peer.IDFromPublicKey(pub)
+	if err != nil {
+		t.Fatalf("Failed to derive peer ID: %v", err)
+	}
+	return id
+}
+
+// TestConnectionGaterRules tests allow and deny rules by peer ID, CIDR and multiaddr pattern
+func TestConnectionGaterRules(t *testing.T) {
+	fleet, stranger, denied := newPeerID(t), newPeerID(t), newPeerID(t)
+
+	g, err := NewConnectionGater(GaterConfig{
+		Allow: []string{fleet.String(), "10.0.0.0/8", "/ip4/*/tcp/4001"},
+		Deny:  []string{denied.String(), "10.6.6.6"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create gater: %v", err)
+	}
+
+	addr := multiaddr.StringCast
+	cases := []struct {
+		name    string
+		peer    peer.ID
+		addr    string
+		blocked bool
+	}{
+		{"allowed peer from anywhere", fleet, "/ip4/8.8.8.8/tcp/9000", false},
+		{"unknown peer in allowed range", stranger, "/ip4/10.1.2.3/tcp/9000", false},
+		{"unknown peer on allowed port", stranger, "/ip4/8.8.8.8/tcp/4001", false},
+		{"unknown peer elsewhere", stranger, "/ip4/8.8.8.8/tcp/9000", true},
+		{"denied peer in allowed range", denied, "/ip4/10.1.2.3/tcp/9000", true},
+		{"allowed peer from denied address", fleet, "/ip4/10.6.6.6/tcp/4001", true},
+	}
+	for _, c := range cases {
+		if blocked := g.Blocks(c.peer, addr(c.addr)); blocked != c.blocked {
+			t.Errorf("%s: expected blocked=%v, got %v", c.name, c.blocked, blocked)
+		}
+	}
+
+	if !g.InterceptPeerDial(stranger) {
+		t.Errorf("Expected dial to unknown peer to be decided per address")
+	}
+	if g.InterceptPeerDial(denied) {
+		t.Errorf("Expected dial to denied peer to be refused")
+	}
+
+	if !g.RemoveRule(RuleListDeny, "10.6.6.6") || g.Blocks(fleet, addr("/ip4/10.6.6.6/tcp/4001")) {
+		t.Errorf("Expected removed deny rule to no longer block")
+	}
+	if err := g.AddRule(RuleListAllow, "not a rule"); err == nil {
+		t.Errorf("Expected invalid rule to be rejected")
+	}
+}
+
+// TestConnectionGaterBans tests that bans expire and are kept across restarts
+func TestConnectionGaterBans(t *testing.T) {
+	banFile := filepath.Join(t.TempDir(), "bans.json")
+	banned, temporary := newPeerID(t), newPeerID(t)
+	anyAddr := multiaddr.StringCast("/ip4/8.8.8.8/tcp/4001")
+
+	g, err := NewConnectionGater(GaterConfig{BanFile: banFile})
+	if err != nil {
+		t.Fatalf("Failed to create gater: %v", err)
+	}
+
+	if _, err := g.Ban(banned.String(), 0, "spam"); err != nil {
+		t.Fatalf("Failed to ban peer: %v", err)
+	}
+	if _, err := g.Ban("192.0.2.0/24", time.Hour, "scanner"); err != nil {
+		t.Fatalf("Failed to ban range: %v", err)
+	}
+	if _, err := g.Ban(temporary.String(), time.Millisecond, ""); err != nil {
+		t.Fatalf("Failed to ban peer: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	if !g.Blocks(banned, anyAddr) || !g.Blocks(temporary, multiaddr.StringCast("/ip4/192.0.2.7/tcp/4001")) {
+		t.Errorf("Expected banned peer and range to be blocked")
+	}
+	if g.Blocks(temporary, anyAddr) {
+		t.Errorf("Expected expired ban to no longer block")
+	}
+
+	// A new gater loads the bans still in effect
+	reloaded, err := NewConnectionGater(GaterConfig{BanFile: banFile})
+	if err != nil {
+		t.Fatalf("Failed to reload gater: %v", err)
+	}
+	bans := reloaded.Bans()
+	if len(bans) != 2 || bans[0].Target != banned.String() || bans[0].ExpiresAt != nil || bans[1].ExpiresAt == nil {
+		t.Fatalf("Expected permanent and temporary ban to be reloaded, got %+v", bans)
+	}
+	if !reloaded.Blocks(banned, anyAddr) {
+		t.Errorf("Expected reloaded ban to block")
+	}
+
+	if !reloaded.Unban(banned.String()) || reloaded.Blocks(banned, anyAddr) {
+		t.Errorf("Expected unbanned peer to be accepted")
+	}
+}
+
+// TestConnectionGaterHost tests that a host with the gater refuses denied peers
+func TestConnectionGaterHost(t *testing.T) {
+	g, err := NewConnectionGater(GaterConfig{})
+	if err != nil {
+		t.Fatalf("Failed to create gater: %v", err)
+	}
+
+	server, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"), libp2p.ConnectionGater(g))
+	if err != nil {
+		t.Fatalf("Failed to create host: %v", err)
+	}
+	defer server.Close()
+	client, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatalf("Failed to create host: %v", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	serverInfo := peer.AddrInfo{ID: server.ID(), Addrs: server.Addrs()}
+
+	if err := client.Connect(ctx, serverInfo); err != nil {
+		t.Fatalf("Expected connection before the ban: %v", err)
+	}
+
+	g.Ban(client.ID().String(), 0, "test")
+	if closed := g.CloseBlocked(server.Network()); closed != 1 {
+		t.Errorf("Expected the banned peer's connection to be closed, closed %d", closed)
+	}
+	client.Network().ClosePeer(server.ID())
+
+	// The server refuses the connection once the client is authenticated
+	client.Connect(ctx, serverInfo)
+	time.Sleep(100 * time.Millisecond)
+	if len(server.Network().ConnsToPeer(client.ID())) > 0 {
+		t.Errorf("Expected banned peer to be refused")
+	}
+}
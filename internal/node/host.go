@@ -5,11 +5,14 @@ import (
 	"encoding/base64"
 	"fmt"
 	"log"
+	"time"
 
 	libp2p "github.com/libp2p/go-libp2p"
 	crypto "github.com/libp2p/go-libp2p/core/crypto"
 	host "github.com/libp2p/go-libp2p/core/host"
 	peer "github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/pnet"
+	"github.com/libp2p/go-libp2p/p2p/net/connmgr"
 	"github.com/multiformats/go-multiaddr"
 )
 
@@ -22,6 +25,18 @@ type HostConfig struct {
 	ForcePort    bool
 	EnableRelay  bool
 	EnableNATSvc bool
+
+	// Connection manager watermarks: above HighWater connections, unprotected
+	// connections older than GracePeriod are closed until LowWater remain
+	LowWater    int
+	HighWater   int
+	GracePeriod time.Duration
+
+	Gater *ConnectionGater // Refuses connections by peer and address (nil = accept all)
+
+	// PSK restricts the host to a private network of peers sharing the same
+	// pre-shared key (nil = public network). QUIC is not available then.
+	PSK pnet.PSK
 }
 
 // DefaultHostConfig returns sensible defaults for VPS deployment
@@ -32,6 +47,9 @@ func DefaultHostConfig() *HostConfig {
 		ForcePort:    true, // Force specific port for VPS
 		EnableRelay:  true, // Enable relay for NAT traversal
 		EnableNATSvc: true, // Enable NAT service
+		LowWater:     100,
+		HighWater:    400,
+		GracePeriod:  time.Minute,
 	}
 }
 
@@ -58,12 +76,15 @@ func CreateHostWithConfig(ctx context.Context, config *HostConfig) (host.Host, e
 	}
 	listenAddrs = append(listenAddrs, tcpAddr)
 
-	// Add QUIC listener for better performance
-	quicAddr, err := multiaddr.NewMultiaddr(fmt.Sprintf("/ip4/0.0.0.0/udp/%d/quic-v1", config.ListenPort))
-	if err != nil {
-		log.Printf("Warning: Failed to create QUIC listener: %v", err)
-	} else {
-		listenAddrs = append(listenAddrs, quicAddr)
+	// Add QUIC listener for better performance, unless the network is private
+	// since QUIC can't use a pre-shared key
+	if len(config.PSK) == 0 {
+		quicAddr, err := multiaddr.NewMultiaddr(fmt.Sprintf("/ip4/0.0.0.0/udp/%d/quic-v1", config.ListenPort))
+		if err != nil {
+			log.Printf("Warning: Failed to create QUIC listener: %v", err)
+		} else {
+			listenAddrs = append(listenAddrs, quicAddr)
+		}
 	}
 
 	// Configure libp2p options
@@ -73,6 +94,19 @@ func CreateHostWithConfig(ctx context.Context, config *HostConfig) (host.Host, e
 		libp2p.EnableRelay(), // Important for VPS connectivity
 	}
 
+	// Limit the number of connections
+	cmOpt, err := connManagerOption(config)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, cmOpt)
+	if config.Gater != nil {
+		opts = append(opts, libp2p.ConnectionGater(config.Gater))
+	}
+	if len(config.PSK) > 0 {
+		opts = append(opts, libp2p.PrivateNetwork(config.PSK))
+	}
+
 	// Add NAT port mapping for VPS environments
 	if config.EnableNATSvc {
 		opts = append(opts, libp2p.EnableNATService())
@@ -96,6 +130,7 @@ func CreateHostWithConfig(ctx context.Context, config *HostConfig) (host.Host, e
 	if err != nil {
 		return nil, fmt.Errorf("failed to create libp2p host: %v", err)
 	}
+	h = privateNetwork(h, config.PSK)
 
 	HostInstance = h
 
@@ -157,12 +192,15 @@ func CreateHostWithPrivateKey(ctx context.Context, config *HostConfig, priv cryp
 	}
 	listenAddrs = append(listenAddrs, tcpAddr)
 
-	// Add QUIC listener for better performance
-	quicAddr, err := multiaddr.NewMultiaddr(fmt.Sprintf("/ip4/0.0.0.0/udp/%d/quic-v1", config.ListenPort))
-	if err != nil {
-		log.Printf("Warning: Failed to create QUIC listener: %v", err)
-	} else {
-		listenAddrs = append(listenAddrs, quicAddr)
+	// Add QUIC listener for better performance, unless the network is private
+	// since QUIC can't use a pre-shared key
+	if len(config.PSK) == 0 {
+		quicAddr, err := multiaddr.NewMultiaddr(fmt.Sprintf("/ip4/0.0.0.0/udp/%d/quic-v1", config.ListenPort))
+		if err != nil {
+			log.Printf("Warning: Failed to create QUIC listener: %v", err)
+		} else {
+			listenAddrs = append(listenAddrs, quicAddr)
+		}
 	}
 
 	// Configure libp2p options
@@ -173,6 +211,19 @@ func CreateHostWithPrivateKey(ctx context.Context, config *HostConfig, priv cryp
 		libp2p.EnableNATService(),
 	}
 
+	// Limit the number of connections
+	cmOpt, err := connManagerOption(config)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, cmOpt)
+	if config.Gater != nil {
+		opts = append(opts, libp2p.ConnectionGater(config.Gater))
+	}
+	if len(config.PSK) > 0 {
+		opts = append(opts, libp2p.PrivateNetwork(config.PSK))
+	}
+
 	// Force external address if provided (for VPS with known public IP)
 	if config.ExternalIP != "" {
 		extAddr, err := multiaddr.NewMultiaddr(fmt.Sprintf("/ip4/%s/tcp/%d", config.ExternalIP, config.ListenPort))
@@ -191,6 +242,7 @@ func CreateHostWithPrivateKey(ctx context.Context, config *HostConfig, priv cryp
 	if err != nil {
 		return nil, fmt.Errorf("failed to create libp2p host: %v", err)
 	}
+	h = privateNetwork(h, config.PSK)
 
 	log.Printf("Host created: %s\n", h.ID().String())
 	for _, addr := range h.Addrs() {
@@ -206,6 +258,27 @@ func CreateHostWithPrivateKey(ctx context.Context, config *HostConfig, priv cryp
 	return h, nil
 }
 
+// connManagerOption returns the connection manager for the configured watermarks
+func connManagerOption(config *HostConfig) (libp2p.Option, error) {
+	defaults := DefaultHostConfig()
+	low, high, grace := config.LowWater, config.HighWater, config.GracePeriod
+	if low <= 0 {
+		low = defaults.LowWater
+	}
+	if high <= 0 {
+		high = defaults.HighWater
+	}
+	if grace <= 0 {
+		grace = defaults.GracePeriod
+	}
+
+	cm, err := connmgr.NewConnManager(low, high, connmgr.WithGracePeriod(grace))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create connection manager: %v", err)
+	}
+	return libp2p.ConnectionManager(cm), nil
+}
+
 // GeneratePrivateKeyBase64 generates a new private key and returns it as base64
 func GeneratePrivateKeyBase64() (string, peer.ID, error) {
 	priv, _, err := crypto.GenerateKeyPair(crypto.Ed25519, -1)
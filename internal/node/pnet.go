@@ -0,0 +1,92 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	host "github.com/libp2p/go-libp2p/core/host"
+	peer "github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/pnet"
+)
+
+// swarmKeyHeader starts every swarm key file, in the format used by other libp2p implementations
+const swarmKeyHeader = "/key/swarm/psk/1.0.0/"
+
+// ErrSwarmKeyMismatch is returned when the handshake with a peer fails on a
+// private network. A different swarm key is the likely cause, but the
+// handshake can also fail for other reasons.
+var ErrSwarmKeyMismatch = errors.New("handshake failed, peer is likely not in the same private network (swarm key mismatch?)")
+
+// GenerateSwarmKey returns the contents of a new swarm key file holding a
+// random 256-bit pre-shared key
+func GenerateSwarmKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate swarm key: %v", err)
+	}
+	return []byte(swarmKeyHeader + "\n/base16/\n" + hex.EncodeToString(key) + "\n"), nil
+}
+
+// LoadSwarmKey reads the pre-shared key of a private network from a swarm key file
+func LoadSwarmKey(path string) (pnet.PSK, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read swarm key file: %v", err)
+	}
+
+	psk, err := pnet.DecodeV1PSK(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid swarm key file %s: %v", path, err)
+	}
+	return psk, nil
+}
+
+// SwarmKeyFingerprint returns a short hash identifying a pre-shared key.
+// It can be logged and compared between nodes without revealing the key.
+func SwarmKeyFingerprint(psk pnet.PSK) string {
+	sum := sha256.Sum256(psk)
+	return hex.EncodeToString(sum[:8])
+}
+
+// privateNetwork wraps a host created with a pre-shared key so that dial
+// errors caused by a different key are reported as such
+func privateNetwork(h host.Host, psk pnet.PSK) host.Host {
+	if len(psk) == 0 {
+		return h
+	}
+	log.Printf("Private network enabled (swarm key fingerprint %s)\n", SwarmKeyFingerprint(psk))
+	return &privateNetworkHost{Host: h, fingerprint: SwarmKeyFingerprint(psk)}
+}
+
+// privateNetworkHost reports failed handshakes with peers outside the private
+// network as swarm key mismatches. Both sides of such a connection only see
+// garbage from the other, which libp2p reports as a protocol negotiation error.
+type privateNetworkHost struct {
+	host.Host
+	fingerprint string
+}
+
+// Connect connects to a peer, explaining handshake failures caused by a different swarm key
+func (h *privateNetworkHost) Connect(ctx context.Context, ai peer.AddrInfo) error {
+	err := h.Host.Connect(ctx, ai)
+	if err != nil && isHandshakeFailure(err) {
+		return fmt.Errorf("%w, local swarm key fingerprint %s: %v", ErrSwarmKeyMismatch, h.fingerprint, err)
+	}
+	return err
+}
+
+// isHandshakeFailure reports whether a dial error came from a failed security
+// or multiplexer negotiation, which is how a swarm key mismatch shows up
+func isHandshakeFailure(err error) bool {
+	message := err.Error()
+	return strings.Contains(message, "failed to negotiate security protocol") ||
+		strings.Contains(message, "failed to negotiate stream multiplexer")
+}
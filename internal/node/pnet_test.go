@@ -0,0 +1,128 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	crypto "github.com/libp2p/go-libp2p/core/crypto"
+	host "github.com/libp2p/go-libp2p/core/host"
+	peer "github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/pnet"
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// TestSwarmKeyFile tests that generated swarm keys load and that missing or
+// invalid key files are rejected
+func TestSwarmKeyFile(t *testing.T) {
+	key, err := GenerateSwarmKey()
+	if err != nil {
+		t.Fatalf("GenerateSwarmKey failed: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "swarm.key")
+	if err := os.WriteFile(path, key, 0600); err != nil {
+		t.Fatalf("Failed to write swarm key file: %v", err)
+	}
+	psk, err := LoadSwarmKey(path)
+	if err != nil {
+		t.Fatalf("LoadSwarmKey failed: %v", err)
+	}
+	if len(psk) != 32 {
+		t.Errorf("Expected a 32-byte key, got %d bytes", len(psk))
+	}
+	if len(SwarmKeyFingerprint(psk)) != 16 {
+		t.Errorf("Unexpected fingerprint %q", SwarmKeyFingerprint(psk))
+	}
+
+	other, err := GenerateSwarmKey()
+	if err != nil {
+		t.Fatalf("GenerateSwarmKey failed: %v", err)
+	}
+	if string(other) == string(key) {
+		t.Error("Generated swarm keys should differ")
+	}
+
+	if _, err := LoadSwarmKey(filepath.Join(t.TempDir(), "missing.key")); err == nil {
+		t.Error("Expected an error for a missing swarm key file")
+	}
+	if err := os.WriteFile(path, []byte("not a swarm key\n"), 0600); err != nil {
+		t.Fatalf("Failed to write swarm key file: %v", err)
+	}
+	if _, err := LoadSwarmKey(path); err == nil {
+		t.Error("Expected an error for an invalid swarm key file")
+	}
+}
+
+// newPrivateHost creates a host on a random local port in the private network of the key
+func newPrivateHost(t *testing.T, psk pnet.PSK) host.Host {
+	t.Helper()
+
+	priv, _, err := crypto.GenerateKeyPair(crypto.Ed25519, -1)
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	config := DefaultHostConfig()
+	config.ListenPort = 0
+	config.EnableNATSvc = false
+	config.PSK = psk
+
+	h, err := CreateHostWithPrivateKey(context.Background(), config, priv)
+	if err != nil {
+		t.Fatalf("Failed to create host: %v", err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+// TestPrivateNetworkHosts tests that hosts sharing a swarm key connect over
+// TCP only, and that a host with another key gets ErrSwarmKeyMismatch
+func TestPrivateNetworkHosts(t *testing.T) {
+	newKey := func() pnet.PSK {
+		path := filepath.Join(t.TempDir(), "swarm.key")
+		key, err := GenerateSwarmKey()
+		if err != nil {
+			t.Fatalf("GenerateSwarmKey failed: %v", err)
+		}
+		if err := os.WriteFile(path, key, 0600); err != nil {
+			t.Fatalf("Failed to write swarm key file: %v", err)
+		}
+		psk, err := LoadSwarmKey(path)
+		if err != nil {
+			t.Fatalf("LoadSwarmKey failed: %v", err)
+		}
+		return psk
+	}
+	key, otherKey := newKey(), newKey()
+
+	server := newPrivateHost(t, key)
+	for _, addr := range server.Addrs() {
+		if _, err := addr.ValueForProtocol(multiaddr.P_QUIC_V1); err == nil {
+			t.Errorf("Private host should not listen on QUIC: %s", addr)
+		}
+	}
+	target := peer.AddrInfo{ID: server.ID()}
+	for _, addr := range server.Addrs() {
+		if manet.IsIPLoopback(addr) {
+			target.Addrs = append(target.Addrs, addr)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	member := newPrivateHost(t, key)
+	if err := member.Connect(ctx, target); err != nil {
+		t.Fatalf("Host with the same key should connect: %v", err)
+	}
+
+	outsider := newPrivateHost(t, otherKey)
+	err := outsider.Connect(ctx, target)
+	if !errors.Is(err, ErrSwarmKeyMismatch) {
+		t.Fatalf("Expected a swarm key mismatch, got %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/realentity/realentity-node/internal/services"
+)
+
+// LegacyResponse is the answer sent to clients using the legacy Request
+// format. A legacy request looks exactly like a current request with a string
+// payload and no request ID, so the answer also carries every ServiceResponse
+// field and clients of either format can read it.
+type LegacyResponse struct {
+	*services.ServiceResponse
+	Service string `json:"service"`
+	Payload string `json:"payload,omitempty"`
+}
+
+// LegacyStats describes how often the legacy request format is still used
+type LegacyStats struct {
+	Requests int64      `json:"requests"`
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+	LastPeer string     `json:"last_peer,omitempty"`
+	Peers    int        `json:"peers"` // Distinct peers that sent legacy requests
+}
+
+var legacyUsage = struct {
+	stats LegacyStats
+	peers map[string]bool
+	mu    sync.Mutex
+}{
+	peers: make(map[string]bool),
+}
+
+// GetLegacyStats returns usage counters for the legacy request format
+func GetLegacyStats() LegacyStats {
+	legacyUsage.mu.Lock()
+	defer legacyUsage.mu.Unlock()
+	return legacyUsage.stats
+}
+
+// recordLegacyRequest counts a legacy request from the given peer
+func recordLegacyRequest(peerID string) {
+	legacyUsage.mu.Lock()
+	defer legacyUsage.mu.Unlock()
+
+	legacyUsage.stats.Requests++
+	now := time.Now()
+	legacyUsage.stats.LastSeen = &now
+	legacyUsage.stats.LastPeer = peerID
+	if !legacyUsage.peers[peerID] {
+		legacyUsage.peers[peerID] = true
+		legacyUsage.stats.Peers = len(legacyUsage.peers)
+	}
+}
+
+// parseRequest detects the request format and converts it to a ServiceRequest.
+// Legacy requests carry their payload as a string and have none of the other
+// fields of the current format.
+func parseRequest(raw json.RawMessage) (*services.ServiceRequest, bool, error) {
+	var probe services.ServiceRequest
+	if err := json.Unmarshal(raw, &probe); err != nil {
+		return nil, false, err
+	}
+
+	payload := bytes.TrimSpace(probe.Payload)
+	current := probe.RequestID != "" || probe.HopCount != 0 || len(probe.Route) > 0 || len(probe.Metadata) > 0
+	if !current && len(payload) > 0 && payload[0] == '"' {
+		var legacy Request
+		if err := json.Unmarshal(raw, &legacy); err != nil {
+			return nil, false, err
+		}
+		request, err := translateLegacyRequest(&legacy)
+		return request, true, err
+	}
+
+	return &probe, false, nil
+}
+
+// translateLegacyRequest converts a legacy request to the current format
+func translateLegacyRequest(legacy *Request) (*services.ServiceRequest, error) {
+	// Legacy clients either sent JSON encoded as a string or plain text
+	payload := json.RawMessage(legacy.Payload)
+	if !json.Valid(payload) {
+		encoded, err := json.Marshal(legacy.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode legacy payload: %v", err)
+		}
+		payload = encoded
+	}
+
+	return &services.ServiceRequest{
+		Service:   legacy.Service,
+		Payload:   payload,
+		RequestID: "legacy-" + uuid.New().String(),
+	}, nil
+}
+
+// toLegacyResponse adds the legacy fields to a response. Results that are
+// JSON strings are unquoted, as legacy payloads were plain strings.
+func toLegacyResponse(service string, response *services.ServiceResponse) *LegacyResponse {
+	payload := string(response.Result)
+	var text string
+	if err := json.Unmarshal(response.Result, &text); err == nil {
+		payload = text
+	}
+
+	return &LegacyResponse{
+		ServiceResponse: response,
+		Service:         service,
+		Payload:         payload,
+	}
+}
@@ -2,58 +2,326 @@ package protocol
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"time"
 
 	host "github.com/libp2p/go-libp2p/core/host"
 	network "github.com/libp2p/go-libp2p/core/network"
 	protocol "github.com/libp2p/go-libp2p/core/protocol"
 	"github.com/realentity/realentity-node/internal/services"
+	"github.com/realentity/realentity-node/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// Legacy Request struct for backward compatibility
+const (
+	// ProtocolID is the protocol used for service execution requests
+	ProtocolID = "/realentity/1.0.0"
+	// PersistentProtocolID carries sequential requests over one reusable stream
+	PersistentProtocolID = "/realentity/1.1.0"
+	// ServicesProtocolID is the protocol used to query the services a peer provides
+	ServicesProtocolID = "/realentity/services/1.0.0"
+	// DescribeProtocolID is the protocol used to query a peer's services and labels
+	DescribeProtocolID = "/realentity/describe/1.0.0"
+	// PEXProtocolID is the protocol used to exchange known peers
+	PEXProtocolID = "/realentity/pex/1.0.0"
+)
+
+// PeerDescription is what a peer reports about itself over the describe protocol
+type PeerDescription struct {
+	Services []string `json:"services"`
+	Labels   []string `json:"labels,omitempty"`
+}
+
+// Request is the legacy request format with a string payload, still accepted
+// for backward compatibility and answered with a LegacyResponse
 type Request struct {
 	Service string `json:"service"`
 	Payload string `json:"payload"`
 }
 
+// HandleStream handles a service request stream using the default limits
 func HandleStream(stream network.Stream) {
+	NewStreamHandler(DefaultHandlerConfig())(stream)
+}
+
+// NewStreamHandler creates a stream handler that enforces the given deadlines and limits
+func NewStreamHandler(config *HandlerConfig) network.StreamHandler {
+	config = config.withDefaults()
+
+	return func(stream network.Stream) {
+		serveStream(stream, config, false)
+	}
+}
+
+// NewPersistentStreamHandler creates a handler that answers sequential
+// requests on the same stream until the client closes it or goes idle
+func NewPersistentStreamHandler(config *HandlerConfig) network.StreamHandler {
+	config = config.withDefaults()
+
+	return func(stream network.Stream) {
+		serveStream(stream, config, true)
+	}
+}
+
+// frame is a single JSON value read from a stream
+type frame struct {
+	raw json.RawMessage
+	err error
+}
+
+// readFrames decodes JSON values from the stream until it fails
+func readFrames(reader *requestReader) <-chan frame {
+	frames := make(chan frame)
+
+	go func() {
+		defer close(frames)
+		decoder := json.NewDecoder(reader)
+		for {
+			reader.resetLimit()
+
+			var raw json.RawMessage
+			err := decoder.Decode(&raw)
+			frames <- frame{raw: raw, err: err}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	return frames
+}
+
+func serveStream(stream network.Stream, config *HandlerConfig, persistent bool) {
 	log.Println("New stream opened")
 	defer stream.Close()
 
-	rw := bufio.NewReadWriter(bufio.NewReader(stream), bufio.NewWriter(stream))
+	reader := newRequestReader(stream, config)
+	frames := readFrames(reader)
+	defer func() {
+		// Unblock the frame reader so it can exit
+		stream.CloseRead()
+		for range frames {
+		}
+	}()
+
+	var pending *frame
+	for {
+		// Wait for the next request within the read deadlines
+		reader.beginRequest()
+		next := pending
+		pending = nil
+		if next == nil {
+			f, ok := <-frames
+			if !ok {
+				return
+			}
+			next = &f
+		}
+		reader.endRequest()
+
+		if next.err != nil {
+			// A persistent stream simply ends when the client is done or idle
+			if persistent && (errors.Is(next.err, io.EOF) || isTimeout(next.err)) {
+				return
+			}
+
+			log.Println("Invalid request:", next.err)
+			message := "Invalid request format"
+			if errors.Is(next.err, errRequestTooLarge) {
+				message = fmt.Sprintf("Request exceeds maximum size of %d bytes", config.MaxRequestSize)
+			} else if isTimeout(next.err) {
+				message = "Timed out waiting for request"
+			}
 
-	// Try to parse as ServiceRequest first, then fall back to legacy Request
-	var serviceReq services.ServiceRequest
-	decoder := json.NewDecoder(rw)
+			writeResponse(stream, config, &services.ServiceResponse{
+				Success: false,
+				Error:   message,
+			})
+			return
+		}
+
+		serviceReq, legacy, err := parseRequest(next.raw)
+		if err != nil {
+			log.Println("Invalid request:", err)
+			writeResponse(stream, config, &services.ServiceResponse{
+				Success: false,
+				Error:   "Invalid request format",
+			})
+			if !persistent {
+				return
+			}
+			continue
+		}
+
+		var reply interface{}
+		reply, pending = handleRequest(stream, config, serviceReq, legacy, frames)
+		if reply == nil {
+			return
+		}
 
-	if err := decoder.Decode(&serviceReq); err != nil {
-		log.Println("Invalid request:", err)
-		errorResponse := services.ServiceResponse{
-			Success: false,
-			Error:   "Invalid request format",
+		if err := writeResponse(stream, config, reply); err != nil {
+			log.Printf("Failed to send response: %v\n", err)
+			return
+		}
+		log.Printf("Response sent for request %s\n", serviceReq.RequestID)
+
+		if !persistent {
+			return
 		}
-		json.NewEncoder(rw).Encode(errorResponse)
-		rw.Flush()
-		return
 	}
+}
 
-	log.Printf("Received service request: %s (ID: %s)\n", serviceReq.Service, serviceReq.RequestID)
+// handleRequest executes a request while watching the stream for a cancel
+// frame. Any other frame received meanwhile is returned as pending.
+func handleRequest(stream network.Stream, config *HandlerConfig, serviceReq *services.ServiceRequest, legacy bool, frames <-chan frame) (interface{}, *frame) {
+	remotePeer := stream.Conn().RemotePeer().String()
+	if legacy {
+		recordLegacyRequest(remotePeer)
+		log.Printf("Legacy request format used by peer %s for service %s\n", remotePeer, serviceReq.Service)
+	}
 
-	// Execute the service
-	response := services.GlobalRegistry.ExecuteService(&serviceReq)
+	// Continue the caller's trace
+	ctx, span := tracing.Tracer(config.TracerProvider).Start(tracing.Extract(context.Background(), serviceReq),
+		"protocol.handle "+serviceReq.Service,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(tracing.RequestAttributes(serviceReq)...),
+		trace.WithAttributes(
+			attribute.String("realentity.remote_peer", remotePeer),
+			attribute.Bool("realentity.legacy_request", legacy),
+		))
 
-	// Send response
-	if err := json.NewEncoder(rw).Encode(response); err != nil {
-		log.Printf("Failed to send response: %v\n", err)
-		return
+	log.Printf("Received service request: %s (ID: %s, trace: %s)\n", serviceReq.Service, serviceReq.RequestID, tracing.TraceID(ctx))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(chan *services.ServiceResponse, 1)
+	go func() {
+		done <- config.registry().ExecuteServiceContext(ctx, serviceReq)
+	}()
+
+	// Watch for a cancel frame while the service executes
+	var pending *frame
+	var response *services.ServiceResponse
+	for response == nil {
+		select {
+		case response = <-done:
+		case f, ok := <-frames:
+			if !ok {
+				frames = nil
+				continue
+			}
+			if isCancelFrame(f, serviceReq.RequestID) {
+				log.Printf("Request %s cancelled by client\n", serviceReq.RequestID)
+				cancel()
+				continue
+			}
+			// Keep anything else, including read errors, for the caller
+			pending = &f
+			frames = nil
+		}
+	}
+	tracing.EndSpan(span, response, nil)
+
+	// Answer in the format the client used
+	if legacy {
+		return toLegacyResponse(serviceReq.Service, response), pending
+	}
+	return response, pending
+}
+
+// isCancelFrame reports whether f asks to cancel the given request
+func isCancelFrame(f frame, requestID string) bool {
+	if f.err != nil {
+		return false
 	}
 
-	rw.Flush()
-	log.Printf("Response sent for request %s\n", serviceReq.RequestID)
+	var control ControlFrame
+	if err := json.Unmarshal(f.raw, &control); err != nil {
+		return false
+	}
+	return control.Type == FrameTypeCancel && (control.RequestID == "" || control.RequestID == requestID)
+}
+
+// writeResponse sends a response within the configured write deadline
+func writeResponse(stream network.Stream, config *HandlerConfig, response interface{}) error {
+	stream.SetWriteDeadline(time.Now().Add(config.WriteTimeout))
+	defer stream.SetWriteDeadline(time.Time{})
+
+	w := bufio.NewWriter(stream)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		return err
+	}
+	return w.Flush()
 }
 
 func RegisterHandler(h host.Host, protocolID string) {
-	h.SetStreamHandler(protocol.ID(protocolID), HandleStream)
+	RegisterHandlerWithConfig(h, protocolID, DefaultHandlerConfig())
+}
+
+// RegisterHandlerWithConfig registers the service protocol handler with custom limits
+func RegisterHandlerWithConfig(h host.Host, protocolID string, config *HandlerConfig) {
+	h.SetStreamHandler(protocol.ID(protocolID), NewStreamHandler(config))
 	log.Printf("Protocol handler registered for: %s\n", protocolID)
 }
+
+// RegisterPersistentHandler registers the handler for reusable request streams
+func RegisterPersistentHandler(h host.Host, config *HandlerConfig) {
+	h.SetStreamHandler(protocol.ID(PersistentProtocolID), NewPersistentStreamHandler(config))
+	log.Printf("Protocol handler registered for: %s\n", PersistentProtocolID)
+}
+
+// HandleServicesStream answers with the list of services registered on this node
+func HandleServicesStream(stream network.Stream) {
+	serveServiceList(stream, services.GlobalRegistry)
+}
+
+func serveServiceList(stream network.Stream, registry *services.Registry) {
+	defer stream.Close()
+
+	if err := json.NewEncoder(stream).Encode(registry.ListServices()); err != nil {
+		log.Printf("Failed to send service list: %v\n", err)
+	}
+}
+
+// RegisterServicesHandler registers the service listing protocol handler
+func RegisterServicesHandler(h host.Host) {
+	h.SetStreamHandler(protocol.ID(ServicesProtocolID), HandleServicesStream)
+	log.Printf("Protocol handler registered for: %s\n", ServicesProtocolID)
+}
+
+// RegisterServicesHandlerWithRegistry registers the service listing protocol
+// handler for the services of the given registry
+func RegisterServicesHandlerWithRegistry(h host.Host, registry *services.Registry) {
+	h.SetStreamHandler(protocol.ID(ServicesProtocolID), func(stream network.Stream) {
+		serveServiceList(stream, registry)
+	})
+	log.Printf("Protocol handler registered for: %s\n", ServicesProtocolID)
+}
+
+// RegisterDescribeHandler registers the handler describing the services of
+// the registry (nil = services.GlobalRegistry) and the given labels
+func RegisterDescribeHandler(h host.Host, registry *services.Registry, labels []string) {
+	h.SetStreamHandler(protocol.ID(DescribeProtocolID), func(stream network.Stream) {
+		defer stream.Close()
+
+		serving := registry
+		if serving == nil {
+			serving = services.GlobalRegistry
+		}
+		description := PeerDescription{
+			Services: serving.ListServices(),
+			Labels:   labels,
+		}
+		if err := json.NewEncoder(stream).Encode(description); err != nil {
+			log.Printf("Failed to send peer description: %v\n", err)
+		}
+	})
+	log.Printf("Protocol handler registered for: %s\n", DescribeProtocolID)
+}
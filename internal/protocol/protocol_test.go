@@ -0,0 +1,198 @@
+package protocol_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	libp2pprotocol "github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/realentity/realentity-node/internal/protocol"
+	"github.com/realentity/realentity-node/internal/services"
+	"github.com/realentity/realentity-node/internal/testutil"
+	"github.com/realentity/realentity-node/internal/utils"
+)
+
+// newConnectedHosts creates a server with the protocol handler and a client connected to it
+func newConnectedHosts(t *testing.T, config *protocol.HandlerConfig) (host.Host, host.Host) {
+	return testutil.NewConnectedHosts(t, func(server host.Host) {
+		protocol.RegisterHandlerWithConfig(server, protocol.ProtocolID, config)
+	})
+}
+
+// useTestRegistry swaps the global registry for the duration of a test
+func useTestRegistry(t *testing.T) *services.Registry {
+	original := services.GlobalRegistry
+	services.GlobalRegistry = services.NewRegistry()
+	t.Cleanup(func() { services.GlobalRegistry = original })
+	return services.GlobalRegistry
+}
+
+// TestCancelPropagatesToHandler tests that a cancelled call cancels the remote handler context
+func TestCancelPropagatesToHandler(t *testing.T) {
+	registry := useTestRegistry(t)
+	server, client := newConnectedHosts(t, protocol.DefaultHandlerConfig())
+
+	cancelled := make(chan struct{})
+	registry.RegisterService(&services.Service{
+		Name: "slow",
+		ContextHandler: func(ctx context.Context, payload []byte) ([]byte, error) {
+			<-ctx.Done()
+			close(cancelled)
+			return nil, ctx.Err()
+		},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	_, err := utils.NewServiceClient(client).CallService(ctx, server.ID(), "slow", map[string]string{})
+	if err == nil {
+		t.Fatal("Expected call to fail after cancellation")
+	}
+
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Handler context was not cancelled")
+	}
+}
+
+// TestRequestSizeLimit tests that oversized requests are rejected
+func TestRequestSizeLimit(t *testing.T) {
+	useTestRegistry(t)
+	server, client := newConnectedHosts(t, &protocol.HandlerConfig{MaxRequestSize: 64})
+
+	stream, err := client.NewStream(context.Background(), server.ID(), libp2pprotocol.ID(protocol.ProtocolID))
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	defer stream.Close()
+
+	request := services.ServiceRequest{
+		Service:   "echo",
+		Payload:   json.RawMessage(`"` + strings.Repeat("x", 256) + `"`),
+		RequestID: "large-request",
+	}
+	json.NewEncoder(stream).Encode(request)
+
+	var response services.ServiceResponse
+	if err := json.NewDecoder(stream).Decode(&response); err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	if response.Success || !strings.Contains(response.Error, "maximum size") {
+		t.Errorf("Expected size limit error, got %+v", response)
+	}
+}
+
+// TestIdleStreamTimesOut tests that a stream without a request is closed after the idle timeout
+func TestIdleStreamTimesOut(t *testing.T) {
+	useTestRegistry(t)
+	server, client := newConnectedHosts(t, &protocol.HandlerConfig{IdleTimeout: 200 * time.Millisecond})
+
+	stream, err := client.NewStream(context.Background(), server.ID(), libp2pprotocol.ID(protocol.ProtocolID))
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	defer stream.Close()
+
+	// Send a partial request and stall
+	stream.Write([]byte(`{"service":`))
+	stream.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var response services.ServiceResponse
+	if err := json.NewDecoder(stream).Decode(&response); err != nil {
+		t.Fatalf("Expected a timeout response, got error: %v", err)
+	}
+	if response.Success || !strings.Contains(response.Error, "Timed out") {
+		t.Errorf("Expected timeout error, got %+v", response)
+	}
+}
+
+// TestLegacyRequestFormat tests that legacy requests are executed and answered in the legacy shape
+func TestLegacyRequestFormat(t *testing.T) {
+	registry := useTestRegistry(t)
+	server, client := newConnectedHosts(t, protocol.DefaultHandlerConfig())
+
+	registry.RegisterService(&services.Service{
+		Name: "upper",
+		Handler: func(payload []byte) ([]byte, error) {
+			var text string
+			if err := json.Unmarshal(payload, &text); err != nil {
+				return nil, err
+			}
+			return json.Marshal(strings.ToUpper(text))
+		},
+	})
+
+	before := protocol.GetLegacyStats().Requests
+
+	stream, err := client.NewStream(context.Background(), server.ID(), libp2pprotocol.ID(protocol.ProtocolID))
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	defer stream.Close()
+
+	json.NewEncoder(stream).Encode(protocol.Request{Service: "upper", Payload: "hello"})
+
+	var response protocol.LegacyResponse
+	if err := json.NewDecoder(stream).Decode(&response); err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	if response.Error != "" {
+		t.Fatalf("Legacy request failed: %s", response.Error)
+	}
+	if response.Payload != "HELLO" {
+		t.Errorf("Expected payload 'HELLO', got '%s'", response.Payload)
+	}
+	if !response.Success || string(response.Result) != `"HELLO"` {
+		t.Errorf("Expected the current response fields too, got %+v", response.ServiceResponse)
+	}
+	stats := protocol.GetLegacyStats()
+	if stats.Requests != before+1 {
+		t.Errorf("Expected legacy request count %d, got %d", before+1, stats.Requests)
+	}
+	if stats.LastSeen == nil {
+		t.Error("Expected the time of the last legacy request")
+	}
+}
+
+// TestStringPayloadCurrentFormat tests that a request with a string payload
+// and current-format fields is not taken for a legacy request
+func TestStringPayloadCurrentFormat(t *testing.T) {
+	registry := useTestRegistry(t)
+	server, client := newConnectedHosts(t, protocol.DefaultHandlerConfig())
+
+	registry.RegisterService(&services.Service{
+		Name: "echo",
+		Handler: func(payload []byte) ([]byte, error) {
+			return payload, nil
+		},
+	})
+
+	before := protocol.GetLegacyStats().Requests
+
+	stream, err := client.NewStream(context.Background(), server.ID(), libp2pprotocol.ID(protocol.ProtocolID))
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	defer stream.Close()
+
+	stream.Write([]byte(`{"service":"echo","payload":"{\"a\":1}","metadata":{"caller":"test"}}` + "\n"))
+
+	var response map[string]interface{}
+	if err := json.NewDecoder(stream).Decode(&response); err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	if _, legacy := response["service"]; legacy {
+		t.Errorf("Expected a current format response, got %v", response)
+	}
+	if response["result"] != `{"a":1}` {
+		t.Errorf("Expected the string payload echoed unchanged, got %v", response["result"])
+	}
+	if stats := protocol.GetLegacyStats(); stats.Requests != before {
+		t.Errorf("Expected legacy request count %d, got %d", before, stats.Requests)
+	}
+}
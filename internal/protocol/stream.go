@@ -0,0 +1,162 @@
+package protocol
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	network "github.com/libp2p/go-libp2p/core/network"
+	"github.com/realentity/realentity-node/internal/services"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// FrameTypeCancel asks the handler to abort the in-flight request
+const FrameTypeCancel = "cancel"
+
+// ControlFrame is sent by a client on an open stream after its request
+// to control the execution of that request
+type ControlFrame struct {
+	Type      string `json:"type"`
+	RequestID string `json:"requestId"`
+}
+
+// HandlerConfig contains deadlines and limits for incoming streams
+type HandlerConfig struct {
+	ReadTimeout    time.Duration // Total time allowed to receive a request
+	IdleTimeout    time.Duration // Time allowed between reads while receiving a request
+	WriteTimeout   time.Duration // Time allowed to send a response
+	MaxRequestSize int64         // Maximum request size in bytes
+
+	// Registry executes the requests (nil = services.GlobalRegistry)
+	Registry *services.Registry
+	// TracerProvider records handler spans (nil = global tracer provider)
+	TracerProvider trace.TracerProvider
+}
+
+// DefaultHandlerConfig returns the limits used when none are configured
+func DefaultHandlerConfig() *HandlerConfig {
+	return &HandlerConfig{
+		ReadTimeout:    30 * time.Second,
+		IdleTimeout:    10 * time.Second,
+		WriteTimeout:   30 * time.Second,
+		MaxRequestSize: 1 << 20, // 1 MiB
+	}
+}
+
+// withDefaults fills unset fields from the default configuration
+func (c *HandlerConfig) withDefaults() *HandlerConfig {
+	defaults := DefaultHandlerConfig()
+	if c == nil {
+		return defaults
+	}
+
+	result := *c
+	if result.ReadTimeout <= 0 {
+		result.ReadTimeout = defaults.ReadTimeout
+	}
+	if result.IdleTimeout <= 0 {
+		result.IdleTimeout = defaults.IdleTimeout
+	}
+	if result.WriteTimeout <= 0 {
+		result.WriteTimeout = defaults.WriteTimeout
+	}
+	if result.MaxRequestSize <= 0 {
+		result.MaxRequestSize = defaults.MaxRequestSize
+	}
+	return &result
+}
+
+// registry returns the registry serving requests on this handler
+func (c *HandlerConfig) registry() *services.Registry {
+	if c.Registry == nil {
+		return services.GlobalRegistry
+	}
+	return c.Registry
+}
+
+var errRequestTooLarge = errors.New("request too large")
+
+// requestReader limits the size of each frame read from a stream and enforces
+// the read deadlines while the handler is waiting for a request. While a
+// request executes it reads without a deadline so cancel frames can arrive.
+type requestReader struct {
+	stream    network.Stream
+	config    *HandlerConfig
+	mu        sync.Mutex
+	deadline  time.Time
+	remaining int64
+	receiving bool
+}
+
+func newRequestReader(stream network.Stream, config *HandlerConfig) *requestReader {
+	return &requestReader{
+		stream:    stream,
+		config:    config,
+		remaining: config.MaxRequestSize,
+	}
+}
+
+// beginRequest starts enforcing the read deadlines for the next request
+func (r *requestReader) beginRequest() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.receiving = true
+	r.deadline = time.Now().Add(r.config.ReadTimeout)
+	// Also bounds a read that is already blocked
+	r.stream.SetReadDeadline(r.nextDeadline())
+}
+
+// endRequest stops enforcing the read deadlines once a request has been read
+func (r *requestReader) endRequest() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.receiving = false
+	r.stream.SetReadDeadline(time.Time{})
+}
+
+// resetLimit restores the size budget before reading the next frame
+func (r *requestReader) resetLimit() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.remaining = r.config.MaxRequestSize
+}
+
+// nextDeadline returns the deadline for the next read; r.mu must be held
+func (r *requestReader) nextDeadline() time.Time {
+	deadline := time.Now().Add(r.config.IdleTimeout)
+	if r.deadline.Before(deadline) {
+		deadline = r.deadline
+	}
+	return deadline
+}
+
+func (r *requestReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	if r.remaining <= 0 {
+		r.mu.Unlock()
+		return 0, errRequestTooLarge
+	}
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	if r.receiving {
+		r.stream.SetReadDeadline(r.nextDeadline())
+	}
+	r.mu.Unlock()
+
+	n, err := r.stream.Read(p)
+
+	r.mu.Lock()
+	r.remaining -= int64(n)
+	r.mu.Unlock()
+	return n, err
+}
+
+// isTimeout reports whether err was caused by an expired deadline
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,233 @@
+package routing
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/realentity/realentity-node/internal/discovery"
+	"github.com/realentity/realentity-node/internal/services"
+	"github.com/realentity/realentity-node/internal/tracing"
+	"github.com/realentity/realentity-node/internal/utils"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// DefaultMaxHops is used when no hop limit is configured
+	DefaultMaxHops = 3
+	// DefaultTimeout is used when no forwarding timeout is configured
+	DefaultTimeout = 30 * time.Second
+	// serviceQueryTimeout bounds how long we wait for a peer's service list
+	serviceQueryTimeout = 5 * time.Second
+	// serviceRefreshInterval is the minimum time between two queries of the
+	// services of connected peers. In between, services no peer provides are
+	// reported missing from the known service lists.
+	serviceRefreshInterval = 10 * time.Second
+)
+
+// Router forwards requests for services that are not available locally
+// to peers that advertise them
+type Router struct {
+	host      host.Host
+	discovery *discovery.DiscoveryManager
+	client    *utils.ServiceClient
+	maxHops   int
+	timeout   time.Duration
+	tracer    trace.Tracer
+
+	mu        sync.Mutex
+	refreshed time.Time // When connected peers were last asked for their services
+}
+
+// NewRouter creates a new request router forwarding requests with client
+func NewRouter(h host.Host, dm *discovery.DiscoveryManager, client *utils.ServiceClient, maxHops int, timeout time.Duration) *Router {
+	if maxHops <= 0 {
+		maxHops = DefaultMaxHops
+	}
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	return &Router{
+		host:      h,
+		discovery: dm,
+		client:    client,
+		maxHops:   maxHops,
+		timeout:   timeout,
+		tracer:    tracing.Tracer(nil),
+	}
+}
+
+// SetTracerProvider sets the tracer provider recording forwarding spans
+func (r *Router) SetTracerProvider(provider trace.TracerProvider) {
+	r.tracer = tracing.Tracer(provider)
+}
+
+// Forward sends the request to a remote provider and returns its response
+func (r *Router) Forward(ctx context.Context, request *services.ServiceRequest) *services.ServiceResponse {
+	self := r.host.ID().String()
+
+	// Refuse requests that already passed through this node
+	for _, id := range request.Route {
+		if id == self {
+			return errorResponse(request, fmt.Sprintf("routing loop detected for service '%s'", request.Service))
+		}
+	}
+
+	if request.HopCount >= r.maxHops {
+		return errorResponse(request, fmt.Sprintf("hop limit of %d exceeded for service '%s'", r.maxHops, request.Service))
+	}
+
+	ctx, span := r.tracer.Start(ctx, "routing.forward "+request.Service,
+		trace.WithAttributes(tracing.RequestAttributes(request)...))
+	response := r.forward(ctx, request, self)
+	tracing.EndSpan(span, response, nil)
+	return response
+}
+
+// forward tries each known provider in turn until one answers
+func (r *Router) forward(ctx context.Context, request *services.ServiceRequest, self string) *services.ServiceResponse {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	providers := r.findProviders(ctx, request.Service, request.Route)
+	if len(providers) == 0 {
+		response := errorResponse(request, fmt.Sprintf("service '%s' not found", request.Service))
+		response.Code = services.ErrCodeServiceNotFound
+		return response
+	}
+
+	// Record this hop before handing the request on
+	forwarded := *request
+	forwarded.HopCount = request.HopCount + 1
+	forwarded.Route = append(append([]string(nil), request.Route...), self)
+
+	var lastErr string
+	for _, providerID := range providers {
+		log.Printf("Forwarding request %s for service %s to peer %s (hop %d)\n",
+			request.RequestID, request.Service, utils.FormatPeerID(providerID), forwarded.HopCount)
+
+		response, err := r.client.SendRequest(ctx, providerID, &forwarded)
+		if err != nil {
+			log.Printf("Forwarding to peer %s failed: %v\n", utils.FormatPeerID(providerID), err)
+			lastErr = err.Error()
+			continue
+		}
+
+		// The provider no longer offers the service; forget it and try the next one
+		if !response.Success && response.Code == services.ErrCodeServiceNotFound {
+			r.discovery.UpdatePeerServices(providerID, removeService(r.discovery.GetPeers()[providerID], request.Service))
+			lastErr = response.Error
+			continue
+		}
+
+		if response.ServedBy == "" {
+			response.ServedBy = providerID.String()
+		}
+		return response
+	}
+
+	return errorResponse(request, fmt.Sprintf("failed to forward request for service '%s': %s", request.Service, lastErr))
+}
+
+// findProviders returns connected peers advertising the service, best first.
+// Peers already on the request route are skipped. The service lists are kept
+// current by the peer prober, so connected peers are only asked directly when
+// no provider is known, and at most once per serviceRefreshInterval.
+func (r *Router) findProviders(ctx context.Context, service string, route []string) []peer.ID {
+	providers := r.connectedProviders(service, route)
+	if len(providers) > 0 || !r.startRefresh() {
+		return providers
+	}
+
+	r.refreshServices(ctx, route)
+	return r.connectedProviders(service, route)
+}
+
+// startRefresh reports whether connected peers may be asked for their
+// services now, recording the refresh if so
+func (r *Router) startRefresh() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.refreshed) < serviceRefreshInterval {
+		return false
+	}
+	r.refreshed = time.Now()
+	return true
+}
+
+// connectedProviders returns the usable providers of a service that are not on the route
+func (r *Router) connectedProviders(service string, route []string) []peer.ID {
+	visited := make(map[string]bool, len(route))
+	for _, id := range route {
+		visited[id] = true
+	}
+
+	var ids []peer.ID
+	for _, id := range r.discovery.FindProviders(service) {
+		if !visited[id.String()] {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// refreshServices queries every connected peer for its service list, all
+// peers at once
+func (r *Router) refreshServices(ctx context.Context, route []string) {
+	visited := make(map[string]bool, len(route))
+	for _, id := range route {
+		visited[id] = true
+	}
+
+	var wg sync.WaitGroup
+	for _, peerID := range r.host.Network().Peers() {
+		if visited[peerID.String()] {
+			continue
+		}
+
+		wg.Add(1)
+		go func(peerID peer.ID) {
+			defer wg.Done()
+
+			queryCtx, cancel := context.WithTimeout(ctx, serviceQueryTimeout)
+			defer cancel()
+			description, err := r.client.DescribeRemotePeer(queryCtx, peerID)
+			if err != nil {
+				log.Printf("Failed to query services of peer %s: %v\n", utils.FormatPeerID(peerID), err)
+				return
+			}
+
+			r.discovery.UpdatePeerServices(peerID, description.Services)
+			r.discovery.UpdatePeerLabels(peerID, description.Labels)
+		}(peerID)
+	}
+	wg.Wait()
+}
+
+func removeService(info *discovery.PeerInfo, service string) []string {
+	if info == nil {
+		return nil
+	}
+
+	remaining := make([]string, 0, len(info.Services))
+	for _, name := range info.Services {
+		if name != service {
+			remaining = append(remaining, name)
+		}
+	}
+	return remaining
+}
+
+func errorResponse(request *services.ServiceRequest, message string) *services.ServiceResponse {
+	return &services.ServiceResponse{
+		RequestID: request.RequestID,
+		Success:   false,
+		Error:     message,
+	}
+}
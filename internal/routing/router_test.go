@@ -0,0 +1,181 @@
+package routing
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/realentity/realentity-node/internal/discovery"
+	"github.com/realentity/realentity-node/internal/protocol"
+	"github.com/realentity/realentity-node/internal/services"
+	"github.com/realentity/realentity-node/internal/testutil"
+	"github.com/realentity/realentity-node/internal/utils"
+)
+
+// newTestRouter creates a router on a host listening on a random port
+func newTestRouter(t *testing.T) *Router {
+	h := testutil.NewHost(t)
+	client := utils.NewServiceClient(h)
+	t.Cleanup(client.Close)
+	return NewRouter(h, discovery.NewDiscoveryManager(h), client, 2, 0)
+}
+
+// newProvider creates a host serving the given services from its own
+// registry, and connects the router to it
+func newProvider(t *testing.T, router *Router, serviceNames ...string) (host.Host, *services.Registry) {
+	registry := services.NewRegistry()
+	for _, name := range serviceNames {
+		registry.RegisterService(&services.Service{
+			Name: name,
+			Handler: func(payload []byte) ([]byte, error) {
+				return payload, nil
+			},
+		})
+	}
+
+	h := testutil.NewHost(t)
+	config := protocol.DefaultHandlerConfig()
+	config.Registry = registry
+	protocol.RegisterHandlerWithConfig(h, protocol.ProtocolID, config)
+	protocol.RegisterPersistentHandler(h, config)
+	protocol.RegisterDescribeHandler(h, registry, nil)
+
+	testutil.Connect(t, router.host, h)
+	return h, registry
+}
+
+// TestForwardDetectsLoop tests that a request already routed through this node is rejected
+func TestForwardDetectsLoop(t *testing.T) {
+	router := newTestRouter(t)
+
+	response := router.Forward(context.Background(), &services.ServiceRequest{
+		Service:   "math",
+		RequestID: "loop-request",
+		HopCount:  1,
+		Route:     []string{router.host.ID().String()},
+	})
+
+	if response.Success {
+		t.Fatal("Expected looping request to fail")
+	}
+	if !strings.Contains(response.Error, "routing loop") {
+		t.Errorf("Expected routing loop error, got '%s'", response.Error)
+	}
+}
+
+// TestForwardHopLimit tests that requests past the hop limit are rejected
+func TestForwardHopLimit(t *testing.T) {
+	router := newTestRouter(t)
+
+	response := router.Forward(context.Background(), &services.ServiceRequest{
+		Service:   "math",
+		RequestID: "hop-request",
+		HopCount:  2,
+	})
+
+	if response.Success {
+		t.Fatal("Expected request over the hop limit to fail")
+	}
+	if !strings.Contains(response.Error, "hop limit") {
+		t.Errorf("Expected hop limit error, got '%s'", response.Error)
+	}
+}
+
+// TestForwardWithoutProviders tests the response when no peer offers the service
+func TestForwardWithoutProviders(t *testing.T) {
+	router := newTestRouter(t)
+
+	response := router.Forward(context.Background(), &services.ServiceRequest{
+		Service:   "math",
+		RequestID: "missing-request",
+	})
+
+	if response.Success {
+		t.Fatal("Expected request without providers to fail")
+	}
+	if response.RequestID != "missing-request" {
+		t.Errorf("Expected request ID 'missing-request', got '%s'", response.RequestID)
+	}
+	if response.Code != services.ErrCodeServiceNotFound {
+		t.Errorf("Expected code '%s', got '%s'", services.ErrCodeServiceNotFound, response.Code)
+	}
+}
+
+// TestForwardToProvider tests that a request is forwarded to a connected peer
+// whose services are learned on demand
+func TestForwardToProvider(t *testing.T) {
+	router := newTestRouter(t)
+	provider, _ := newProvider(t, router, "echo")
+
+	response := router.Forward(context.Background(), &services.ServiceRequest{
+		Service:   "echo",
+		Payload:   []byte(`"hello"`),
+		RequestID: "forward-request",
+	})
+
+	if !response.Success {
+		t.Fatalf("Expected forwarded request to succeed, got '%s'", response.Error)
+	}
+	if string(response.Result) != `"hello"` {
+		t.Errorf("Expected result '\"hello\"', got '%s'", response.Result)
+	}
+	if response.ServedBy != provider.ID().String() {
+		t.Errorf("Expected request served by %s, got '%s'", provider.ID(), response.ServedBy)
+	}
+}
+
+// TestForwardMissingServiceCached tests that connected peers are not asked
+// for their services again right after a refresh
+func TestForwardMissingServiceCached(t *testing.T) {
+	router := newTestRouter(t)
+	_, registry := newProvider(t, router)
+
+	request := &services.ServiceRequest{Service: "echo", RequestID: "missing-request"}
+	if response := router.Forward(context.Background(), request); response.Code != services.ErrCodeServiceNotFound {
+		t.Fatalf("Expected code '%s', got '%s'", services.ErrCodeServiceNotFound, response.Code)
+	}
+
+	// The provider gains the service, but the router doesn't ask again yet
+	registry.RegisterService(&services.Service{
+		Name:    "echo",
+		Handler: func(payload []byte) ([]byte, error) { return payload, nil },
+	})
+	if response := router.Forward(context.Background(), request); response.Code != services.ErrCodeServiceNotFound {
+		t.Errorf("Expected cached code '%s', got '%s'", services.ErrCodeServiceNotFound, response.Code)
+	}
+}
+
+// TestForwardFailover tests that a provider answering service_not_found
+// loses the service and the request goes to the next provider
+func TestForwardFailover(t *testing.T) {
+	router := newTestRouter(t)
+	stale, _ := newProvider(t, router)
+	provider, _ := newProvider(t, router, "echo")
+
+	// A successful probe ranks the stale provider first
+	if err := discovery.NewPeerProber(router.discovery, router.client, 0).ProbePeer(context.Background(), stale.ID()); err != nil {
+		t.Fatalf("Failed to probe peer: %v", err)
+	}
+	router.discovery.UpdatePeerServices(stale.ID(), []string{"echo"})
+	router.discovery.UpdatePeerServices(provider.ID(), []string{"echo"})
+	if providers := router.discovery.FindProviders("echo"); len(providers) != 2 || providers[0] != stale.ID() {
+		t.Fatalf("Expected the stale provider first, got %v", providers)
+	}
+
+	response := router.Forward(context.Background(), &services.ServiceRequest{
+		Service:   "echo",
+		Payload:   []byte(`"hello"`),
+		RequestID: "failover-request",
+	})
+
+	if !response.Success {
+		t.Fatalf("Expected request to fail over, got '%s'", response.Error)
+	}
+	if response.ServedBy != provider.ID().String() {
+		t.Errorf("Expected request served by %s, got '%s'", provider.ID(), response.ServedBy)
+	}
+	if remaining := router.discovery.GetPeers()[stale.ID()].Services; len(remaining) != 0 {
+		t.Errorf("Expected stale provider to lose the service, got %v", remaining)
+	}
+}
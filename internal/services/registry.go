@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"sync"
@@ -13,16 +14,26 @@ type Service struct {
 	Version     string            `json:"version"`     // Service version
 	Metadata    map[string]string `json:"metadata"`    // Additional service info
 	Handler     ServiceHandler    `json:"-"`           // Function to execute the service
+
+	// ContextHandler is used instead of Handler when set, allowing the
+	// service to stop work when the request is cancelled
+	ContextHandler ServiceContextHandler `json:"-"`
 }
 
 // ServiceHandler defines the interface for service execution
 type ServiceHandler func(payload []byte) ([]byte, error)
 
+// ServiceContextHandler defines a cancellable service execution function
+type ServiceContextHandler func(ctx context.Context, payload []byte) ([]byte, error)
+
 // ServiceRequest represents an incoming service request
 type ServiceRequest struct {
-	Service   string          `json:"service"`   // Service name to execute
-	Payload   json.RawMessage `json:"payload"`   // Service-specific data
-	RequestID string          `json:"requestId"` // Unique request identifier
+	Service   string            `json:"service"`            // Service name to execute
+	Payload   json.RawMessage   `json:"payload"`            // Service-specific data
+	RequestID string            `json:"requestId"`          // Unique request identifier
+	HopCount  int               `json:"hopCount,omitempty"` // Number of times the request has been forwarded
+	Route     []string          `json:"route,omitempty"`    // Peer IDs of the nodes that forwarded the request
+	Metadata  map[string]string `json:"metadata,omitempty"` // Request context such as trace propagation headers
 }
 
 // ServiceResponse represents a service execution response
@@ -31,12 +42,25 @@ type ServiceResponse struct {
 	Success   bool            `json:"success"`
 	Result    json.RawMessage `json:"result,omitempty"`
 	Error     string          `json:"error,omitempty"`
+	Code      string          `json:"code,omitempty"`     // Machine-readable reason for the error, one of the ErrCode* values
+	ServedBy  string          `json:"servedBy,omitempty"` // Peer ID of the node that executed a forwarded request
+}
+
+// Error codes of service responses
+const (
+	ErrCodeServiceNotFound = "service_not_found" // Neither the node nor the peers it can reach provide the service
+)
+
+// Forwarder routes requests for services that are not registered locally
+type Forwarder interface {
+	Forward(ctx context.Context, request *ServiceRequest) *ServiceResponse
 }
 
 // Registry manages local services for this node
 type Registry struct {
-	services map[string]*Service
-	mutex    sync.RWMutex
+	services  map[string]*Service
+	forwarder Forwarder
+	mutex     sync.RWMutex
 }
 
 // NewRegistry creates a new service registry
@@ -55,7 +79,7 @@ func (r *Registry) RegisterService(service *Service) error {
 		return fmt.Errorf("service name cannot be empty")
 	}
 
-	if service.Handler == nil {
+	if service.Handler == nil && service.ContextHandler == nil {
 		return fmt.Errorf("service handler cannot be nil")
 	}
 
@@ -84,18 +108,39 @@ func (r *Registry) GetAllServices() map[string]*Service {
 	return services
 }
 
+// SetForwarder enables routing of unknown services to remote peers
+func (r *Registry) SetForwarder(forwarder Forwarder) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.forwarder = forwarder
+}
+
 // ExecuteService runs a service with the given payload
 func (r *Registry) ExecuteService(request *ServiceRequest) *ServiceResponse {
+	return r.ExecuteServiceContext(context.Background(), request)
+}
+
+// ExecuteServiceContext runs a service and abandons it when ctx is cancelled
+func (r *Registry) ExecuteServiceContext(ctx context.Context, request *ServiceRequest) *ServiceResponse {
 	service, exists := r.GetService(request.Service)
 	if !exists {
+		r.mutex.RLock()
+		forwarder := r.forwarder
+		r.mutex.RUnlock()
+
+		if forwarder != nil {
+			return forwarder.Forward(ctx, request)
+		}
+
 		return &ServiceResponse{
 			RequestID: request.RequestID,
 			Success:   false,
 			Error:     fmt.Sprintf("service '%s' not found", request.Service),
+			Code:      ErrCodeServiceNotFound,
 		}
 	}
 
-	result, err := service.Handler(request.Payload)
+	result, err := runHandler(ctx, service, request.Payload)
 	if err != nil {
 		return &ServiceResponse{
 			RequestID: request.RequestID,
@@ -111,6 +156,36 @@ func (r *Registry) ExecuteService(request *ServiceRequest) *ServiceResponse {
 	}
 }
 
+// runHandler executes the service handler, returning early if ctx is cancelled
+func runHandler(ctx context.Context, service *Service, payload []byte) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("request cancelled: %v", err)
+	}
+
+	if service.ContextHandler != nil {
+		return service.ContextHandler(ctx, payload)
+	}
+
+	type handlerResult struct {
+		result []byte
+		err    error
+	}
+
+	// Plain handlers can't observe ctx, so stop waiting for them instead
+	done := make(chan handlerResult, 1)
+	go func() {
+		result, err := service.Handler(payload)
+		done <- handlerResult{result, err}
+	}()
+
+	select {
+	case res := <-done:
+		return res.result, res.err
+	case <-ctx.Done():
+		return nil, fmt.Errorf("request cancelled: %v", ctx.Err())
+	}
+}
+
 // ListServices returns a list of service names
 func (r *Registry) ListServices() []string {
 	r.mutex.RLock()
@@ -0,0 +1,52 @@
+// Package testutil provides fixtures shared by the tests of several packages
+package testutil
+
+import (
+	"context"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/realentity/realentity-node/internal/node"
+)
+
+// NewHost creates a host on a random port, closed when the test ends
+func NewHost(tb testing.TB) host.Host {
+	hostConfig := node.DefaultHostConfig()
+	hostConfig.ListenPort = 0
+
+	h, err := node.CreateHostWithConfig(context.Background(), hostConfig)
+	if err != nil {
+		tb.Fatalf("Failed to create host: %v", err)
+	}
+	tb.Cleanup(func() { h.Close() })
+	return h
+}
+
+// Connect connects one host to another over TCP only, to keep tests
+// independent of QUIC support
+func Connect(tb testing.TB, from, to host.Host) {
+	var tcpAddrs []multiaddr.Multiaddr
+	for _, addr := range to.Addrs() {
+		if _, err := addr.ValueForProtocol(multiaddr.P_TCP); err == nil {
+			tcpAddrs = append(tcpAddrs, addr)
+		}
+	}
+
+	if err := from.Connect(context.Background(), peer.AddrInfo{ID: to.ID(), Addrs: tcpAddrs}); err != nil {
+		tb.Fatalf("Failed to connect hosts: %v", err)
+	}
+}
+
+// NewConnectedHosts creates a server and a client connected to it. setup
+// registers the server's handlers before the client connects.
+func NewConnectedHosts(tb testing.TB, setup func(server host.Host)) (host.Host, host.Host) {
+	server := NewHost(tb)
+	client := NewHost(tb)
+	if setup != nil {
+		setup(server)
+	}
+	Connect(tb, client, server)
+	return server, client
+}
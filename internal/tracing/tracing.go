@@ -0,0 +1,165 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/realentity/realentity-node/internal/services"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const tracerName = "github.com/realentity/realentity-node"
+
+// propagator carries trace context in request metadata. Trace context is
+// always propagated so traces pass through untraced nodes.
+var propagator = propagation.TraceContext{}
+
+// Config contains tracing exporter settings
+type Config struct {
+	Enabled     bool
+	Exporter    string  // "stdout" or "file"
+	FilePath    string  // Output file for the file exporter
+	SampleRatio float64 // Fraction of new traces to record (0 or 1 = all)
+}
+
+// ShutdownFunc flushes pending spans and releases exporter resources
+type ShutdownFunc func(ctx context.Context) error
+
+// Setup creates the tracer provider of a node. When tracing is disabled, the
+// provider records nothing but still passes on the trace context of incoming
+// requests. Each node has its own provider, so nodes running in one process
+// don't share exporters or resource attributes.
+func Setup(config Config, nodeID string) (trace.TracerProvider, ShutdownFunc, error) {
+	if !config.Enabled {
+		return noop.NewTracerProvider(), func(context.Context) error { return nil }, nil
+	}
+
+	var writer io.Writer
+	var file *os.File
+	switch config.Exporter {
+	case "", "stdout":
+		writer = os.Stdout
+	case "file":
+		if config.FilePath == "" {
+			return nil, nil, fmt.Errorf("file exporter requires a file path")
+		}
+		f, err := os.OpenFile(config.FilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open trace file: %v", err)
+		}
+		file = f
+		writer = f
+	default:
+		return nil, nil, fmt.Errorf("unknown trace exporter: %s", config.Exporter)
+	}
+
+	exporter, err := stdouttrace.New(stdouttrace.WithWriter(writer))
+	if err != nil {
+		if file != nil {
+			file.Close()
+		}
+		return nil, nil, fmt.Errorf("failed to create trace exporter: %v", err)
+	}
+
+	sampler := sdktrace.AlwaysSample()
+	if config.SampleRatio > 0 && config.SampleRatio < 1 {
+		sampler = sdktrace.TraceIDRatioBased(config.SampleRatio)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sampler)),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", "realentity-node"),
+			attribute.String("realentity.node_id", nodeID),
+		)),
+	)
+
+	log.Printf("Tracing enabled (exporter: %s)\n", config.Exporter)
+
+	return provider, func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if file != nil {
+			file.Close()
+		}
+		return err
+	}, nil
+}
+
+// SetGlobal makes provider and the trace context propagator the process-wide
+// OpenTelemetry defaults. Only programs running a single node should call it.
+func SetGlobal(provider trace.TracerProvider) {
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagator)
+}
+
+// Tracer returns the tracer for node spans of provider, or of the global
+// tracer provider when provider is nil
+func Tracer(provider trace.TracerProvider) trace.Tracer {
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return provider.Tracer(tracerName)
+}
+
+// Inject stores the trace context of ctx in the request metadata
+func Inject(ctx context.Context, request *services.ServiceRequest) {
+	// Copy so forwarded requests don't share metadata with the original
+	metadata := make(map[string]string, len(request.Metadata)+1)
+	for k, v := range request.Metadata {
+		metadata[k] = v
+	}
+	propagator.Inject(ctx, propagation.MapCarrier(metadata))
+	request.Metadata = metadata
+}
+
+// Extract returns ctx carrying the trace context found in the request metadata
+func Extract(ctx context.Context, request *services.ServiceRequest) context.Context {
+	if len(request.Metadata) == 0 {
+		return ctx
+	}
+	return propagator.Extract(ctx, propagation.MapCarrier(request.Metadata))
+}
+
+// TraceID returns the trace ID of the span in ctx, or an empty string
+func TraceID(ctx context.Context) string {
+	spanCtx := trace.SpanContextFromContext(ctx)
+	if !spanCtx.HasTraceID() {
+		return ""
+	}
+	return spanCtx.TraceID().String()
+}
+
+// RequestAttributes returns span attributes describing a service request
+func RequestAttributes(request *services.ServiceRequest) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("realentity.service", request.Service),
+		attribute.String("realentity.request_id", request.RequestID),
+		attribute.Int("realentity.hop_count", request.HopCount),
+	}
+}
+
+// EndSpan records the outcome of a service response and ends the span
+func EndSpan(span trace.Span, response *services.ServiceResponse, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else if response != nil && !response.Success {
+		span.SetStatus(codes.Error, response.Error)
+	}
+	if response != nil && response.ServedBy != "" {
+		span.SetAttributes(attribute.String("realentity.served_by", response.ServedBy))
+	}
+	span.End()
+}
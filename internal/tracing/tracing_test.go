@@ -0,0 +1,98 @@
+package tracing
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/realentity/realentity-node/internal/services"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// TestInjectExtract tests that the trace context survives a round trip through request metadata
+func TestInjectExtract(t *testing.T) {
+	provider := sdktrace.NewTracerProvider()
+	defer provider.Shutdown(context.Background())
+
+	ctx, span := provider.Tracer("test").Start(context.Background(), "test")
+	defer span.End()
+
+	original := map[string]string{"caller": "test"}
+	request := &services.ServiceRequest{Service: "echo", Metadata: original}
+	Inject(ctx, request)
+
+	if _, exists := original["traceparent"]; exists {
+		t.Error("Inject should not modify the original metadata map")
+	}
+	if request.Metadata["caller"] != "test" {
+		t.Error("Inject should keep existing metadata")
+	}
+
+	extracted := Extract(context.Background(), request)
+	if TraceID(extracted) != TraceID(ctx) {
+		t.Errorf("Expected trace ID %s, got %s", TraceID(ctx), TraceID(extracted))
+	}
+}
+
+// TestDisabledProviderPropagates tests that a node without tracing passes on
+// the trace context of the requests it handles
+func TestDisabledProviderPropagates(t *testing.T) {
+	disabled, shutdown, err := Setup(Config{}, "test-node")
+	if err != nil {
+		t.Fatalf("Failed to set up tracing: %v", err)
+	}
+	defer shutdown(context.Background())
+
+	provider := sdktrace.NewTracerProvider()
+	defer provider.Shutdown(context.Background())
+
+	ctx, span := provider.Tracer("test").Start(context.Background(), "caller")
+	defer span.End()
+	incoming := &services.ServiceRequest{Service: "echo"}
+	Inject(ctx, incoming)
+
+	handlerCtx, handlerSpan := Tracer(disabled).Start(Extract(context.Background(), incoming), "handler")
+	defer handlerSpan.End()
+	outgoing := &services.ServiceRequest{Service: "echo"}
+	Inject(handlerCtx, outgoing)
+
+	if got := TraceID(Extract(context.Background(), outgoing)); got != TraceID(ctx) {
+		t.Errorf("Expected trace ID %s, got %s", TraceID(ctx), got)
+	}
+}
+
+// TestSetupPerNode tests that each node exports its spans through its own
+// provider, which keeps working after another node shuts its provider down
+func TestSetupPerNode(t *testing.T) {
+	dir := t.TempDir()
+	first, shutdownFirst, err := Setup(Config{Enabled: true, Exporter: "file", FilePath: filepath.Join(dir, "first.json")}, "first-node")
+	if err != nil {
+		t.Fatalf("Failed to set up tracing: %v", err)
+	}
+	second, shutdownSecond, err := Setup(Config{Enabled: true, Exporter: "file", FilePath: filepath.Join(dir, "second.json")}, "second-node")
+	if err != nil {
+		t.Fatalf("Failed to set up tracing: %v", err)
+	}
+
+	_, span := Tracer(first).Start(context.Background(), "first")
+	span.End()
+	if err := shutdownFirst(context.Background()); err != nil {
+		t.Fatalf("Failed to shut down tracing: %v", err)
+	}
+
+	_, span = Tracer(second).Start(context.Background(), "second")
+	span.End()
+	if err := shutdownSecond(context.Background()); err != nil {
+		t.Fatalf("Failed to shut down tracing: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "second.json"))
+	if err != nil {
+		t.Fatalf("Failed to read trace file: %v", err)
+	}
+	if !strings.Contains(string(data), `"second-node"`) || strings.Contains(string(data), `"first-node"`) {
+		t.Errorf("Expected only spans of the second node, got %s", data)
+	}
+}
@@ -0,0 +1,143 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	peer "github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Circuit breaker states
+const (
+	BreakerClosed   = "closed"    // Calls go through
+	BreakerOpen     = "open"      // Calls fail immediately until the cooldown has passed
+	BreakerHalfOpen = "half-open" // A single trial call decides whether to close again
+)
+
+// ErrCircuitOpen is returned for calls short-circuited by an open breaker
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// BreakerState describes the circuit breaker for one service on a peer
+type BreakerState struct {
+	Service             string
+	State               string
+	ConsecutiveFailures int
+	OpenedAt            time.Time
+	RetryAt             time.Time // When an open breaker lets a trial call through
+}
+
+// breakerKey identifies the breaker guarding calls to a service on a peer
+type breakerKey struct {
+	peerID  peer.ID
+	service string
+}
+
+// circuitBreaker tracks consecutive failures of calls to a service on a peer.
+// Breakers only exist while calls are failing; a success removes them.
+type circuitBreaker struct {
+	state    string
+	failures int
+	openedAt time.Time
+	trial    bool // A half-open trial call is in flight
+}
+
+// allowCall checks the breaker for a call, letting one trial call through
+// once an open breaker's cooldown has passed
+func (c *ServiceClient) allowCall(key breakerKey) error {
+	if c.config.DisableBreakers {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b := c.breakers[key]
+	if b == nil {
+		return nil
+	}
+
+	switch b.state {
+	case BreakerOpen:
+		if remaining := c.config.BreakerCooldown - time.Since(b.openedAt); remaining > 0 {
+			return fmt.Errorf("%w: %s on peer %s, retry in %v", ErrCircuitOpen, key.service, FormatPeerID(key.peerID), remaining.Round(time.Millisecond))
+		}
+		b.state = BreakerHalfOpen
+		b.trial = true
+	case BreakerHalfOpen:
+		if b.trial {
+			return fmt.Errorf("%w: %s on peer %s, trial call in progress", ErrCircuitOpen, key.service, FormatPeerID(key.peerID))
+		}
+		b.trial = true
+	}
+	return nil
+}
+
+// recordCall updates the breaker with the outcome of a call. Only transport
+// failures and timeouts count; calls cancelled by the caller say nothing
+// about the peer.
+func (c *ServiceClient) recordCall(ctx context.Context, key breakerKey, err error) {
+	if c.config.DisableBreakers {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b := c.breakers[key]
+	switch {
+	case err == nil:
+		if b != nil && b.state != BreakerClosed {
+			log.Printf("Circuit breaker for %s on peer %s closed\n", key.service, FormatPeerID(key.peerID))
+		}
+		delete(c.breakers, key)
+	case errors.Is(ctx.Err(), context.Canceled):
+		if b != nil {
+			b.trial = false
+		}
+	default:
+		if b == nil {
+			b = &circuitBreaker{state: BreakerClosed}
+			c.breakers[key] = b
+		}
+		b.failures++
+		b.trial = false
+		if b.state == BreakerHalfOpen || (b.state == BreakerClosed && b.failures >= c.config.BreakerThreshold) {
+			b.state = BreakerOpen
+			b.openedAt = time.Now()
+			log.Printf("Circuit breaker for %s on peer %s opened after %d consecutive failures\n",
+				key.service, FormatPeerID(key.peerID), b.failures)
+		}
+	}
+}
+
+// BreakerStates returns the circuit breakers of calls to a peer that have
+// recently failed, sorted by service name
+func (c *ServiceClient) BreakerStates(peerID peer.ID) []BreakerState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var states []BreakerState
+	for key, b := range c.breakers {
+		if key.peerID != peerID {
+			continue
+		}
+
+		state := BreakerState{
+			Service:             key.service,
+			State:               b.state,
+			ConsecutiveFailures: b.failures,
+			OpenedAt:            b.openedAt,
+		}
+		if b.state == BreakerOpen {
+			state.RetryAt = b.openedAt.Add(c.config.BreakerCooldown)
+		}
+		states = append(states, state)
+	}
+
+	sort.Slice(states, func(i, j int) bool { return states[i].Service < states[j].Service })
+	return states
+}
@@ -0,0 +1,188 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	peer "github.com/libp2p/go-libp2p/core/peer"
+	"github.com/realentity/realentity-node/internal/services"
+)
+
+// Completion modes for a broadcast
+const (
+	CompleteAll    = "all"    // Wait for every peer to answer
+	CompleteQuorum = "quorum" // Stop once a quorum of peers succeeded (majority by default)
+	CompleteFirstK = "first"  // Stop once K peers succeeded (1 by default)
+)
+
+// BroadcastOptions controls when a broadcast is complete
+type BroadcastOptions struct {
+	Mode    string        // One of the Complete* modes (empty = all)
+	Count   int           // Successes needed for quorum and first-K modes
+	Timeout time.Duration // Time allowed for the whole broadcast (0 = until ctx is done)
+}
+
+// PeerResult is the outcome of a broadcast request to one peer
+type PeerResult struct {
+	PeerID   string                    `json:"peer_id"`
+	Response *services.ServiceResponse `json:"response,omitempty"`
+	Error    string                    `json:"error,omitempty"`
+	Duration time.Duration             `json:"duration_ns"`
+}
+
+// BroadcastResult collects the per-peer results of a broadcast
+type BroadcastResult struct {
+	Service   string       `json:"service"`
+	Mode      string       `json:"mode"`
+	Targeted  int          `json:"targeted"`
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+	Required  int          `json:"required"` // Successes needed for the broadcast to complete
+	Complete  bool         `json:"complete"`
+	Results   []PeerResult `json:"results"`
+}
+
+// requiredSuccesses returns how many successes complete a broadcast to n peers
+func (o *BroadcastOptions) requiredSuccesses(n int) (string, int, error) {
+	mode := o.Mode
+	if mode == "" {
+		mode = CompleteAll
+	}
+
+	required := o.Count
+	switch mode {
+	case CompleteAll:
+		required = n
+	case CompleteQuorum:
+		if required <= 0 {
+			required = n/2 + 1
+		}
+	case CompleteFirstK:
+		if required <= 0 {
+			required = 1
+		}
+	default:
+		return "", 0, fmt.Errorf("unknown completion mode: %s", mode)
+	}
+
+	if required > n {
+		required = n
+	}
+	return mode, required, nil
+}
+
+// Broadcast sends the same request to all given peers concurrently and
+// collects their answers. Requests still running when the completion mode is
+// satisfied are cancelled and reported as such.
+func (c *ServiceClient) Broadcast(ctx context.Context, peers []peer.ID, serviceName string, payload interface{}, options *BroadcastOptions) (*BroadcastResult, error) {
+	if options == nil {
+		options = &BroadcastOptions{}
+	}
+	if len(peers) == 0 {
+		return nil, fmt.Errorf("no peers to broadcast to")
+	}
+
+	mode, required, err := options.requiredSuccesses(len(peers))
+	if err != nil {
+		return nil, err
+	}
+
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %v", err)
+	}
+
+	if options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, options.Timeout)
+		defer cancel()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type indexedResult struct {
+		index     int
+		result    PeerResult
+		cancelled bool // Failed because the broadcast stopped early
+	}
+	results := make(chan indexedResult, len(peers))
+
+	var wg sync.WaitGroup
+	for i, peerID := range peers {
+		wg.Add(1)
+		go func(index int, id peer.ID) {
+			defer wg.Done()
+
+			request := &services.ServiceRequest{
+				Service:   serviceName,
+				Payload:   json.RawMessage(payloadBytes),
+				RequestID: uuid.New().String(),
+			}
+
+			started := time.Now()
+			response, err := c.SendRequest(ctx, id, request)
+			result := PeerResult{PeerID: id.String(), Response: response, Duration: time.Since(started)}
+			if err != nil {
+				result.Error = err.Error()
+			} else if !response.Success {
+				result.Error = response.Error
+			}
+			results <- indexedResult{index: index, result: result, cancelled: err != nil && errors.Is(ctx.Err(), context.Canceled)}
+		}(i, peerID)
+	}
+
+	broadcast := &BroadcastResult{
+		Service:  serviceName,
+		Mode:     mode,
+		Targeted: len(peers),
+		Required: required,
+		Results:  make([]PeerResult, len(peers)),
+	}
+	answered := make([]bool, len(peers))
+	record := func(r indexedResult) {
+		broadcast.Results[r.index] = r.result
+		answered[r.index] = true
+		if r.result.Error == "" {
+			broadcast.Succeeded++
+		} else {
+			broadcast.Failed++
+		}
+	}
+
+	received := 0
+	for ; received < len(peers); received++ {
+		record(<-results)
+
+		// Stop early once the outcome is decided either way
+		if mode != CompleteAll && (broadcast.Succeeded >= required || broadcast.Failed > len(peers)-required) {
+			received++
+			break
+		}
+	}
+
+	// Cancel the requests still running and wait for them to finish. Answers
+	// that arrived before the cancellation are kept.
+	cancel()
+	wg.Wait()
+	for ; received < len(peers); received++ {
+		if r := <-results; !r.cancelled {
+			record(r)
+		}
+	}
+	for i, peerID := range peers {
+		if !answered[i] {
+			broadcast.Results[i] = PeerResult{
+				PeerID: peerID.String(),
+				Error:  "cancelled after broadcast completed",
+			}
+		}
+	}
+	broadcast.Complete = broadcast.Succeeded >= required
+
+	return broadcast, nil
+}
@@ -1,28 +1,54 @@
 package utils
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	host "github.com/libp2p/go-libp2p/core/host"
+	network "github.com/libp2p/go-libp2p/core/network"
 	peer "github.com/libp2p/go-libp2p/core/peer"
 	protocol "github.com/libp2p/go-libp2p/core/protocol"
+	rprotocol "github.com/realentity/realentity-node/internal/protocol"
 	"github.com/realentity/realentity-node/internal/services"
+	"github.com/realentity/realentity-node/internal/services/impl"
+	"github.com/realentity/realentity-node/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// ServiceClient handles communication with remote nodes
+// ServiceClient handles communication with remote nodes, reusing request
+// streams per peer where the peer supports it and short-circuiting calls to
+// services that keep failing on a peer
 type ServiceClient struct {
-	host host.Host
+	host      host.Host
+	config    *ClientConfig
+	pools     map[peer.ID]*streamPool
+	breakers  map[breakerKey]*circuitBreaker
+	providers ProviderSource
+	mu        sync.Mutex
 }
 
 // NewServiceClient creates a new service client
 func NewServiceClient(h host.Host) *ServiceClient {
-	return &ServiceClient{host: h}
+	return NewServiceClientWithConfig(h, DefaultClientConfig())
+}
+
+// NewServiceClientWithConfig creates a new service client with custom stream
+// reuse and circuit breaker settings
+func NewServiceClientWithConfig(h host.Host, config *ClientConfig) *ServiceClient {
+	return &ServiceClient{
+		host:     h,
+		config:   config.withDefaults(),
+		pools:    make(map[peer.ID]*streamPool),
+		breakers: make(map[breakerKey]*circuitBreaker),
+	}
 }
 
 // CallService calls a service on a remote peer
@@ -40,35 +66,181 @@ func (c *ServiceClient) CallService(ctx context.Context, peerID peer.ID, service
 		RequestID: uuid.New().String(),
 	}
 
-	// Open stream to peer
-	stream, err := c.host.NewStream(ctx, peerID, protocol.ID("/realentity/1.0.0"))
+	return c.SendRequest(ctx, peerID, &request)
+}
+
+// SendRequest sends a prepared service request to a remote peer
+func (c *ServiceClient) SendRequest(ctx context.Context, peerID peer.ID, request *services.ServiceRequest) (*services.ServiceResponse, error) {
+	response, _, err := c.SendRequestWithTimings(ctx, peerID, request)
+	return response, err
+}
+
+// SendRequestWithTimings sends a prepared service request and reports where
+// the time of the call was spent
+func (c *ServiceClient) SendRequestWithTimings(ctx context.Context, peerID peer.ID, request *services.ServiceRequest) (*services.ServiceResponse, *CallTimings, error) {
+	ctx, span := tracing.Tracer(c.config.TracerProvider).Start(ctx, "client.send "+request.Service,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(tracing.RequestAttributes(request)...),
+		trace.WithAttributes(attribute.String("realentity.remote_peer", peerID.String())))
+
+	// Carry the trace context to the remote peer
+	outgoing := *request
+	tracing.Inject(ctx, &outgoing)
+
+	start := time.Now()
+	timings := &CallTimings{}
+	key := breakerKey{peerID: peerID, service: request.Service}
+	err := c.allowCall(key)
+	var response *services.ServiceResponse
+	if err == nil {
+		response, err = c.sendRequest(ctx, peerID, &outgoing, timings, false)
+		if errors.Is(err, errStaleStream) {
+			// The reused stream was closed remotely before the request arrived
+			response, err = c.sendRequest(ctx, peerID, &outgoing, timings, true)
+		}
+		c.recordCall(ctx, key, err)
+	}
+	timings.Total = time.Since(start)
+
+	span.SetAttributes(attribute.Bool("realentity.stream_reused", timings.Reused))
+	tracing.EndSpan(span, response, err)
+	return response, timings, err
+}
+
+// errStaleStream reports that a reused stream failed before any response was read
+var errStaleStream = errors.New("reused stream is no longer usable")
+
+// sendRequest performs a single request/response exchange on a pooled or new stream
+func (c *ServiceClient) sendRequest(ctx context.Context, peerID peer.ID, request *services.ServiceRequest, timings *CallTimings, fresh bool) (*services.ServiceResponse, error) {
+	started := time.Now()
+	rs, err := c.acquireStream(ctx, peerID, fresh)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open stream: %v", err)
+		return nil, err
 	}
-	defer stream.Close()
+	timings.Acquire += time.Since(started)
+	timings.Reused = rs.reused
+
+	ok := false
+	defer func() { c.releaseStream(rs, ok) }()
 
-	rw := bufio.NewReadWriter(bufio.NewReader(stream), bufio.NewWriter(stream))
+	if deadline, hasDeadline := ctx.Deadline(); hasDeadline {
+		rs.stream.SetWriteDeadline(deadline)
+	}
 
 	// Send request
-	if err := json.NewEncoder(rw).Encode(request); err != nil {
-		return nil, fmt.Errorf("failed to send request: %v", err)
+	started = time.Now()
+	if err := json.NewEncoder(rs.writer).Encode(request); err != nil {
+		return nil, c.sendError(rs, "failed to send request", err)
+	}
+	if err := rs.writer.Flush(); err != nil {
+		return nil, c.sendError(rs, "failed to send request", err)
 	}
-	rw.Flush()
+	timings.Write = time.Since(started)
+
+	// Unblock the read below if the caller gives up first. The deadline must
+	// be set before the stream is released, or it would hit the next caller.
+	fired := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		rs.stream.SetReadDeadline(time.Now())
+		close(fired)
+	})
+	defer func() {
+		if !stop() {
+			<-fired
+		}
+	}()
 
 	// Read response
+	started = time.Now()
 	var response services.ServiceResponse
-	if err := json.NewDecoder(rw).Decode(&response); err != nil {
-		return nil, fmt.Errorf("failed to read response: %v", err)
+	err = rs.decoder.Decode(&response)
+	timings.Wait = time.Since(started)
+	if err != nil {
+		if ctx.Err() != nil {
+			// Tell the remote handler to stop working on the request
+			cancelRemote(rs.stream, request.RequestID)
+			return nil, fmt.Errorf("request cancelled: %v", ctx.Err())
+		}
+		return nil, c.sendError(rs, "failed to read response", err)
 	}
 
+	ok = true
 	return &response, nil
 }
 
+// sendError wraps a stream failure, marking failures of reused streams as
+// stale so the request is retried once on a new stream
+func (c *ServiceClient) sendError(rs *requestStream, message string, err error) error {
+	if rs.reused && (errors.Is(err, io.EOF) || errors.Is(err, network.ErrReset)) {
+		return fmt.Errorf("%s: %w", message, errStaleStream)
+	}
+	return fmt.Errorf("%s: %v", message, err)
+}
+
+// cancelRemote sends a cancel frame for the request
+func cancelRemote(stream network.Stream, requestID string) {
+	stream.SetWriteDeadline(time.Now().Add(time.Second))
+	frame := rprotocol.ControlFrame{
+		Type:      rprotocol.FrameTypeCancel,
+		RequestID: requestID,
+	}
+	if err := json.NewEncoder(stream).Encode(frame); err != nil {
+		log.Printf("Failed to send cancel for request %s: %v\n", requestID, err)
+	}
+}
+
+// ListRemoteServices asks a remote peer which services it provides
+func (c *ServiceClient) ListRemoteServices(ctx context.Context, peerID peer.ID) ([]string, error) {
+	stream, err := c.host.NewStream(ctx, peerID, protocol.ID(rprotocol.ServicesProtocolID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stream: %v", err)
+	}
+	defer stream.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		stream.SetReadDeadline(deadline)
+	}
+
+	var serviceNames []string
+	if err := json.NewDecoder(stream).Decode(&serviceNames); err != nil {
+		return nil, fmt.Errorf("failed to read service list: %v", err)
+	}
+
+	return serviceNames, nil
+}
+
+// DescribeRemotePeer asks a remote peer for its services and labels. Peers
+// that don't support the describe protocol are asked for their services only.
+func (c *ServiceClient) DescribeRemotePeer(ctx context.Context, peerID peer.ID) (*rprotocol.PeerDescription, error) {
+	stream, err := c.host.NewStream(ctx, peerID,
+		protocol.ID(rprotocol.DescribeProtocolID), protocol.ID(rprotocol.ServicesProtocolID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stream: %v", err)
+	}
+	defer stream.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		stream.SetReadDeadline(deadline)
+	}
+
+	var description rprotocol.PeerDescription
+	if stream.Protocol() == protocol.ID(rprotocol.DescribeProtocolID) {
+		err = json.NewDecoder(stream).Decode(&description)
+	} else {
+		err = json.NewDecoder(stream).Decode(&description.Services)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read peer description: %v", err)
+	}
+
+	return &description, nil
+}
+
 // TestEcho tests the echo service on a remote peer
 func (c *ServiceClient) TestEcho(ctx context.Context, peerID peer.ID, message string) error {
 	log.Printf("Testing echo service on peer %s with message: %s\n", peerID.String(), message)
 
-	echoReq := services.EchoRequest{Message: message}
+	echoReq := impl.EchoRequest{Message: message}
 
 	response, err := c.CallService(ctx, peerID, "echo", echoReq)
 	if err != nil {
@@ -79,7 +251,7 @@ func (c *ServiceClient) TestEcho(ctx context.Context, peerID peer.ID, message st
 		return fmt.Errorf("echo service returned error: %s", response.Error)
 	}
 
-	var echoResp services.EchoResponse
+	var echoResp impl.EchoResponse
 	if err := json.Unmarshal(response.Result, &echoResp); err != nil {
 		return fmt.Errorf("failed to unmarshal echo response: %v", err)
 	}
@@ -93,7 +265,7 @@ func (c *ServiceClient) TestEcho(ctx context.Context, peerID peer.ID, message st
 func (c *ServiceClient) TestTextProcess(ctx context.Context, peerID peer.ID, text, operation string) error {
 	log.Printf("Testing text.process service on peer %s: %s -> %s\n", peerID.String(), operation, text)
 
-	textReq := services.TextProcessRequest{
+	textReq := impl.TextProcessRequest{
 		Text:      text,
 		Operation: operation,
 	}
@@ -107,7 +279,7 @@ func (c *ServiceClient) TestTextProcess(ctx context.Context, peerID peer.ID, tex
 		return fmt.Errorf("text service returned error: %s", response.Error)
 	}
 
-	var textResp services.TextProcessResponse
+	var textResp impl.TextProcessResponse
 	if err := json.Unmarshal(response.Result, &textResp); err != nil {
 		return fmt.Errorf("failed to unmarshal text response: %v", err)
 	}
@@ -117,24 +289,6 @@ func (c *ServiceClient) TestTextProcess(ctx context.Context, peerID peer.ID, tex
 	return nil
 }
 
-// AutoTestServices automatically tests services when a new peer is discovered
-func (c *ServiceClient) AutoTestServices(peerID peer.ID) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	log.Printf("Auto-testing services on newly discovered peer: %s\n", peerID.String())
-
-	// Test echo service
-	if err := c.TestEcho(ctx, peerID, "Hello from "+c.host.ID().String()); err != nil {
-		log.Printf("Echo test failed: %v\n", err)
-	}
-
-	// Test text processing
-	if err := c.TestTextProcess(ctx, peerID, "Hello World", "uppercase"); err != nil {
-		log.Printf("Text process test failed: %v\n", err)
-	}
-}
-
 // FormatPeerID returns a shortened version of peer ID for logging
 func FormatPeerID(peerID peer.ID) string {
 	str := peerID.String()
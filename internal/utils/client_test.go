@@ -0,0 +1,286 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/test"
+	"github.com/realentity/realentity-node/internal/protocol"
+	"github.com/realentity/realentity-node/internal/services"
+	"github.com/realentity/realentity-node/internal/testutil"
+)
+
+// newConnectedHosts creates a server answering echo requests and a client connected to it
+func newConnectedHosts(tb testing.TB) (host.Host, host.Host) {
+	original := services.GlobalRegistry
+	services.GlobalRegistry = services.NewRegistry()
+	tb.Cleanup(func() { services.GlobalRegistry = original })
+
+	services.GlobalRegistry.RegisterService(&services.Service{
+		Name: "echo",
+		Handler: func(payload []byte) ([]byte, error) {
+			return payload, nil
+		},
+	})
+
+	return testutil.NewConnectedHosts(tb, func(server host.Host) {
+		protocol.RegisterHandler(server, protocol.ProtocolID)
+		protocol.RegisterPersistentHandler(server, protocol.DefaultHandlerConfig())
+	})
+}
+
+// TestStreamReuse tests that sequential calls to a peer share one stream
+func TestStreamReuse(t *testing.T) {
+	server, clientHost := newConnectedHosts(t)
+	client := NewServiceClient(clientHost)
+	defer client.Close()
+
+	for i := 0; i < 3; i++ {
+		request := &services.ServiceRequest{Service: "echo", Payload: []byte(`"hello"`), RequestID: "reuse-test"}
+		response, timings, err := client.SendRequestWithTimings(context.Background(), server.ID(), request)
+		if err != nil {
+			t.Fatalf("Call %d failed: %v", i, err)
+		}
+		if !response.Success || string(response.Result) != `"hello"` {
+			t.Fatalf("Call %d returned unexpected response: %+v", i, response)
+		}
+		if timings.Reused != (i > 0) {
+			t.Errorf("Call %d: expected reused=%v, got %v", i, i > 0, timings.Reused)
+		}
+	}
+}
+
+// TestStaleStreamRetried tests that a call succeeds when its idle stream was closed remotely
+func TestStaleStreamRetried(t *testing.T) {
+	server, clientHost := newConnectedHosts(t)
+	client := NewServiceClient(clientHost)
+	defer client.Close()
+
+	request := &services.ServiceRequest{Service: "echo", Payload: []byte(`"hello"`), RequestID: "stale-test"}
+	if _, err := client.SendRequest(context.Background(), server.ID(), request); err != nil {
+		t.Fatalf("First call failed: %v", err)
+	}
+
+	// Close the stream on the server side as an idle timeout would
+	for _, conn := range server.Network().ConnsToPeer(clientHost.ID()) {
+		for _, stream := range conn.GetStreams() {
+			if stream.Protocol() == protocol.PersistentProtocolID {
+				stream.Reset()
+			}
+		}
+	}
+
+	response, err := client.SendRequest(context.Background(), server.ID(), request)
+	if err != nil {
+		t.Fatalf("Call on stale stream failed: %v", err)
+	}
+	if !response.Success {
+		t.Fatalf("Call on stale stream returned error: %s", response.Error)
+	}
+}
+
+// staticProviders is a ProviderSource returning a fixed list of peers
+type staticProviders []peer.ID
+
+func (s staticProviders) FindProviders(service string) []peer.ID {
+	return s
+}
+
+// TestCallAnyFailover tests that CallAny moves on when a provider is unreachable
+func TestCallAnyFailover(t *testing.T) {
+	server, clientHost := newConnectedHosts(t)
+	client := NewServiceClient(clientHost)
+	defer client.Close()
+
+	unreachable, err := test.RandPeerID()
+	if err != nil {
+		t.Fatalf("Failed to create peer ID: %v", err)
+	}
+	client.SetProviderSource(staticProviders{unreachable, server.ID()})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	response, err := client.CallAny(ctx, "echo", "hello")
+	if err != nil {
+		t.Fatalf("CallAny failed: %v", err)
+	}
+	if !response.Success || response.ServedBy != server.ID().String() {
+		t.Fatalf("Expected success from %s, got %+v", server.ID(), response)
+	}
+}
+
+// TestIsRetryable tests that only transport failures and missing services are retried
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		response *services.ServiceResponse
+		err      error
+		want     bool
+	}{
+		{nil, errors.New("stream reset"), true},
+		{&services.ServiceResponse{Error: "service 'echo' not found", Code: services.ErrCodeServiceNotFound}, nil, true},
+		{&services.ServiceResponse{Error: "file not found"}, nil, false},
+		{&services.ServiceResponse{Error: "failed to forward request for service 'echo': service 'echo' not found"}, nil, false},
+		{&services.ServiceResponse{Success: true}, nil, false},
+	}
+	for _, tt := range tests {
+		if got := isRetryable(tt.response, tt.err); got != tt.want {
+			t.Errorf("isRetryable(%+v, %v) = %v, expected %v", tt.response, tt.err, got, tt.want)
+		}
+	}
+}
+
+// TestCallAnyHedging tests that a hedged attempt answers when the first one is slow
+func TestCallAnyHedging(t *testing.T) {
+	server, clientHost := newConnectedHosts(t)
+	client := NewServiceClient(clientHost)
+	defer client.Close()
+
+	var calls int32
+	services.GlobalRegistry.RegisterService(&services.Service{
+		Name: "sometimes-slow",
+		ContextHandler: func(ctx context.Context, payload []byte) ([]byte, error) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				select {
+				case <-ctx.Done():
+				case <-time.After(5 * time.Second):
+				}
+			}
+			return payload, nil
+		},
+	})
+
+	// Listing the server twice gives the hedged attempt a second provider
+	client.SetProviderSource(staticProviders{server.ID(), server.ID()})
+
+	started := time.Now()
+	response, err := client.CallAnyWithOptions(context.Background(), "sometimes-slow", "hello",
+		&CallOptions{HedgeDelay: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("CallAny failed: %v", err)
+	}
+	if !response.Success {
+		t.Fatalf("Expected success, got %+v", response)
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Errorf("Hedged call took %v", elapsed)
+	}
+}
+
+// TestBroadcastCompletionModes tests that broadcasts complete according to their mode
+func TestBroadcastCompletionModes(t *testing.T) {
+	server, clientHost := newConnectedHosts(t)
+	client := NewServiceClient(clientHost)
+	defer client.Close()
+
+	unreachable, err := test.RandPeerID()
+	if err != nil {
+		t.Fatalf("Failed to create peer ID: %v", err)
+	}
+	peers := []peer.ID{server.ID(), unreachable}
+
+	tests := []struct {
+		mode     string
+		complete bool
+	}{
+		{CompleteFirstK, true},
+		{CompleteQuorum, false}, // Majority of two peers needs both
+		{CompleteAll, false},
+	}
+
+	for _, tt := range tests {
+		result, err := client.Broadcast(context.Background(), peers, "echo", "hello",
+			&BroadcastOptions{Mode: tt.mode, Timeout: 5 * time.Second})
+		if err != nil {
+			t.Fatalf("Broadcast in mode %s failed: %v", tt.mode, err)
+		}
+		if result.Complete != tt.complete {
+			t.Errorf("Mode %s: expected complete=%v, got %+v", tt.mode, tt.complete, result)
+		}
+		if len(result.Results) != len(peers) || result.Results[0].PeerID != server.ID().String() {
+			t.Errorf("Mode %s: expected a result per peer in order, got %+v", tt.mode, result.Results)
+		}
+	}
+}
+
+// TestCircuitBreaker tests that failing calls open the breaker and a
+// successful trial call closes it again
+func TestCircuitBreaker(t *testing.T) {
+	server, clientHost := newConnectedHosts(t)
+	client := NewServiceClientWithConfig(clientHost, &ClientConfig{
+		BreakerThreshold: 2,
+		BreakerCooldown:  100 * time.Millisecond,
+	})
+	defer client.Close()
+
+	unreachable, err := test.RandPeerID()
+	if err != nil {
+		t.Fatalf("Failed to create peer ID: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.CallService(context.Background(), unreachable, "echo", "hello"); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("Call %d: expected a transport error, got %v", i, err)
+		}
+	}
+	if _, err := client.CallService(context.Background(), unreachable, "echo", "hello"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Expected call to be short-circuited, got %v", err)
+	}
+	states := client.BreakerStates(unreachable)
+	if len(states) != 1 || states[0].State != BreakerOpen || states[0].ConsecutiveFailures != 2 {
+		t.Fatalf("Expected one open breaker, got %+v", states)
+	}
+
+	// After the cooldown a failing trial call opens the breaker again
+	time.Sleep(150 * time.Millisecond)
+	if _, err := client.CallService(context.Background(), unreachable, "echo", "hello"); err == nil || errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Expected trial call to fail on the transport, got %v", err)
+	}
+	if states := client.BreakerStates(unreachable); len(states) != 1 || states[0].State != BreakerOpen {
+		t.Fatalf("Expected breaker to reopen, got %+v", states)
+	}
+
+	// A successful trial call closes the breaker
+	client.breakers[breakerKey{peerID: server.ID(), service: "echo"}] = &circuitBreaker{
+		state:    BreakerOpen,
+		failures: 2,
+		openedAt: time.Now().Add(-time.Second),
+	}
+	response, err := client.CallService(context.Background(), server.ID(), "echo", "hello")
+	if err != nil || !response.Success {
+		t.Fatalf("Expected trial call to succeed, got %v", err)
+	}
+	if states := client.BreakerStates(server.ID()); len(states) != 0 {
+		t.Errorf("Expected breaker to close, got %+v", states)
+	}
+}
+
+func benchmarkCalls(b *testing.B, config *ClientConfig) {
+	server, clientHost := newConnectedHosts(b)
+	client := NewServiceClientWithConfig(clientHost, config)
+	defer client.Close()
+
+	request := &services.ServiceRequest{Service: "echo", Payload: []byte(`"hello"`), RequestID: "benchmark"}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := client.SendRequest(context.Background(), server.ID(), request); err != nil {
+			b.Fatalf("Call failed: %v", err)
+		}
+	}
+}
+
+// BenchmarkCallPooled measures calls that reuse a pooled stream
+func BenchmarkCallPooled(b *testing.B) {
+	benchmarkCalls(b, DefaultClientConfig())
+}
+
+// BenchmarkCallNewStream measures calls that open a new stream each time
+func BenchmarkCallNewStream(b *testing.B) {
+	benchmarkCalls(b, &ClientConfig{DisablePooling: true})
+}
@@ -82,27 +82,6 @@ func (du *DiscoveryUtils) ListConnectedPeers() {
 	}
 }
 
-// TestAllConnectedPeers tests services on all connected peers
-func (du *DiscoveryUtils) TestAllConnectedPeers() {
-	peers := du.host.Network().Peers()
-
-	if len(peers) == 0 {
-		log.Println("No connected peers to test")
-		return
-	}
-
-	log.Printf("Testing services on %d connected peers...\n", len(peers))
-
-	client := NewServiceClient(du.host)
-
-	for _, peerID := range peers {
-		go func(id peer.ID) {
-			log.Printf("Testing services on peer: %s\n", FormatPeerID(id))
-			client.AutoTestServices(id)
-		}(peerID)
-	}
-}
-
 // GetConnectionInfo returns connection information for sharing
 func (du *DiscoveryUtils) GetConnectionInfo() map[string]interface{} {
 	return map[string]interface{}{
@@ -0,0 +1,201 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	peer "github.com/libp2p/go-libp2p/core/peer"
+	"github.com/realentity/realentity-node/internal/services"
+)
+
+// ProviderSource finds the peers that provide a service, best candidates first
+type ProviderSource interface {
+	FindProviders(service string) []peer.ID
+}
+
+// CallOptions controls retries, failover and hedging for CallAny
+type CallOptions struct {
+	MaxAttempts    int           // Total attempts across all providers
+	InitialBackoff time.Duration // Delay before retrying a provider that already failed
+	MaxBackoff     time.Duration // Upper bound for the retry delay
+	AttemptTimeout time.Duration // Time allowed for a single attempt (0 = no limit)
+	HedgeDelay     time.Duration // Start a parallel attempt after this delay (0 = no hedging)
+}
+
+// DefaultCallOptions returns the options used by CallAny
+func DefaultCallOptions() *CallOptions {
+	return &CallOptions{
+		MaxAttempts:    3,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     2 * time.Second,
+	}
+}
+
+// withDefaults fills unset fields from the default options
+func (o *CallOptions) withDefaults() *CallOptions {
+	defaults := DefaultCallOptions()
+	if o == nil {
+		return defaults
+	}
+
+	result := *o
+	if result.MaxAttempts <= 0 {
+		result.MaxAttempts = defaults.MaxAttempts
+	}
+	if result.InitialBackoff <= 0 {
+		result.InitialBackoff = defaults.InitialBackoff
+	}
+	if result.MaxBackoff <= 0 {
+		result.MaxBackoff = defaults.MaxBackoff
+	}
+	return &result
+}
+
+// SetProviderSource sets where CallAny looks up the providers of a service
+func (c *ServiceClient) SetProviderSource(source ProviderSource) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.providers = source
+}
+
+// CallAny calls a service on any peer that provides it, retrying and failing
+// over to other providers on retryable errors
+func (c *ServiceClient) CallAny(ctx context.Context, serviceName string, payload interface{}) (*services.ServiceResponse, error) {
+	return c.CallAnyWithOptions(ctx, serviceName, payload, DefaultCallOptions())
+}
+
+// attemptResult is the outcome of a single CallAny attempt
+type attemptResult struct {
+	peerID   peer.ID
+	response *services.ServiceResponse
+	err      error
+}
+
+// CallAnyWithOptions calls a service on any provider using custom retry and hedging options.
+// Attempts go to the providers in order; a provider is only tried again, after a
+// backoff, once every provider has been tried. With hedging enabled another
+// attempt starts whenever the running ones take longer than the hedge delay.
+func (c *ServiceClient) CallAnyWithOptions(ctx context.Context, serviceName string, payload interface{}, options *CallOptions) (*services.ServiceResponse, error) {
+	options = options.withDefaults()
+
+	c.mu.Lock()
+	source := c.providers
+	c.mu.Unlock()
+	if source == nil {
+		return nil, fmt.Errorf("no provider source configured")
+	}
+
+	providers := source.FindProviders(serviceName)
+	if len(providers) == 0 {
+		return nil, fmt.Errorf("no providers found for service '%s'", serviceName)
+	}
+
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %v", err)
+	}
+
+	// Abandon attempts that are still running once we have an answer
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan attemptResult, options.MaxAttempts)
+	launched, running := 0, 0
+	launch := func() {
+		peerID := providers[launched%len(providers)]
+		launched++
+		running++
+
+		request := &services.ServiceRequest{
+			Service:   serviceName,
+			Payload:   json.RawMessage(payloadBytes),
+			RequestID: uuid.New().String(),
+		}
+		go func() {
+			attemptCtx := ctx
+			if options.AttemptTimeout > 0 {
+				var attemptCancel context.CancelFunc
+				attemptCtx, attemptCancel = context.WithTimeout(ctx, options.AttemptTimeout)
+				defer attemptCancel()
+			}
+			response, err := c.SendRequest(attemptCtx, peerID, request)
+			results <- attemptResult{peerID: peerID, response: response, err: err}
+		}()
+	}
+
+	var hedge, retry <-chan time.Time
+	var lastErr error
+	launch()
+	for running > 0 || retry != nil {
+		hedge = nil
+		if options.HedgeDelay > 0 && retry == nil && launched < options.MaxAttempts && launched < len(providers) {
+			hedge = time.After(options.HedgeDelay)
+		}
+
+		select {
+		case result := <-results:
+			running--
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("request cancelled: %v", ctx.Err())
+			}
+			if !isRetryable(result.response, result.err) {
+				if result.response.ServedBy == "" {
+					result.response.ServedBy = result.peerID.String()
+				}
+				return result.response, nil
+			}
+
+			lastErr = result.err
+			if lastErr == nil {
+				lastErr = fmt.Errorf("%s", result.response.Error)
+			}
+			log.Printf("Call to %s on peer %s failed: %v\n", serviceName, FormatPeerID(result.peerID), lastErr)
+
+			if launched >= options.MaxAttempts || retry != nil {
+				continue
+			}
+			if launched < len(providers) {
+				// Fail over to the next provider right away
+				launch()
+			} else {
+				retry = time.After(backoff(options, launched/len(providers)))
+			}
+		case <-retry:
+			retry = nil
+			launch()
+		case <-hedge:
+			log.Printf("Hedging call to %s after %v\n", serviceName, options.HedgeDelay)
+			launch()
+		case <-ctx.Done():
+			return nil, fmt.Errorf("request cancelled: %v", ctx.Err())
+		}
+	}
+
+	return nil, fmt.Errorf("all %d attempts for service '%s' failed: %v", launched, serviceName, lastErr)
+}
+
+// isRetryable reports whether a failed call may succeed on another attempt.
+// Transport failures, timed out attempts and providers that no longer offer
+// the service are retried; errors returned by the service itself are not.
+func isRetryable(response *services.ServiceResponse, err error) bool {
+	if err != nil {
+		return true
+	}
+	return !response.Success && response.Code == services.ErrCodeServiceNotFound
+}
+
+// backoff returns the delay before the given retry round
+func backoff(options *CallOptions, round int) time.Duration {
+	delay := options.InitialBackoff
+	for i := 1; i < round && delay < options.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > options.MaxBackoff {
+		delay = options.MaxBackoff
+	}
+	return delay
+}
@@ -0,0 +1,221 @@
+package utils
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	network "github.com/libp2p/go-libp2p/core/network"
+	peer "github.com/libp2p/go-libp2p/core/peer"
+	protocol "github.com/libp2p/go-libp2p/core/protocol"
+	rprotocol "github.com/realentity/realentity-node/internal/protocol"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ClientConfig contains stream reuse and circuit breaker settings for a ServiceClient
+type ClientConfig struct {
+	MaxStreamsPerPeer int           // Maximum concurrent request streams to one peer
+	MaxIdleTime       time.Duration // How long an unused stream is kept for reuse
+	DisablePooling    bool          // Open a new stream for every call
+
+	BreakerThreshold int           // Consecutive failures that open the breaker for a service on a peer
+	BreakerCooldown  time.Duration // How long an open breaker rejects calls before a trial call
+	DisableBreakers  bool          // Never short-circuit calls
+
+	TracerProvider trace.TracerProvider // Records call spans (nil = global tracer provider)
+}
+
+// DefaultClientConfig returns the settings used by NewServiceClient
+func DefaultClientConfig() *ClientConfig {
+	return &ClientConfig{
+		MaxStreamsPerPeer: 8,
+		// Shorter than the remote idle timeout so reused streams are still open
+		MaxIdleTime:      5 * time.Second,
+		BreakerThreshold: 5,
+		BreakerCooldown:  30 * time.Second,
+	}
+}
+
+// withDefaults fills unset fields from the default configuration
+func (c *ClientConfig) withDefaults() *ClientConfig {
+	defaults := DefaultClientConfig()
+	if c == nil {
+		return defaults
+	}
+
+	result := *c
+	if result.MaxStreamsPerPeer <= 0 {
+		result.MaxStreamsPerPeer = defaults.MaxStreamsPerPeer
+	}
+	if result.MaxIdleTime <= 0 {
+		result.MaxIdleTime = defaults.MaxIdleTime
+	}
+	if result.BreakerThreshold <= 0 {
+		result.BreakerThreshold = defaults.BreakerThreshold
+	}
+	if result.BreakerCooldown <= 0 {
+		result.BreakerCooldown = defaults.BreakerCooldown
+	}
+	return &result
+}
+
+// CallTimings describes where the time of a single call was spent
+type CallTimings struct {
+	Acquire time.Duration // Waiting for a stream slot and opening or reusing a stream
+	Write   time.Duration // Sending the request
+	Wait    time.Duration // Waiting for the response
+	Total   time.Duration
+	Reused  bool // Whether an idle stream was reused
+}
+
+// requestStream is a request stream together with its buffered codec state
+type requestStream struct {
+	stream    network.Stream
+	pool      *streamPool // nil when pooling is disabled
+	writer    *bufio.Writer
+	decoder   *json.Decoder
+	reusable  bool // Negotiated the persistent protocol
+	reused    bool
+	idleSince time.Time
+}
+
+func newRequestStream(stream network.Stream) *requestStream {
+	return &requestStream{
+		stream:   stream,
+		writer:   bufio.NewWriter(stream),
+		decoder:  json.NewDecoder(bufio.NewReader(stream)),
+		reusable: stream.Protocol() == protocol.ID(rprotocol.PersistentProtocolID),
+	}
+}
+
+// streamPool keeps idle request streams to one peer and bounds how many
+// streams are in use at once
+type streamPool struct {
+	slots chan struct{}
+	mu    sync.Mutex
+	idle  []*requestStream
+}
+
+// takeIdle returns the most recently used idle stream that has not expired
+func (p *streamPool) takeIdle(maxIdle time.Duration) *requestStream {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for len(p.idle) > 0 {
+		rs := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+		if time.Since(rs.idleSince) < maxIdle {
+			return rs
+		}
+		rs.stream.Close()
+	}
+	return nil
+}
+
+// putIdle keeps a stream for reuse and closes the ones that expired
+func (p *streamPool) putIdle(rs *requestStream, maxIdle time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Idle streams are ordered oldest first
+	expired := 0
+	for expired < len(p.idle) && time.Since(p.idle[expired].idleSince) >= maxIdle {
+		p.idle[expired].stream.Close()
+		expired++
+	}
+	p.idle = append(p.idle[expired:], rs)
+}
+
+// closeIdle closes all idle streams
+func (p *streamPool) closeIdle() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, rs := range p.idle {
+		rs.stream.Close()
+	}
+	p.idle = nil
+}
+
+// pool returns the stream pool for a peer, creating it if needed
+func (c *ServiceClient) pool(peerID peer.ID) *streamPool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pool, exists := c.pools[peerID]
+	if !exists {
+		pool = &streamPool{slots: make(chan struct{}, c.config.MaxStreamsPerPeer)}
+		c.pools[peerID] = pool
+	}
+	return pool
+}
+
+// acquireStream returns an idle stream to the peer or opens a new one.
+// With fresh set an idle stream is never reused.
+func (c *ServiceClient) acquireStream(ctx context.Context, peerID peer.ID, fresh bool) (*requestStream, error) {
+	if c.config.DisablePooling {
+		stream, err := c.host.NewStream(ctx, peerID, protocol.ID(rprotocol.ProtocolID))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open stream: %v", err)
+		}
+		return newRequestStream(stream), nil
+	}
+
+	pool := c.pool(peerID)
+	select {
+	case pool.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, fmt.Errorf("failed to open stream: %v", ctx.Err())
+	}
+
+	if !fresh {
+		if rs := pool.takeIdle(c.config.MaxIdleTime); rs != nil {
+			rs.reused = true
+			return rs, nil
+		}
+	}
+
+	// Prefer the persistent protocol, older peers only speak the single-shot one
+	stream, err := c.host.NewStream(ctx, peerID,
+		protocol.ID(rprotocol.PersistentProtocolID), protocol.ID(rprotocol.ProtocolID))
+	if err != nil {
+		<-pool.slots
+		return nil, fmt.Errorf("failed to open stream: %v", err)
+	}
+	rs := newRequestStream(stream)
+	rs.pool = pool
+	return rs, nil
+}
+
+// releaseStream returns a stream to its pool after a successful exchange,
+// otherwise the stream is closed
+func (c *ServiceClient) releaseStream(rs *requestStream, ok bool) {
+	if rs.pool == nil {
+		rs.stream.Close()
+		return
+	}
+	defer func() { <-rs.pool.slots }()
+
+	if !ok || !rs.reusable {
+		rs.stream.Close()
+		return
+	}
+
+	rs.stream.SetDeadline(time.Time{})
+	rs.reused = false
+	rs.idleSince = time.Now()
+	rs.pool.putIdle(rs, c.config.MaxIdleTime)
+}
+
+// Close closes all idle streams kept for reuse
+func (c *ServiceClient) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, pool := range c.pools {
+		pool.closeIdle()
+	}
+}
@@ -0,0 +1,522 @@
+package realentity
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/realentity/realentity-node/internal/api"
+	"github.com/realentity/realentity-node/internal/config"
+	"github.com/realentity/realentity-node/internal/discovery"
+	inode "github.com/realentity/realentity-node/internal/node"
+	"github.com/realentity/realentity-node/internal/protocol"
+	"github.com/realentity/realentity-node/internal/routing"
+	"github.com/realentity/realentity-node/internal/services"
+	"github.com/realentity/realentity-node/internal/tracing"
+	"github.com/realentity/realentity-node/internal/utils"
+	"go.opentelemetry.io/otel/trace"
+
+	// Import service implementations so their factories are available
+	_ "github.com/realentity/realentity-node/internal/services/impl"
+)
+
+// Node is a RealEntity node that serves the services of its registry to peers
+type Node struct {
+	config     *Config
+	configFile string
+	configMu   sync.Mutex // Guards runtime changes to config
+	registry   *Registry
+
+	host      host.Host
+	discovery *Discovery
+	gater     *ConnectionGater
+	client    *Client
+	apiServer *api.Server
+	tracer    trace.TracerProvider
+	shutdown  tracing.ShutdownFunc
+	cancel    context.CancelFunc
+	mu        sync.Mutex
+}
+
+// NewNode creates a node with its own service registry. A Server.Port of 0
+// listens on a random port and a Server.HTTPPort of 0 disables the HTTP API.
+func NewNode(cfg *Config) (*Node, error) {
+	return NewNodeWithRegistry(cfg, services.NewRegistry())
+}
+
+// NewNodeWithRegistry creates a node serving the services of the given registry
+func NewNodeWithRegistry(cfg *Config, registry *Registry) (*Node, error) {
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	if registry == nil {
+		return nil, fmt.Errorf("registry cannot be nil")
+	}
+
+	return &Node{
+		config:   cfg,
+		registry: registry,
+	}, nil
+}
+
+// Start creates the libp2p host and starts discovery, the protocol handlers
+// and, if configured, the HTTP API
+func (n *Node) Start(ctx context.Context) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.host != nil {
+		return fmt.Errorf("node already started")
+	}
+	cfg := n.config
+
+	gater, err := inode.NewConnectionGater(inode.GaterConfig{
+		Allow:   cfg.Gating.Allow,
+		Deny:    cfg.Gating.Deny,
+		BanFile: cfg.Gating.BanFile,
+	})
+	if err != nil {
+		return fmt.Errorf("connection gater setup failed: %v", err)
+	}
+
+	h, err := createHost(ctx, cfg, gater)
+	if err != nil {
+		return fmt.Errorf("host creation failed: %v", err)
+	}
+
+	// Set up distributed tracing, with a tracer provider of this node's own
+	tracer, shutdown, err := tracing.Setup(tracing.Config{
+		Enabled:     cfg.Tracing.Enabled,
+		Exporter:    cfg.Tracing.Exporter,
+		FilePath:    cfg.Tracing.FilePath,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	}, h.ID().String())
+	if err != nil {
+		log.Printf("Tracing setup failed: %v\n", err)
+	}
+
+	runCtx, cancel := context.WithCancel(context.Background())
+
+	// Set up discovery
+	dm := discovery.NewDiscoveryManagerWithConfig(h, &discovery.PeerStoreConfig{
+		MaxPeers:      cfg.Discovery.MaxPeers,
+		PeerTTL:       time.Duration(cfg.Discovery.PeerTTLMinutes) * time.Minute,
+		UnreliableTTL: time.Duration(cfg.Discovery.UnreliablePeerTTLMinutes) * time.Minute,
+	})
+
+	if cfg.Discovery.EnableMDNS {
+		if err := discovery.SetupEnhancedMDNS(runCtx, h, cfg.Discovery.MDNSServiceTag, dm); err != nil {
+			log.Printf("mDNS setup failed: %v\n", err)
+		}
+	}
+
+	// Bootstrap peers can be added at runtime, so the mechanism runs even without any
+	var bootstrapDisc *discovery.BootstrapDiscovery
+	if cfg.Discovery.EnableBootstrap {
+		bootstrapDisc, err = discovery.NewBootstrapDiscovery(h, cfg.Discovery.BootstrapPeers)
+		if err != nil {
+			log.Printf("Bootstrap discovery setup failed: %v\n", err)
+		} else {
+			dm.AddMechanism(bootstrapDisc)
+		}
+	}
+
+	if cfg.Discovery.StaticPeersFile != "" {
+		dm.AddMechanism(discovery.NewStaticPeersDiscovery(dm, cfg.Discovery.StaticPeersFile, 0))
+	}
+
+	if dns := cfg.Discovery.DNS; len(dns.DNSAddrs) > 0 || len(dns.SRVNames) > 0 {
+		dm.AddMechanism(discovery.NewDNSDiscovery(dm, discovery.DNSConfig{
+			DNSAddrs:   dns.DNSAddrs,
+			SRVNames:   dns.SRVNames,
+			PeerIDPort: dns.PeerIDHTTPPort,
+			Resolver:   discovery.NewDNSResolver(dns.Resolver),
+			Interval:   time.Duration(dns.IntervalSeconds) * time.Second,
+		}))
+	}
+
+	if pex := cfg.Discovery.PEX; pex.Enabled {
+		dm.AddMechanism(discovery.NewPEXDiscovery(dm, &discovery.PEXConfig{
+			Interval:   time.Duration(pex.IntervalSeconds) * time.Second,
+			SampleSize: pex.SampleSize,
+		}))
+	}
+
+	if cfg.Discovery.EnableDHT {
+		dhtDisc, err := discovery.NewDHTDiscoveryWithConfig(h, discovery.DHTConfig{
+			Rendezvous:     cfg.Discovery.DHTRendezvous,
+			BootstrapPeers: discovery.ParseBootstrapPeers(cfg.Discovery.BootstrapPeers),
+			Mode:           cfg.Discovery.DHTMode,
+			Services:       n.registry.ListServices,
+		})
+		if err != nil {
+			log.Printf("DHT discovery setup failed: %v\n", err)
+		} else {
+			dm.AddMechanism(dhtDisc)
+		}
+	}
+
+	// Look for peers more often while the node has too few
+	schedule := cfg.Discovery.Schedule
+	targetPeers := schedule.TargetPeers
+	if targetPeers == 0 {
+		targetPeers = cfg.Discovery.AutoDial.TargetPeers
+	}
+	scheduleConfig := &discovery.ScheduleConfig{
+		TargetPeers: targetPeers,
+		MinInterval: time.Duration(schedule.MinIntervalSeconds) * time.Second,
+		Defaults:    mechanismSchedule(schedule.Defaults),
+		Mechanisms:  make(map[string]discovery.MechanismSchedule),
+	}
+	for name, mechanism := range schedule.Mechanisms {
+		scheduleConfig.Mechanisms[name] = mechanismSchedule(mechanism)
+	}
+	dm.SetSchedule(scheduleConfig)
+
+	if err := dm.Start(); err != nil {
+		log.Printf("Failed to start discovery manager: %v\n", err)
+	}
+
+	// Keep pinned peers connected
+	for _, ai := range discovery.ParseBootstrapPeers(cfg.Connections.PinnedPeers) {
+		dm.PinPeer(ai)
+	}
+
+	// Remember known peers across restarts
+	if cfg.Discovery.PeerStoreFile != "" {
+		if err := dm.EnablePersistence(discovery.PersistenceConfig{
+			Path:   cfg.Discovery.PeerStoreFile,
+			MaxAge: time.Duration(cfg.Discovery.PeerStoreMaxAgeHours) * time.Hour,
+		}); err != nil {
+			log.Printf("Failed to load peer store: %v\n", err)
+		}
+	}
+
+	// Connect to peers found by any discovery mechanism
+	if dial := cfg.Discovery.AutoDial; dial.TargetPeers >= 0 {
+		dm.EnableAutoDial(&discovery.DialPolicy{
+			TargetPeers:        dial.TargetPeers,
+			MaxConcurrentDials: dial.MaxConcurrentDials,
+			InitialBackoff:     time.Duration(dial.BackoffSeconds) * time.Second,
+			MaxBackoff:         time.Duration(dial.MaxBackoffSeconds) * time.Second,
+		})
+	}
+
+	// One client makes every remote call, so its stream pool and circuit
+	// breakers cover API calls, forwarded requests and probes alike
+	client := utils.NewServiceClientWithConfig(h, &utils.ClientConfig{TracerProvider: tracer})
+	client.SetProviderSource(dm)
+
+	// Measure latency and health of connected peers
+	if cfg.Discovery.ProbeIntervalSeconds >= 0 {
+		dm.EnableProbing(client, time.Duration(cfg.Discovery.ProbeIntervalSeconds)*time.Second)
+	}
+
+	// Call services on peers to check that they serve requests
+	if probes := cfg.Discovery.ServiceProbes; probes.Enabled && len(probes.Services) > 0 {
+		policy := discovery.ServiceProbePolicy{
+			OnConnect: probes.OnConnect,
+			Interval:  time.Duration(probes.IntervalSeconds) * time.Second,
+			Timeout:   time.Duration(probes.TimeoutSeconds) * time.Second,
+		}
+		for _, target := range probes.Services {
+			policy.Probes = append(policy.Probes, discovery.ServiceProbe{Service: target.Service, Payload: target.Payload})
+		}
+		dm.EnableServiceProbing(client, policy)
+	}
+
+	// Forward requests for services we don't provide to peers that do
+	if cfg.Routing.Enabled {
+		router := routing.NewRouter(h, dm, client, cfg.Routing.MaxHops, time.Duration(cfg.Routing.TimeoutSeconds)*time.Second)
+		router.SetTracerProvider(tracer)
+		n.registry.SetForwarder(router)
+		log.Printf("Request routing enabled (max hops: %d)\n", cfg.Routing.MaxHops)
+	}
+
+	// Register protocol handlers
+	handlerConfig := &protocol.HandlerConfig{
+		ReadTimeout:    time.Duration(cfg.Protocol.ReadTimeoutSeconds) * time.Second,
+		IdleTimeout:    time.Duration(cfg.Protocol.IdleTimeoutSeconds) * time.Second,
+		WriteTimeout:   time.Duration(cfg.Protocol.WriteTimeoutSeconds) * time.Second,
+		MaxRequestSize: cfg.Protocol.MaxRequestBytes,
+		Registry:       n.registry,
+		TracerProvider: tracer,
+	}
+	protocol.RegisterHandlerWithConfig(h, protocol.ProtocolID, handlerConfig)
+	protocol.RegisterPersistentHandler(h, handlerConfig)
+	protocol.RegisterServicesHandlerWithRegistry(h, n.registry)
+	protocol.RegisterDescribeHandler(h, n.registry, cfg.Labels)
+
+	// Start HTTP API server
+	if cfg.Server.HTTPPort > 0 || cfg.Server.HTTPSPort > 0 {
+		n.apiServer = api.NewServer(h, dm, client, cfg.Server.HTTPPort, cfg.Server.HTTPSPort, cfg.Server.TLSCertFile, cfg.Server.TLSKeyFile)
+		n.apiServer.SetRegistry(n.registry)
+		n.apiServer.SetTracerProvider(tracer)
+		n.apiServer.SetAdminToken(cfg.Server.AdminToken)
+		n.apiServer.SetGater(gater)
+		if bootstrapDisc != nil {
+			n.apiServer.SetBootstrap(bootstrapDisc, n.saveBootstrapPeers)
+		}
+		go func(server *api.Server) {
+			if err := server.Start(); err != nil {
+				log.Printf("HTTP API server failed: %v\n", err)
+			}
+		}(n.apiServer)
+	}
+
+	n.host = h
+	n.gater = gater
+	n.discovery = dm
+	n.client = client
+	n.tracer = tracer
+	n.shutdown = shutdown
+	n.cancel = cancel
+
+	log.Printf("Node started with ID: %s\n", utils.FormatPeerID(h.ID()))
+	return nil
+}
+
+// SetConfigFile sets the file that configuration changes made at runtime,
+// such as bootstrap peers added through the API, are saved to. Without a
+// file they last until the node stops.
+func (n *Node) SetConfigFile(filename string) {
+	n.configMu.Lock()
+	defer n.configMu.Unlock()
+	n.configFile = filename
+}
+
+// saveBootstrapPeers records bootstrap peers changed at runtime in the
+// configuration. Only bootstrap_peers is written to the file, so defaults and
+// overrides applied at startup stay out of it.
+func (n *Node) saveBootstrapPeers(addrs []string) error {
+	n.configMu.Lock()
+	defer n.configMu.Unlock()
+
+	n.config.Discovery.BootstrapPeers = addrs
+	if n.configFile == "" {
+		return nil
+	}
+	return config.SaveBootstrapPeers(n.configFile, addrs)
+}
+
+// mechanismSchedule converts the configured schedule of a discovery mechanism
+func mechanismSchedule(cfg MechanismScheduleConfig) discovery.MechanismSchedule {
+	return discovery.MechanismSchedule{
+		Interval:    time.Duration(cfg.IntervalSeconds) * time.Second,
+		MaxInterval: time.Duration(cfg.MaxIntervalSeconds) * time.Second,
+		Limit:       cfg.Limit,
+		Timeout:     time.Duration(cfg.TimeoutSeconds) * time.Second,
+	}
+}
+
+// createHost creates the libp2p host described by the configuration
+func createHost(ctx context.Context, cfg *Config, gater *inode.ConnectionGater) (host.Host, error) {
+	hostConfig := inode.DefaultHostConfig()
+	hostConfig.ListenPort = cfg.Server.Port
+	hostConfig.LowWater = cfg.Connections.LowWater
+	hostConfig.HighWater = cfg.Connections.HighWater
+	hostConfig.GracePeriod = time.Duration(cfg.Connections.GracePeriodSeconds) * time.Second
+	hostConfig.Gater = gater
+	if cfg.Server.PublicIP != "" {
+		hostConfig.ExternalIP = cfg.Server.PublicIP
+		hostConfig.EnableNATSvc = false // Usually not needed with a known public IP
+	}
+	if cfg.SwarmKeyFile != "" {
+		psk, err := inode.LoadSwarmKey(cfg.SwarmKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		hostConfig.PSK = psk
+	}
+
+	if cfg.PrivateKey != "" {
+		// Use the configured private key for a consistent peer ID
+		priv, err := inode.DecodePrivateKeyFromBase64(cfg.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode private key: %v", err)
+		}
+		return inode.CreateHostWithPrivateKey(ctx, hostConfig, priv)
+	}
+
+	return inode.CreateHostWithConfig(ctx, hostConfig)
+}
+
+// Stop shuts down the HTTP API, discovery and the libp2p host
+func (n *Node) Stop() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.host == nil {
+		return nil
+	}
+
+	if n.apiServer != nil {
+		n.apiServer.Stop()
+		n.apiServer = nil
+	}
+	n.discovery.Stop()
+	n.client.Close()
+	n.cancel()
+
+	if n.shutdown != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		n.shutdown(ctx)
+		cancel()
+	}
+
+	err := n.host.Close()
+	n.host = nil
+	return err
+}
+
+// RegisterService adds a service that peers can call on this node
+func (n *Node) RegisterService(service *Service) error {
+	return n.registry.RegisterService(service)
+}
+
+// RegisterBuiltinServices registers the services bundled with the node
+// (echo, math and text processing)
+func (n *Node) RegisterBuiltinServices(nodeID string) error {
+	instances, err := services.GlobalServiceRegistry.CreateAllServices(nodeID)
+	if err != nil {
+		return fmt.Errorf("failed to create services: %v", err)
+	}
+
+	for _, service := range instances {
+		if err := n.registry.RegisterService(service); err != nil {
+			return fmt.Errorf("failed to register service %s: %v", service.Name, err)
+		}
+	}
+	return nil
+}
+
+// Services returns the names of the services registered on this node
+func (n *Node) Services() []string {
+	return n.registry.ListServices()
+}
+
+// Registry returns the service registry of this node
+func (n *Node) Registry() *Registry {
+	return n.registry
+}
+
+// ID returns the peer ID of the started node
+func (n *Node) ID() peer.ID {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.host == nil {
+		return ""
+	}
+	return n.host.ID()
+}
+
+// Addrs returns the full multiaddrs, including the peer ID, peers can dial
+func (n *Node) Addrs() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.host == nil {
+		return nil
+	}
+
+	suffix := multiaddr.StringCast("/p2p/" + n.host.ID().String())
+	addrs := make([]string, 0, len(n.host.Addrs()))
+	for _, addr := range n.host.Addrs() {
+		addrs = append(addrs, addr.Encapsulate(suffix).String())
+	}
+	return addrs
+}
+
+// Connect connects to a peer given its full multiaddr and learns which
+// services it provides
+func (n *Node) Connect(ctx context.Context, addr string) error {
+	h, dm, client := n.Host(), n.Discovery(), n.Client()
+	if h == nil {
+		return fmt.Errorf("node not started")
+	}
+
+	maddr, err := multiaddr.NewMultiaddr(addr)
+	if err != nil {
+		return fmt.Errorf("invalid multiaddr: %v", err)
+	}
+	addrInfo, err := peer.AddrInfoFromP2pAddr(maddr)
+	if err != nil {
+		return fmt.Errorf("invalid peer address: %v", err)
+	}
+
+	if err := h.Connect(ctx, *addrInfo); err != nil {
+		return fmt.Errorf("connection failed: %v", err)
+	}
+
+	description, err := client.DescribeRemotePeer(ctx, addrInfo.ID)
+	if err != nil {
+		return fmt.Errorf("failed to query peer services: %v", err)
+	}
+	dm.UpdatePeerServices(addrInfo.ID, description.Services)
+	dm.UpdatePeerLabels(addrInfo.ID, description.Labels)
+	return nil
+}
+
+// Client returns the client used to call services on other peers, or nil
+// before the node is started
+func (n *Node) Client() *Client {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.client
+}
+
+// TracerProvider returns the tracer provider recording the spans of this
+// node, or nil before the node is started or when tracing failed to set up
+func (n *Node) TracerProvider() trace.TracerProvider {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.tracer
+}
+
+// Discovery returns the peer discovery manager, or nil before the node is started
+func (n *Node) Discovery() *Discovery {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.discovery
+}
+
+// Gater returns the connection gater enforcing allow and deny rules and bans,
+// or nil before the node is started
+func (n *Node) Gater() *ConnectionGater {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.gater
+}
+
+// Host returns the underlying libp2p host, or nil before the node is started
+func (n *Node) Host() host.Host {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.host
+}
+
+// FindProviders looks up providers of a service through the discovery
+// mechanisms that support it, such as the DHT, and connects to them. It
+// returns the connected providers, best scored first.
+func (n *Node) FindProviders(ctx context.Context, serviceName string, limit int) ([]peer.ID, error) {
+	dm := n.Discovery()
+	if dm == nil {
+		return nil, fmt.Errorf("node not started")
+	}
+	return dm.DiscoverProviders(ctx, serviceName, limit), nil
+}
+
+// Broadcast calls a service on all connected peers matching the selector
+func (n *Node) Broadcast(ctx context.Context, selector PeerSelector, serviceName string, payload interface{}, options *BroadcastOptions) (*BroadcastResult, error) {
+	dm, client := n.Discovery(), n.Client()
+	if dm == nil {
+		return nil, fmt.Errorf("node not started")
+	}
+	return client.Broadcast(ctx, dm.SelectPeers(selector), serviceName, payload, options)
+}
@@ -0,0 +1,136 @@
+package realentity
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startNode starts an in-process node without discovery or HTTP API
+func startNode(t *testing.T, labels ...string) *Node {
+	cfg := DefaultConfig()
+	cfg.Server.Port = 0
+	cfg.Server.HTTPPort = 0
+	cfg.Discovery.EnableMDNS = false
+	cfg.Discovery.EnableBootstrap = false
+	cfg.Discovery.PeerStoreFile = "" // Don't remember peers across runs
+	cfg.Labels = labels
+
+	n, err := NewNode(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create node: %v", err)
+	}
+	if err := n.Start(context.Background()); err != nil {
+		t.Fatalf("Failed to start node: %v", err)
+	}
+	t.Cleanup(func() { n.Stop() })
+	return n
+}
+
+// tcpAddr returns a TCP multiaddr of the node
+func tcpAddr(t *testing.T, n *Node) string {
+	for _, addr := range n.Addrs() {
+		if strings.Contains(addr, "/tcp/") {
+			return addr
+		}
+	}
+	t.Fatal("Node has no TCP address")
+	return ""
+}
+
+// TestNodesCallEachOther tests that two in-process nodes serve their own services
+func TestNodesCallEachOther(t *testing.T) {
+	caller := startNode(t)
+	provider := startNode(t, "greeter")
+
+	provider.RegisterService(&Service{
+		Name: "greet",
+		Handler: func(payload []byte) ([]byte, error) {
+			return []byte(`"hello"`), nil
+		},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := caller.Connect(ctx, tcpAddr(t, provider)); err != nil {
+		t.Fatalf("Failed to connect nodes: %v", err)
+	}
+
+	response, err := caller.Client().CallService(ctx, provider.ID(), "greet", nil)
+	if err != nil {
+		t.Fatalf("CallService failed: %v", err)
+	}
+	if !response.Success || string(response.Result) != `"hello"` {
+		t.Fatalf("Unexpected response: %+v", response)
+	}
+
+	// The caller's registry must not serve the provider's service
+	if _, exists := caller.Registry().GetService("greet"); exists {
+		t.Error("Nodes should not share a registry")
+	}
+
+	response, err = caller.Client().CallAny(ctx, "greet", nil)
+	if err != nil || !response.Success {
+		t.Fatalf("CallAny failed: %v %+v", err, response)
+	}
+
+	result, err := caller.Broadcast(ctx, PeerSelector{Label: "greeter"}, "greet", nil, nil)
+	if err != nil {
+		t.Fatalf("Broadcast failed: %v", err)
+	}
+	if !result.Complete || result.Targeted != 1 {
+		t.Fatalf("Unexpected broadcast result: %+v", result)
+	}
+}
+
+// TestSaveBootstrapPeers tests that saving bootstrap peers changes only
+// bootstrap_peers in the config file and keeps the file's permissions
+func TestSaveBootstrapPeers(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.json")
+	original := `{"private_key": "secret", "discovery": {"enable_mdns": false}}`
+	if err := os.WriteFile(filename, []byte(original), 0600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	cfg := DefaultConfig()
+	cfg.Server.Port = 4001 // Set at startup, must not reach the file
+	n := &Node{config: cfg}
+	n.SetConfigFile(filename)
+
+	addr := "/ip4/127.0.0.1/tcp/4001/p2p/12D3KooWExample"
+	if err := n.saveBootstrapPeers([]string{addr}); err != nil {
+		t.Fatalf("Failed to save bootstrap peers: %v", err)
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to read config file: %v", err)
+	}
+	var saved map[string]interface{}
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatalf("Failed to parse config file: %v", err)
+	}
+	if _, exists := saved["server"]; exists {
+		t.Errorf("Expected no server section in the file, got %s", data)
+	}
+	discovery, _ := saved["discovery"].(map[string]interface{})
+	if peers, _ := discovery["bootstrap_peers"].([]interface{}); len(peers) != 1 || peers[0] != addr {
+		t.Errorf("Expected the saved bootstrap peer, got %v", discovery["bootstrap_peers"])
+	}
+	if discovery["enable_mdns"] != false || saved["private_key"] != "secret" {
+		t.Errorf("Expected other settings to be kept, got %s", data)
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatalf("Failed to stat config file: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected mode 0600, got %v", info.Mode().Perm())
+	}
+}
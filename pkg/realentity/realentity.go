@@ -0,0 +1,116 @@
+// Package realentity embeds a RealEntity node in another Go program and calls
+// services on the peer-to-peer network.
+//
+// A Node owns a libp2p host, peer discovery and a service registry. Services
+// registered on a node can be called by any peer, and the node's Client calls
+// services on other peers:
+//
+//	node, err := realentity.NewNode(realentity.DefaultConfig())
+//	...
+//	node.RegisterService(&realentity.Service{Name: "greet", Handler: greet})
+//	if err := node.Start(ctx); err != nil { ... }
+//	defer node.Stop()
+//
+//	response, err := node.Client().CallService(ctx, peerID, "greet", payload)
+package realentity
+
+import (
+	"github.com/realentity/realentity-node/internal/config"
+	"github.com/realentity/realentity-node/internal/discovery"
+	inode "github.com/realentity/realentity-node/internal/node"
+	"github.com/realentity/realentity-node/internal/services"
+	"github.com/realentity/realentity-node/internal/utils"
+)
+
+// Configuration
+type (
+	Config          = config.NodeConfig
+	DiscoveryConfig = config.DiscoveryConfig
+	ServerConfig    = config.ServerConfig
+	RoutingConfig   = config.RoutingConfig
+	ProtocolConfig  = config.ProtocolConfig
+	TracingConfig   = config.TracingConfig
+
+	ConnectionsConfig = config.ConnectionsConfig
+	GatingConfig      = config.GatingConfig
+
+	DiscoveryScheduleConfig = config.DiscoveryScheduleConfig
+	MechanismScheduleConfig = config.MechanismScheduleConfig
+)
+
+// Services
+type (
+	Service               = services.Service
+	ServiceHandler        = services.ServiceHandler
+	ServiceContextHandler = services.ServiceContextHandler
+	ServiceRequest        = services.ServiceRequest
+	ServiceResponse       = services.ServiceResponse
+	Registry              = services.Registry
+)
+
+// Client API
+type (
+	Client           = utils.ServiceClient
+	ClientConfig     = utils.ClientConfig
+	CallOptions      = utils.CallOptions
+	CallTimings      = utils.CallTimings
+	BroadcastOptions = utils.BroadcastOptions
+	BroadcastResult  = utils.BroadcastResult
+	PeerResult       = utils.PeerResult
+	BreakerState     = utils.BreakerState
+)
+
+// Peers
+type (
+	Discovery    = discovery.DiscoveryManager
+	PeerInfo     = discovery.PeerInfo
+	PeerSelector = discovery.PeerSelector
+	PeerEvent    = discovery.PeerEvent
+	Subscription = discovery.Subscription
+)
+
+// Connection gating
+type (
+	ConnectionGater = inode.ConnectionGater
+	Ban             = inode.Ban
+)
+
+// Peer event types
+const (
+	EventPeerDiscovered      = discovery.EventPeerDiscovered
+	EventPeerConnected       = discovery.EventPeerConnected
+	EventPeerDisconnected    = discovery.EventPeerDisconnected
+	EventPeerStatusChanged   = discovery.EventPeerStatusChanged
+	EventPeerServicesUpdated = discovery.EventPeerServicesUpdated
+	EventPeerEvicted         = discovery.EventPeerEvicted
+)
+
+// Broadcast completion modes
+const (
+	CompleteAll    = utils.CompleteAll
+	CompleteQuorum = utils.CompleteQuorum
+	CompleteFirstK = utils.CompleteFirstK
+)
+
+// ErrCircuitOpen is returned for calls short-circuited by an open circuit breaker
+var ErrCircuitOpen = utils.ErrCircuitOpen
+
+// DefaultConfig returns the default node configuration
+func DefaultConfig() *Config {
+	return config.DefaultConfig()
+}
+
+// LoadConfig loads a node configuration file, creating it with defaults if it doesn't exist
+func LoadConfig(filename string) (*Config, error) {
+	return config.LoadConfig(filename)
+}
+
+// SaveConfig writes a node configuration file
+func SaveConfig(cfg *Config, filename string) error {
+	return config.SaveConfig(cfg, filename)
+}
+
+// NewRegistry creates an empty service registry
+func NewRegistry() *Registry {
+	return services.NewRegistry()
+}
@@ -11,11 +11,38 @@ import (
 
 func main() {
 	var (
-		generateKey = flag.Bool("generate-key", false, "Generate a new private key and peer ID")
-		outputFile  = flag.String("output", "", "Output file for configuration (optional)")
+		generateKey      = flag.Bool("generate-key", false, "Generate a new private key and peer ID")
+		outputFile       = flag.String("output", "", "Output file for configuration (optional)")
+		generateSwarmKey = flag.Bool("generate-swarm-key", false, "Generate a new swarm key for a private network")
+		swarmKeyFile     = flag.String("swarm-key-output", "swarm.key", "Output file for the swarm key")
 	)
 	flag.Parse()
 
+	if *generateSwarmKey {
+		if _, err := os.Stat(*swarmKeyFile); err == nil {
+			log.Fatalf("Swarm key file %s already exists, refusing to overwrite it", *swarmKeyFile)
+		}
+
+		key, err := node.GenerateSwarmKey()
+		if err != nil {
+			log.Fatalf("Failed to generate swarm key: %v", err)
+		}
+		if err := os.WriteFile(*swarmKeyFile, key, 0600); err != nil {
+			log.Fatalf("Failed to write swarm key file: %v", err)
+		}
+
+		psk, err := node.LoadSwarmKey(*swarmKeyFile)
+		if err != nil {
+			log.Fatalf("Failed to read back swarm key: %v", err)
+		}
+
+		fmt.Printf("Swarm key saved to: %s\n", *swarmKeyFile)
+		fmt.Printf("Fingerprint: %s\n\n", node.SwarmKeyFingerprint(psk))
+		fmt.Printf("Copy the file to every node of the private network and set in config.json:\n")
+		fmt.Printf("  \"swarm_key_file\": \"%s\"\n", *swarmKeyFile)
+		return
+	}
+
 	if *generateKey {
 		privKey, peerID, err := node.GeneratePrivateKeyBase64()
 		if err != nil {
@@ -61,5 +88,6 @@ func main() {
 	}
 
 	fmt.Println("RealEntity Node Key Generator")
-	fmt.Println("Usage: go run scripts/keygen/main.go -generate-key [-output config.json]")
+	fmt.Println("Usage: go run scripts/go/keygen/main.go -generate-key [-output config.json]")
+	fmt.Println("       go run scripts/go/keygen/main.go -generate-swarm-key [-swarm-key-output swarm.key]")
 }
@@ -14,7 +14,7 @@ print_usage() {
     echo "Available scripts:"
     echo ""
     echo "Go Scripts (scripts/go/):"
-    echo "  keygen                 - Generate private keys and peer IDs"
+    echo "  keygen                 - Generate private keys, peer IDs and swarm keys"
     echo ""
     echo "Shell Scripts (scripts/shell/):"
     echo "  generate-tls-cert      - Generate TLS certificates"
@@ -22,6 +22,7 @@ print_usage() {
     echo "Examples:"
     echo "  $0 keygen"
     echo "  $0 keygen -output config.json"
+    echo "  $0 keygen -generate-swarm-key"
     echo "  $0 generate-tls-cert --domain localhost"
     echo ""
     echo "For script-specific help, run:"